@@ -0,0 +1,128 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rewriteExtensions are the files whose asset references are rewritten.
+var rewriteExtensions = map[string]bool{
+	".html": true,
+	".htm":  true,
+	".css":  true,
+}
+
+// rewriteAssets replaces references to the logical asset names of the
+// AssetManifest in dir with their fingerprinted names. The manifest is a
+// JSON object mapping each logical name to its fingerprinted name, such as
+// {"app.js": "app.3f9a2b1c.js"}. It returns the number of files changed.
+func (b *Builder) rewriteAssets(dir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(b.config.AssetManifest)))
+	if err != nil {
+		return 0, status.Errorf(codes.FailedPrecondition, "unable to read asset_manifest: %s", err)
+	}
+
+	var names map[string]string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return 0, status.Errorf(codes.FailedPrecondition, "asset_manifest %q must be a JSON object of names to fingerprinted names: %s",
+			b.config.AssetManifest, err)
+	}
+
+	re, err := assetPattern(names)
+	if err != nil || re == nil {
+		return 0, err
+	}
+
+	changed := 0
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() || !rewriteExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rewritten := replaceAssets(re, string(content), names)
+		if rewritten == string(content) {
+			return nil
+		}
+
+		changed++
+		return os.WriteFile(path, []byte(rewritten), info.Mode())
+	})
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "unable to rewrite asset references: %s", err)
+	}
+
+	return changed, nil
+}
+
+// assetPattern matches any of the logical names preceded by a quote, a
+// parenthesis, whitespace, "=" or "/", so "app.js" doesn't match inside
+// "myapp.js". Longer names are tried first.
+func assetPattern(names map[string]string) (*regexp.Regexp, error) {
+	logical := make([]string, 0, len(names))
+	for name, hashed := range names {
+		if name == "" || hashed == "" {
+			return nil, status.Errorf(codes.FailedPrecondition, "asset_manifest must not contain empty names")
+		}
+
+		if name != hashed {
+			logical = append(logical, regexp.QuoteMeta(name))
+		}
+	}
+
+	if len(logical) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(logical, func(i, j int) bool {
+		if len(logical[i]) != len(logical[j]) {
+			return len(logical[i]) > len(logical[j])
+		}
+		return logical[i] < logical[j]
+	})
+
+	return regexp.Compile(fmt.Sprintf(`(^|["'(\s=/])(%s)`, strings.Join(logical, "|")))
+}
+
+// replaceAssets rewrites every match of re in content which is followed by
+// a right delimiter. Go regular expressions have no lookahead, so the right
+// delimiter is checked here rather than consumed by the match, which would
+// hide it from a following reference.
+func replaceAssets(re *regexp.Regexp, content string, names map[string]string) string {
+	var sb strings.Builder
+	last := 0
+
+	for _, m := range re.FindAllStringSubmatchIndex(content, -1) {
+		start, end := m[4], m[5]
+		if end < len(content) && !strings.ContainsRune(`"')?# `+"\t\r\n", rune(content[end])) {
+			continue
+		}
+
+		sb.WriteString(content[last:start])
+		sb.WriteString(names[content[start:end]])
+		last = end
+	}
+
+	if last == 0 {
+		return content
+	}
+
+	sb.WriteString(content[last:])
+	return sb.String()
+}
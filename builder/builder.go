@@ -2,14 +2,24 @@ package builder
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/validate"
 	"github.com/hashicorp/waypoint-plugin-sdk/component"
 	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
 	"google.golang.org/grpc/codes"
@@ -20,8 +30,154 @@ type BuildConfig struct {
 	Source     string `hcl:"source,optional"`
 	OutputName string `hcl:"output_name,optional"`
 	Dockerfile string `hcl:"dockerfile,optional"`
+
+	// CacheDir stores extracted assets keyed by the built image ID, so a
+	// rebuild of an unchanged image skips the container and copy steps.
+	CacheDir string `hcl:"cache_dir,optional"`
+
+	// NoCache ignores CacheDir for this build without removing it from the
+	// configuration.
+	NoCache bool `hcl:"no_cache,optional"`
+
+	// TempDir is the directory the assets are extracted into, and other
+	// temporary files created, instead of the system temporary directory,
+	// e.g. a larger volume on runners with a small tmpfs.
+	TempDir string `hcl:"temp_dir,optional"`
+
+	// KeepContainer leaves the container the assets were copied from in
+	// place, running /bin/sh when the image has it, so its filesystem can
+	// be inspected. It has to be removed manually.
+	KeepContainer bool `hcl:"keep_container,optional"`
+
+	// PostExtract is a command, e.g. ["npx", "sitemap"], run on the host in
+	// the directory holding the extracted assets before they are deployed.
+	PostExtract []string `hcl:"post_extract,optional"`
+
+	// AssetManifest is the path, relative to the extracted assets, of a JSON
+	// object mapping asset names to their fingerprinted names. References
+	// to the names in HTML and CSS files are rewritten before PostExtract.
+	AssetManifest string `hcl:"asset_manifest,optional"`
+
+	// PostExtractTimeout bounds how long PostExtract may run, defaults to
+	// 5 minutes.
+	PostExtractTimeout string `hcl:"post_extract_timeout,optional"`
+
+	// BuildMemory limits the memory of the build containers in bytes
+	BuildMemory int64 `hcl:"build_memory,optional"`
+
+	// BuildCPUQuota limits the CPU time of the build containers in
+	// microseconds per 100ms period, e.g. 50000 for half a CPU
+	BuildCPUQuota int64 `hcl:"build_cpu_quota,optional"`
+
+	// BuildCPUSetCPUs pins the build containers to the given CPUs, e.g. "0-1"
+	BuildCPUSetCPUs string `hcl:"build_cpuset_cpus,optional"`
+
+	// ShmSize is the size of /dev/shm in the build containers in bytes,
+	// e.g. for headless browsers which exhaust the 64MB default.
+	ShmSize int64 `hcl:"shm_size,optional"`
+
+	// Ulimits override the resource limits of the build containers, e.g.
+	// "nofile" for builds opening many files.
+	Ulimits []Ulimit `hcl:"ulimit,block"`
+
+	// BuildArgs are passed to the Dockerfile's ARG instructions.
+	BuildArgs map[string]string `hcl:"build_args,optional"`
+
+	// InjectWaypointArgs adds the WAYPOINT_APP, WAYPOINT_PROJECT,
+	// WAYPOINT_WORKSPACE and WAYPOINT_BUILD_TIME build args. BuildArgs
+	// with the same names take precedence.
+	InjectWaypointArgs bool `hcl:"inject_waypoint_args,optional"`
+
+	// BuildSecrets are BuildKit secrets available to RUN
+	// --mount=type=secret,id=<name> instructions without being stored in
+	// the image. Values starting with "file:" are read from that path.
+	BuildSecrets map[string]string `hcl:"build_secrets,optional"`
+
+	// CacheVolumes maps BuildKit cache ids to paths in the build container,
+	// e.g. {"npm" = "/root/.npm"}, mounted into every RUN instruction with
+	// --mount=type=cache so their contents persist between builds. The
+	// classic builder can't mount volumes into a build, so BuildKit is used.
+	CacheVolumes map[string]string `hcl:"cache_volumes,optional"`
+
+	// Image is a prebuilt image, e.g. "registry.example.com/site:1.2", to
+	// pull and extract the assets from instead of building the Dockerfile.
+	Image string `hcl:"image,optional"`
+
+	// ImageAuth holds the credentials used to pull Image from a private
+	// registry.
+	ImageAuth *ImageAuth `hcl:"image_auth,block"`
+
+	// GitURL is a repository cloned to use as the build context instead of
+	// the project source, e.g. "https://github.com/org/site.git".
+	GitURL string `hcl:"git_url,optional"`
+
+	// GitRef is the branch, tag or commit of GitURL to build, defaults to
+	// the repository's default branch.
+	GitRef string `hcl:"git_ref,optional"`
+
+	// GitDepth makes a shallow clone of GitURL with only that many commits.
+	GitDepth int `hcl:"git_depth,optional"`
+
+	// GitAuth holds the credentials used to clone GitURL.
+	GitAuth *GitAuth `hcl:"git_auth,block"`
+
+	// StoreBuildLog writes the image build or pull log to a file passed on
+	// with the artifact, which a registry with a bucket stores next to it.
+	StoreBuildLog bool `hcl:"store_build_log,optional"`
+}
+
+// Ulimit is a resource limit of the build containers.
+type Ulimit struct {
+	// Name is the resource, e.g. "nofile" or "nproc"
+	Name string `hcl:"name,label"`
+	Soft int64  `hcl:"soft"`
+	Hard int64  `hcl:"hard"`
 }
 
+// ImageAuth is the registry login used to pull a prebuilt image.
+type ImageAuth struct {
+	Username string `hcl:"username,optional"`
+	Password string `hcl:"password,optional"`
+
+	// IdentityToken is used instead of Username and Password by registries
+	// issuing OAuth tokens.
+	IdentityToken string `hcl:"identity_token,optional"`
+}
+
+// Validate checks that either a username and password or an identity token
+// is set.
+func (a *ImageAuth) Validate() error {
+	if a.IdentityToken == "" && (a.Username == "" || a.Password == "") {
+		return errors.New("requires username and password, or identity_token")
+	}
+
+	return nil
+}
+
+// checkTempDir ensures dir is a directory temporary files can be created
+// in.
+func checkTempDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("must be an existing directory: %s", err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	f, err := os.CreateTemp(dir, ".waypoint-plugin-s3-*")
+	if err != nil {
+		return fmt.Errorf("must be writable: %s", err)
+	}
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// cpuSetPattern matches a list of CPUs such as "0-3,5".
+var cpuSetPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
 type Builder struct {
 	config BuildConfig
 }
@@ -33,13 +189,116 @@ func (b *Builder) Config() (interface{}, error) {
 
 // Implement ConfigurableNotify
 func (b *Builder) ConfigSet(config interface{}) error {
-	_, ok := config.(*BuildConfig)
+	c, ok := config.(*BuildConfig)
 	if !ok {
 		// The Waypoint SDK should ensure this never gets hit
 		return fmt.Errorf("expected *BuildConfig as parameter")
 	}
 
-	return nil
+	// validate the config
+	v := validate.New("build")
+
+	if c.PostExtractTimeout != "" {
+		d, err := time.ParseDuration(c.PostExtractTimeout)
+		if err != nil || d <= 0 {
+			v.Add("post_extract_timeout", "must be a positive duration such as \"10m\"")
+		}
+	}
+
+	if c.TempDir != "" {
+		v.AddError("temp_dir", checkTempDir(c.TempDir))
+	}
+
+	if c.AssetManifest != "" {
+		clean := path.Clean(c.AssetManifest)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			v.Add("asset_manifest", "must be a path relative to the extracted assets")
+		}
+	}
+
+	if c.BuildMemory < 0 {
+		v.Add("build_memory", "must not be negative")
+	}
+
+	if c.BuildCPUQuota < 0 {
+		v.Add("build_cpu_quota", "must not be negative")
+	}
+
+	if c.BuildCPUSetCPUs != "" && !cpuSetPattern.MatchString(c.BuildCPUSetCPUs) {
+		v.Add("build_cpuset_cpus", "must be a list of CPUs such as \"0-3,5\"")
+	}
+
+	if c.ShmSize < 0 {
+		v.Add("shm_size", "must not be negative")
+	}
+
+	v.AddError("ulimit", validateUlimits(c.Ulimits))
+
+	if len(c.BuildSecrets) > 0 && c.hasBuildLimits() {
+		v.Add("build_secrets", "can't be combined with build resource limits, which BuildKit doesn't support")
+	}
+
+	if len(c.CacheVolumes) > 0 {
+		if c.hasBuildLimits() {
+			v.Add("cache_volumes", "can't be combined with build resource limits, which BuildKit doesn't support")
+		}
+
+		v.AddError("cache_volumes", validateCacheVolumes(c.CacheVolumes))
+	}
+
+	for name := range c.BuildSecrets {
+		if name == "" || strings.ContainsAny(name, " \t\n") {
+			v.Add("build_secrets", "%q is not a valid secret id", name)
+		}
+	}
+
+	if c.Image != "" {
+		if c.Dockerfile != "" {
+			v.Add("image", "can't be combined with dockerfile")
+		}
+
+		if len(c.BuildSecrets) > 0 {
+			v.Add("image", "can't be combined with build_secrets as no image is built")
+		}
+
+		if len(c.CacheVolumes) > 0 {
+			v.Add("image", "can't be combined with cache_volumes as no image is built")
+		}
+
+		if len(c.BuildArgs) > 0 || c.InjectWaypointArgs {
+			v.Add("image", "can't be combined with build_args or inject_waypoint_args as no image is built")
+		}
+
+		if c.hasBuildLimits() {
+			v.Add("image", "can't be combined with build resource limits as no image is built")
+		}
+	}
+
+	if c.GitURL != "" && c.Image != "" {
+		v.Add("git_url", "can't be combined with image")
+	}
+
+	if c.GitURL == "" && (c.GitRef != "" || c.GitDepth != 0 || c.GitAuth != nil) {
+		v.Add("git_url", "must be set to use git_ref, git_depth or git_auth")
+	}
+
+	if c.GitDepth < 0 {
+		v.Add("git_depth", "must not be negative")
+	}
+
+	if c.GitAuth != nil {
+		v.AddError("git_auth", c.GitAuth.Validate())
+	}
+
+	if c.ImageAuth != nil {
+		if c.Image == "" {
+			v.Add("image_auth", "requires image to be set")
+		}
+
+		v.AddError("image_auth", c.ImageAuth.Validate())
+	}
+
+	return v.Err()
 }
 
 // Implement Builder
@@ -68,7 +327,7 @@ func (b *Builder) BuildFunc() interface{} {
 // as an input parameter.
 // If an error is returned, Waypoint stops the execution flow and
 // returns an error to the user.
-func (b *Builder) build(ctx context.Context, src *component.Source, ui terminal.UI) (*Zip, error) {
+func (b *Builder) build(ctx context.Context, src *component.Source, job *component.JobInfo, ui terminal.UI) (*Zip, error) {
 	sg := ui.StepGroup()
 	defer sg.Wait()
 	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
@@ -76,6 +335,146 @@ func (b *Builder) build(ctx context.Context, src *component.Source, ui terminal.
 		return nil, status.Errorf(codes.FailedPrecondition, "unable to create Docker client: %s", err)
 	}
 
+	contextDir := src.Path
+	if b.config.GitURL != "" {
+		step := sg.Add("Cloning %s...", b.config.GitURL)
+		defer step.Abort()
+
+		contextDir, err = b.cloneSource(ctx, step.TermOutput())
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(contextDir)
+
+		step.Done()
+	}
+
+	// The log is kept out of the assets so it is never deployed. It is
+	// removed unless it is passed on with the artifact.
+	var (
+		buildLog     *os.File
+		keepBuildLog bool
+	)
+	if b.config.StoreBuildLog {
+		buildLog, err = os.CreateTemp(b.config.TempDir, "waypoint-plugin-s3-*.log")
+		if err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "unable to create build log: %s", err)
+		}
+		defer func() {
+			buildLog.Close()
+			if !keepBuildLog {
+				os.Remove(buildLog.Name())
+			}
+		}()
+	}
+
+	var imageTag string
+	if b.config.Image != "" {
+		imageTag, err = b.pullImage(ctx, sg, ui, dockerClient, buildLog)
+	} else {
+		imageTag, err = b.buildImage(ctx, sg, ui, dockerClient, contextDir, src, job, buildLog)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var step terminal.Step
+	var cacheKey, destDir string
+	// Cached assets don't need a container, so there would be none to keep
+	if b.config.CacheDir != "" && !b.config.NoCache && !b.config.KeepContainer {
+		image, _, err := dockerClient.ImageInspectWithRaw(ctx, imageTag)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to inspect image: %s", err)
+		}
+
+		cacheKey = b.cacheKey(image.ID)
+
+		if cached, ok := b.cachedAssets(cacheKey); ok {
+			step = sg.Add("Using cached assets for image %s...", image.ID)
+			defer step.Abort()
+
+			// Copy the cache entry so later steps can't modify it
+			destDir, err = os.MkdirTemp(b.config.TempDir, "waypoint-plugin-s3")
+			if err != nil {
+				return nil, status.Errorf(codes.FailedPrecondition, "unable to create tmp directory: %s", err)
+			}
+
+			if err := copyDir(cached, destDir); err != nil {
+				return nil, status.Errorf(codes.Internal, "unable to copy cached assets: %s", err)
+			}
+
+			step.Done()
+		}
+	}
+
+	if destDir == "" {
+		destDir, err = b.extract(ctx, sg, dockerClient, imageTag)
+		if err != nil {
+			return nil, err
+		}
+
+		if cacheKey != "" {
+			step = sg.Add("Caching assets...")
+			defer step.Abort()
+
+			if err := b.storeAssets(cacheKey, destDir); err != nil {
+				// The cache is only an optimization, so carry on without it
+				step.Update("Unable to cache assets: %s", err)
+				step.Status(terminal.StatusWarn)
+			}
+
+			step.Done()
+		}
+	}
+
+	// The rewrite and the hook run after caching so the cache always holds
+	// the assets as they were in the image.
+	if b.config.AssetManifest != "" {
+		step = sg.Add("Rewriting asset references...")
+		defer step.Abort()
+
+		n, err := b.rewriteAssets(destDir)
+		if err != nil {
+			return nil, err
+		}
+
+		step.Update("Rewrote asset references in %d files", n)
+		step.Done()
+	}
+
+	if len(b.config.PostExtract) > 0 {
+		step = sg.Add("Running post-extract hook...")
+		defer step.Abort()
+
+		if err := b.runPostExtract(ctx, destDir, step.TermOutput()); err != nil {
+			return nil, err
+		}
+
+		step.Done()
+	}
+
+	// step = sg.Add("Zipping assets...")
+	// defer step.Abort()
+
+	// // TODO zip files
+
+	// step.Done()
+
+	result := &Zip{
+		Path: destDir,
+	}
+
+	if buildLog != nil {
+		result.BuildLog = buildLog.Name()
+		keepBuildLog = true
+	}
+
+	return result, nil
+}
+
+// buildImage builds the Dockerfile in contextDir and returns the tag of the
+// resulting image. The build log is also written to buildLog, if set.
+func (b *Builder) buildImage(ctx context.Context, sg terminal.StepGroup, ui terminal.UI, dockerClient *client.Client, contextDir string, src *component.Source, job *component.JobInfo, buildLog *os.File) (string, error) {
 	dockerfile := b.config.Dockerfile
 
 	if dockerfile == "" {
@@ -86,53 +485,195 @@ func (b *Builder) build(ctx context.Context, src *component.Source, ui terminal.
 	step := sg.Add("Building image...")
 	defer step.Abort()
 
-	stdout, _, err := ui.OutputWriters()
-	if err != nil {
-		return nil, err
-	}
-
 	imageTag := fmt.Sprintf("waypoint.local/%s", src.App)
 
 	opts := types.ImageBuildOptions{
 		Dockerfile: dockerfile,
 		Tags:       []string{imageTag},
 		Remove:     true,
+		Memory:     b.config.BuildMemory,
+		CPUQuota:   b.config.BuildCPUQuota,
+		CPUSetCPUs: b.config.BuildCPUSetCPUs,
+		ShmSize:    b.config.ShmSize,
+		Ulimits:    b.ulimits(),
+		BuildArgs:  b.buildArgs(src, job),
+	}
+
+	// Secrets and cache mounts are only supported by BuildKit, so it is only
+	// used when either is set to keep the classic builder's output otherwise
+	if len(b.config.BuildSecrets) > 0 || len(b.config.CacheVolumes) > 0 {
+		var secrets map[string][]byte
+		if len(b.config.BuildSecrets) > 0 {
+			var err error
+			secrets, err = b.loadSecrets()
+			if err != nil {
+				return "", status.Errorf(codes.FailedPrecondition, "%s", err)
+			}
+		}
+
+		s, err := buildKitSession(ctx, dockerClient, secrets)
+		if err != nil {
+			return "", status.Errorf(codes.Internal, "unable to start BuildKit session: %s", err)
+		}
+		defer s.Close()
+
+		opts.Version = types.BuilderBuildKit
+		opts.SessionID = s.ID()
 	}
 
-	buildCtx, err := archive.TarWithOptions(src.Path, &archive.TarOptions{})
+	buildCtx, err := archive.TarWithOptions(contextDir, &archive.TarOptions{})
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+
+	if len(b.config.CacheVolumes) > 0 {
+		buildCtx, err = b.withCacheMounts(buildCtx, contextDir, dockerfile)
+		if err != nil {
+			return "", status.Errorf(codes.FailedPrecondition, "unable to add cache_volumes to %s: %s", dockerfile, err)
+		}
 	}
 
 	resp, err := dockerClient.ImageBuild(ctx, buildCtx, opts)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	defer resp.Body.Close()
 
+	if err := displayJSONMessages(ui, resp.Body, step.TermOutput(), buildLog); err != nil {
+		return "", status.Errorf(codes.Internal, "unable to stream build logs to the terminal: %s", err)
+	}
+
+	step.Done()
+
+	return imageTag, nil
+}
+
+// buildArgs merges the configured build args with the Waypoint ones when
+// InjectWaypointArgs is set.
+func (b *Builder) buildArgs(src *component.Source, job *component.JobInfo) map[string]*string {
+	args := map[string]*string{}
+
+	if b.config.InjectWaypointArgs {
+		buildTime := time.Now().UTC().Format(time.RFC3339)
+
+		args["WAYPOINT_APP"] = &src.App
+		args["WAYPOINT_BUILD_TIME"] = &buildTime
+
+		if job != nil {
+			args["WAYPOINT_PROJECT"] = &job.Project
+			args["WAYPOINT_WORKSPACE"] = &job.Workspace
+		}
+	}
+
+	for k, v := range b.config.BuildArgs {
+		v := v
+		args[k] = &v
+	}
+
+	return args
+}
+
+// pullImage pulls the prebuilt b.config.Image and returns its reference.
+// The pull log is also written to buildLog, if set.
+func (b *Builder) pullImage(ctx context.Context, sg terminal.StepGroup, ui terminal.UI, dockerClient *client.Client, buildLog *os.File) (string, error) {
+	step := sg.Add("Pulling image %s...", b.config.Image)
+	defer step.Abort()
+
+	var opts types.ImagePullOptions
+	if b.config.ImageAuth != nil {
+		auth, err := json.Marshal(types.AuthConfig{
+			Username:      b.config.ImageAuth.Username,
+			Password:      b.config.ImageAuth.Password,
+			IdentityToken: b.config.ImageAuth.IdentityToken,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		opts.RegistryAuth = base64.URLEncoding.EncodeToString(auth)
+	}
+
+	resp, err := dockerClient.ImagePull(ctx, b.config.Image, opts)
+	if err != nil {
+		if errdefs.IsNotFound(err) || errdefs.IsUnauthorized(err) {
+			return "", status.Errorf(codes.InvalidArgument, "unable to pull image %q: %s", b.config.Image, err)
+		}
+
+		return "", status.Errorf(codes.FailedPrecondition, "unable to pull image %q: %s", b.config.Image, err)
+	}
+	defer resp.Close()
+
+	if err := displayJSONMessages(ui, resp, step.TermOutput(), buildLog); err != nil {
+		return "", status.Errorf(codes.Internal, "unable to pull image %q: %s", b.config.Image, err)
+	}
+
+	step.Done()
+
+	return b.config.Image, nil
+}
+
+// displayJSONMessages streams the progress messages of a Docker build or
+// pull to w, returning any error reported in the stream. When buildLog is
+// set the messages are also written to it as plain text.
+func displayJSONMessages(ui terminal.UI, in io.Reader, w io.Writer, buildLog *os.File) error {
+	stdout, _, err := ui.OutputWriters()
+	if err != nil {
+		return err
+	}
+
 	var termFd uintptr
 	if f, ok := stdout.(*os.File); ok {
 		termFd = f.Fd()
 	}
 
-	err = jsonmessage.DisplayJSONMessagesStream(resp.Body, step.TermOutput(), termFd, true, nil)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "unable to stream build logs to the terminal: %s", err)
+	if buildLog == nil {
+		return jsonmessage.DisplayJSONMessagesStream(in, w, termFd, true, nil)
 	}
 
-	step.Done()
+	// The terminal rendering redraws progress bars in place, so the log
+	// renders the same stream a second time without a terminal
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
 
+		// Errors in the stream are reported by the terminal rendering
+		_ = jsonmessage.DisplayJSONMessagesStream(pr, buildLog, 0, false, nil)
+		io.Copy(io.Discard, pr)
+	}()
+
+	err = jsonmessage.DisplayJSONMessagesStream(io.TeeReader(in, pw), w, termFd, true, nil)
+	pw.Close()
+	<-done
+
+	return err
+}
+
+// extract creates a container from the built image and copies the assets
+// out of it into a new temporary directory.
+func (b *Builder) extract(ctx context.Context, sg terminal.StepGroup, dockerClient *client.Client, imageTag string) (string, error) {
 	// Run container
-	step = sg.Add("Running container...")
+	step := sg.Add("Running container...")
 	defer step.Abort()
 
+	// A kept container is started with stdin open so the shell waits for
+	// input instead of exiting, and can be exec'd into.
 	containerResp, err := dockerClient.ContainerCreate(ctx, &container.Config{
-		Image: imageTag,
-		Cmd:   []string{"/bin/sh"},
-		Tty:   false,
+		Image:     imageTag,
+		Cmd:       []string{"/bin/sh"},
+		Tty:       false,
+		OpenStdin: b.config.KeepContainer,
 	}, nil, nil, nil, "")
 	if err != nil {
-		return nil, status.Errorf(codes.FailedPrecondition, "unable to create Docker container: %s", err)
+		return "", status.Errorf(codes.FailedPrecondition, "unable to create Docker container: %s", err)
+	}
+
+	// The container is kept or removed however the extraction ends, so a
+	// failed copy doesn't leak it
+	if b.config.KeepContainer {
+		defer b.keepContainer(ctx, sg, dockerClient, containerResp.ID)
+	} else {
+		defer b.removeContainer(ctx, sg, dockerClient, containerResp.ID)
 	}
 
 	step.Done()
@@ -141,9 +682,9 @@ func (b *Builder) build(ctx context.Context, src *component.Source, ui terminal.
 	step = sg.Add("Extracing assets...")
 	defer step.Abort()
 
-	content, stat, err := dockerClient.CopyFromContainer(ctx, containerResp.ID, b.config.Source)
+	content, stat, err := b.copyFromContainer(ctx, dockerClient, containerResp.ID)
 	if err != nil {
-		return nil, status.Errorf(codes.FailedPrecondition, "unable to copy assets from Docker container: %s", err)
+		return "", err
 	}
 	defer content.Close()
 
@@ -154,31 +695,91 @@ func (b *Builder) build(ctx context.Context, src *component.Source, ui terminal.
 		RebaseName: "", // TODO: Follow symbolic links
 	}
 
-	destDir, err := os.MkdirTemp("", "waypoint-plugin-s3")
+	destDir, err := os.MkdirTemp(b.config.TempDir, "waypoint-plugin-s3")
 	if err != nil {
-		return nil, status.Errorf(codes.FailedPrecondition, "unable to create tmp directory: %s", err)
+		return "", status.Errorf(codes.FailedPrecondition, "unable to create tmp directory: %s", err)
 	}
 
-	archive.CopyTo(content, srcInfo, destDir)
+	// A partial extraction must not be deployed or cached
+	if err := archive.CopyTo(content, srcInfo, destDir); err != nil {
+		os.RemoveAll(destDir)
+		return "", status.Errorf(codes.Internal, "unable to extract assets from Docker container: %s", err)
+	}
 
 	step.Done()
 
-	// Kill container
-	step = sg.Add("Shutting down container...")
+	return destDir, nil
+}
+
+// removeContainer removes the container the assets were copied from.
+func (b *Builder) removeContainer(ctx context.Context, sg terminal.StepGroup, dockerClient *client.Client, id string) {
+	step := sg.Add("Shutting down container...")
 	defer step.Abort()
 
-	dockerClient.ContainerRemove(ctx, containerResp.ID, types.ContainerRemoveOptions{Force: true})
+	dockerClient.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
 
 	step.Done()
+}
 
-	// step = sg.Add("Zipping assets...")
-	// defer step.Abort()
+// keepContainer starts the container the assets were copied from and
+// shows how to inspect and remove it. Images without /bin/sh can't be
+// started, but the stopped container can still be copied from.
+func (b *Builder) keepContainer(ctx context.Context, sg terminal.StepGroup, dockerClient *client.Client, id string) {
+	step := sg.Add("Keeping container %s...", id)
+	defer step.Abort()
 
-	// // TODO zip files
+	if err := dockerClient.ContainerStart(ctx, id, types.ContainerStartOptions{}); err != nil {
+		step.Update("Kept stopped container %s, it could not be started (%s). Inspect it with \"docker cp %s:%s .\" "+
+			"and remove it with \"docker rm %s\" when done", id, err, id, b.config.Source, id)
+	} else {
+		step.Update("Kept container %s running. Inspect it with \"docker exec -it %s /bin/sh\" "+
+			"and remove it with \"docker rm -f %s\" when done", id, id, id)
+	}
 
-	// step.Done()
+	step.Status(terminal.StatusWarn)
+	step.Done()
+}
 
-	return &Zip{
-		Path: destDir,
-	}, nil
+// copyAttempts is the number of times copying the assets out of the container
+// is attempted before giving up on a busy Docker daemon.
+const copyAttempts = 3
+
+// copyBackoff is the delay before the second copy attempt, doubled on each
+// attempt after it.
+var copyBackoff = time.Second
+
+// containerCopier is the part of the Docker client used by
+// copyFromContainer.
+type containerCopier interface {
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error)
+}
+
+// copyFromContainer copies b.config.Source out of the container, retrying
+// transient daemon errors with exponential backoff. A source path which does
+// not exist is reported straight away as it will never succeed.
+func (b *Builder) copyFromContainer(ctx context.Context, dockerClient containerCopier, containerID string) (io.ReadCloser, types.ContainerPathStat, error) {
+	backoff := copyBackoff
+
+	for attempt := 1; ; attempt++ {
+		content, stat, err := dockerClient.CopyFromContainer(ctx, containerID, b.config.Source)
+		if err == nil {
+			return content, stat, nil
+		}
+
+		if errdefs.IsNotFound(err) {
+			return nil, stat, status.Errorf(codes.InvalidArgument, "source %q does not exist in the Docker container", b.config.Source)
+		}
+
+		if attempt == copyAttempts {
+			return nil, stat, status.Errorf(codes.FailedPrecondition, "unable to copy assets from Docker container after %d attempts: %s", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, stat, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
 }
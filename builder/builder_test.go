@@ -0,0 +1,111 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeCopier returns errs in turn, then the content of path.
+type fakeCopier struct {
+	path string
+	errs []error
+
+	calls int
+}
+
+func (c *fakeCopier) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	c.calls++
+
+	if c.calls <= len(c.errs) {
+		return nil, types.ContainerPathStat{}, c.errs[c.calls-1]
+	}
+
+	if srcPath != c.path {
+		return nil, types.ContainerPathStat{}, errdefs.NotFound(errors.New("Could not find the file " + srcPath + " in container"))
+	}
+
+	return ioutil.NopCloser(strings.NewReader("tar")), types.ContainerPathStat{Name: "public"}, nil
+}
+
+func TestCopyFromContainer(t *testing.T) {
+	defer func(d time.Duration) { copyBackoff = d }(copyBackoff)
+	copyBackoff = time.Millisecond
+
+	busy := errors.New("Error response from daemon: i/o timeout")
+
+	cases := []struct {
+		name   string
+		source string
+		errs   []error
+		calls  int
+		code   codes.Code
+	}{
+		{
+			name:   "valid path",
+			source: "/app/public",
+			calls:  1,
+		},
+		{
+			name:   "missing path",
+			source: "/app/dist",
+			calls:  1,
+			code:   codes.InvalidArgument,
+		},
+		{
+			name:   "transient errors are retried",
+			source: "/app/public",
+			errs:   []error{busy, busy},
+			calls:  3,
+		},
+		{
+			name:   "transient errors until attempts run out",
+			source: "/app/public",
+			errs:   []error{busy, busy, busy},
+			calls:  copyAttempts,
+			code:   codes.FailedPrecondition,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &Builder{config: BuildConfig{Source: tc.source}}
+			c := &fakeCopier{path: "/app/public", errs: tc.errs}
+
+			content, stat, err := b.copyFromContainer(context.Background(), c, "container")
+
+			if c.calls != tc.calls {
+				t.Errorf("calls = %d, want %d", c.calls, tc.calls)
+			}
+
+			if tc.code != codes.OK {
+				if status.Code(err) != tc.code {
+					t.Fatalf("error = %v, want code %s", err, tc.code)
+				}
+
+				if tc.code == codes.InvalidArgument && !strings.Contains(err.Error(), tc.source) {
+					t.Errorf("error %q doesn't name the source %q", err, tc.source)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer content.Close()
+
+			if stat.Name != "public" {
+				t.Errorf("stat name = %q, want %q", stat.Name, "public")
+			}
+		})
+	}
+}
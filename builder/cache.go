@@ -0,0 +1,111 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// cacheKey identifies the extraction of b.config.Source from an image. The
+// same image can be extracted from with different sources, so both make up
+// the key.
+func (b *Builder) cacheKey(imageID string) string {
+	h := sha256.Sum256([]byte(imageID + "\x00" + b.config.Source))
+	return hex.EncodeToString(h[:])
+}
+
+// cachedAssets returns the cached extraction for key, if there is one.
+func (b *Builder) cachedAssets(key string) (string, bool) {
+	dir := filepath.Join(b.config.CacheDir, key)
+
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+
+	return dir, true
+}
+
+// storeAssets copies an extraction into the cache under key. The copy is
+// made in a temporary directory and renamed into place so a partially
+// written entry is never picked up by a later build.
+func (b *Builder) storeAssets(key, src string) error {
+	if err := os.MkdirAll(b.config.CacheDir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(b.config.CacheDir, ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if err := copyDir(src, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(b.config.CacheDir, key)); err != nil {
+		// Another build may have stored the same key in the meantime
+		os.RemoveAll(tmp)
+		if _, ok := b.cachedAssets(key); ok {
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// copyDir recursively copies the contents of src into the existing
+// directory dst.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,129 @@
+package builder
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/pkg/archive"
+)
+
+var (
+	// runInstruction matches the start of a RUN instruction
+	runInstruction = regexp.MustCompile(`(?i)^(\s*RUN)(\s)`)
+
+	// escapeDirective matches the escape parser directive of a Dockerfile
+	escapeDirective = regexp.MustCompile(`(?i)^#\s*escape\s*=\s*(\S)\s*$`)
+)
+
+// validateCacheVolumes checks the cache ids and container paths of
+// CacheVolumes.
+func validateCacheVolumes(volumes map[string]string) error {
+	var problems []string
+
+	ids := make([]string, 0, len(volumes))
+	for id := range volumes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		target := volumes[id]
+
+		switch {
+		case id == "" || strings.ContainsAny(id, ",= \t\n"):
+			problems = append(problems, fmt.Sprintf("%q is not a valid cache id", id))
+		case !path.IsAbs(target):
+			problems = append(problems, fmt.Sprintf("%s: %q must be an absolute path in the build container", id, target))
+		case strings.ContainsAny(target, ", \t\n"):
+			problems = append(problems, fmt.Sprintf("%s: %q must not contain commas or whitespace", id, target))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// cacheMountFlags returns the RUN flags mounting the BuildKit cache of
+// every entry of volumes, sorted by id.
+func cacheMountFlags(volumes map[string]string) string {
+	ids := make([]string, 0, len(volumes))
+	for id := range volumes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	flags := make([]string, len(ids))
+	for i, id := range ids {
+		flags[i] = fmt.Sprintf("--mount=type=cache,id=%s,target=%s", id, volumes[id])
+	}
+
+	return strings.Join(flags, " ")
+}
+
+// injectCacheMounts adds flags to every RUN instruction of a Dockerfile.
+// Lines continuing an instruction are left alone, including comments and
+// blank lines within it.
+func injectCacheMounts(dockerfile []byte, flags string) []byte {
+	lines := strings.Split(string(dockerfile), "\n")
+
+	escape := `\`
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+
+		if m := escapeDirective.FindStringSubmatch(line); m != nil {
+			escape = m[1]
+		}
+	}
+
+	continued := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if continued && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+
+		if !continued {
+			lines[i] = runInstruction.ReplaceAllString(line, "$1 "+flags+"$2")
+		}
+
+		continued = strings.HasSuffix(trimmed, escape) && !strings.HasPrefix(trimmed, "#")
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// withCacheMounts replaces the Dockerfile in the build context tar with a
+// copy mounting CacheVolumes into every RUN instruction, leaving the file
+// in contextDir untouched.
+func (b *Builder) withCacheMounts(buildCtx io.ReadCloser, contextDir, dockerfile string) (io.ReadCloser, error) {
+	data, err := os.ReadFile(filepath.Join(contextDir, filepath.FromSlash(dockerfile)))
+	if err != nil {
+		return nil, err
+	}
+
+	data = injectCacheMounts(data, cacheMountFlags(b.config.CacheVolumes))
+
+	name := path.Clean(filepath.ToSlash(dockerfile))
+
+	return archive.ReplaceFileTarWrapper(buildCtx, map[string]archive.TarModifierFunc{
+		name: func(_ string, header *tar.Header, _ io.Reader) (*tar.Header, []byte, error) {
+			if header == nil {
+				header = &tar.Header{Typeflag: tar.TypeReg, Mode: 0644}
+			}
+
+			return header, data, nil
+		},
+	}), nil
+}
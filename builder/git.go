@@ -0,0 +1,119 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GitAuth is the login used to clone GitURL.
+type GitAuth struct {
+	// Username and Password authenticate HTTPS clones. Password is usually
+	// an access token.
+	Username string `hcl:"username,optional"`
+	Password string `hcl:"password,optional"`
+
+	// SSHKeyFile is the private key used for SSH clones.
+	SSHKeyFile string `hcl:"ssh_key_file,optional"`
+}
+
+// Validate checks that either a username and password or an SSH key is set.
+func (a *GitAuth) Validate() error {
+	hasBasic := a.Username != "" || a.Password != ""
+
+	switch {
+	case hasBasic && a.SSHKeyFile != "":
+		return errors.New("username and password can't be combined with ssh_key_file")
+	case hasBasic && (a.Username == "" || a.Password == ""):
+		return errors.New("requires both username and password")
+	case !hasBasic && a.SSHKeyFile == "":
+		return errors.New("requires username and password, or ssh_key_file")
+	}
+
+	return nil
+}
+
+// cloneSource clones GitRef of GitURL into a new temporary directory and
+// returns it. The caller removes the directory. Any ref, including a commit
+// SHA, is fetched directly so only GitDepth commits are downloaded when it
+// is set.
+func (b *Builder) cloneSource(ctx context.Context, out io.Writer) (string, error) {
+	dir, err := os.MkdirTemp(b.config.TempDir, "waypoint-plugin-s3-git")
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "unable to create tmp directory: %s", err)
+	}
+
+	ref := b.config.GitRef
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	fetch := []string{"fetch", "--no-tags"}
+	if b.config.GitDepth > 0 {
+		fetch = append(fetch, "--depth", strconv.Itoa(b.config.GitDepth))
+	}
+	fetch = append(fetch, "origin", ref)
+
+	cmds := [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", b.config.GitURL},
+		fetch,
+		{"checkout", "--quiet", "--detach", "FETCH_HEAD"},
+	}
+
+	for _, args := range cmds {
+		if err := b.git(ctx, dir, out, args...); err != nil {
+			os.RemoveAll(dir)
+			return "", status.Errorf(codes.FailedPrecondition, "unable to clone %s at %s: %s", b.config.GitURL, ref, err)
+		}
+	}
+
+	return dir, nil
+}
+
+// git runs a git command in dir. Credentials are passed through the
+// environment so they don't show up in the process list.
+func (b *Builder) git(ctx context.Context, dir string, out io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = io.MultiWriter(out, &stderr)
+
+	// Never wait for a password on a terminal nobody is watching
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	if a := b.config.GitAuth; a != nil {
+		if a.SSHKeyFile != "" {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %q -o IdentitiesOnly=yes", a.SSHKeyFile))
+		} else {
+			basic := base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password))
+			cmd.Env = append(cmd.Env,
+				"GIT_CONFIG_COUNT=1",
+				"GIT_CONFIG_KEY_0=http.extraHeader",
+				"GIT_CONFIG_VALUE_0=Authorization: Basic "+basic,
+			)
+		}
+	}
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(msg)
+		}
+
+		return err
+	}
+
+	return nil
+}
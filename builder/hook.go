@@ -0,0 +1,43 @@
+package builder
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultPostExtractTimeout bounds the post-extract hook when no timeout is
+// configured.
+const defaultPostExtractTimeout = 5 * time.Minute
+
+// runPostExtract runs the post-extract hook in dir, streaming its output to
+// out. A non-zero exit fails the build.
+func (b *Builder) runPostExtract(ctx context.Context, dir string, out io.Writer) error {
+	timeout := defaultPostExtractTimeout
+	if b.config.PostExtractTimeout != "" {
+		// Validated in ConfigSet
+		timeout, _ = time.ParseDuration(b.config.PostExtractTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, b.config.PostExtract[0], b.config.PostExtract[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return status.Errorf(codes.DeadlineExceeded, "post-extract hook did not finish within %s", timeout)
+		}
+
+		return status.Errorf(codes.Aborted, "post-extract hook failed: %s", err)
+	}
+
+	return nil
+}
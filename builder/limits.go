@@ -0,0 +1,55 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	units "github.com/docker/go-units"
+)
+
+// hasBuildLimits reports whether any resource limit of the build
+// containers is set. BuildKit doesn't apply them.
+func (c BuildConfig) hasBuildLimits() bool {
+	return c.BuildMemory != 0 || c.BuildCPUQuota != 0 || c.BuildCPUSetCPUs != "" ||
+		c.ShmSize != 0 || len(c.Ulimits) > 0
+}
+
+// validateUlimits checks every ulimit names a resource Docker knows, once,
+// with non-negative limits and a soft limit no higher than the hard one.
+func validateUlimits(ulimits []Ulimit) error {
+	var problems []string
+	seen := map[string]bool{}
+
+	for _, u := range ulimits {
+		switch {
+		case seen[u.Name]:
+			problems = append(problems, fmt.Sprintf("%q is set more than once", u.Name))
+		case u.Soft < 0 || u.Hard < 0:
+			problems = append(problems, fmt.Sprintf("%s: limits must not be negative", u.Name))
+		case u.Soft > u.Hard:
+			problems = append(problems, fmt.Sprintf("%s: soft limit %d must not exceed hard limit %d", u.Name, u.Soft, u.Hard))
+		default:
+			if _, err := units.ParseUlimit(fmt.Sprintf("%s=%d:%d", u.Name, u.Soft, u.Hard)); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+
+		seen[u.Name] = true
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// ulimits returns the configured ulimits in the form of the Docker API.
+func (b *Builder) ulimits() []*units.Ulimit {
+	out := make([]*units.Ulimit, len(b.config.Ulimits))
+	for i, u := range b.config.Ulimits {
+		out[i] = &units.Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard}
+	}
+
+	return out
+}
@@ -0,0 +1,63 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+)
+
+// secretFilePrefix marks a BuildSecrets value as the path of a file holding
+// the secret rather than the secret itself.
+const secretFilePrefix = "file:"
+
+// loadSecrets resolves b.config.BuildSecrets to the secret values. Errors
+// only name the secret so values never end up in the output.
+func (b *Builder) loadSecrets() (map[string][]byte, error) {
+	secrets := make(map[string][]byte, len(b.config.BuildSecrets))
+
+	for name, value := range b.config.BuildSecrets {
+		if !strings.HasPrefix(value, secretFilePrefix) {
+			secrets[name] = []byte(value)
+			continue
+		}
+
+		data, err := os.ReadFile(strings.TrimPrefix(value, secretFilePrefix))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read build secret %q: %w", name, err)
+		}
+
+		secrets[name] = data
+	}
+
+	return secrets, nil
+}
+
+// buildKitSession starts a BuildKit session for the build over the Docker
+// daemon's /session endpoint, serving secrets when there are any. The
+// secrets are only exposed to RUN --mount=type=secret instructions and are
+// never stored in a layer. The session ends when ctx is cancelled or it is
+// closed.
+func buildKitSession(ctx context.Context, dockerClient *client.Client, secrets map[string][]byte) (*session.Session, error) {
+	s, err := session.NewSession(ctx, "waypoint-plugin-s3", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(secrets) > 0 {
+		s.Allow(secretsprovider.FromMap(secrets))
+	}
+
+	dialer := func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+		return dockerClient.DialHijack(ctx, "/session", proto, meta)
+	}
+
+	go s.Run(ctx, dialer)
+
+	return s, nil
+}
@@ -0,0 +1,48 @@
+package awsutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// legacyWebsiteRegions use a dash rather than a dot between "s3-website"
+// and the region in their website endpoints.
+var legacyWebsiteRegions = map[string]bool{
+	"us-east-1":      true,
+	"us-west-1":      true,
+	"us-west-2":      true,
+	"ap-southeast-1": true,
+	"ap-southeast-2": true,
+	"ap-northeast-1": true,
+	"eu-west-1":      true,
+	"sa-east-1":      true,
+	"us-gov-west-1":  true,
+}
+
+// DNSSuffix returns the DNS suffix of the partition region belongs to. It
+// is derived from the region prefix so regions newer than the SDK resolve
+// correctly.
+func DNSSuffix(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "amazonaws.com.cn"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "sc2s.sgov.gov"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "c2s.ic.gov"
+	default:
+		// Includes GovCloud, which shares the commercial suffix
+		return "amazonaws.com"
+	}
+}
+
+// WebsiteEndpoint returns the host name of the static website endpoint of
+// bucket in region.
+func WebsiteEndpoint(bucket, region string) string {
+	sep := "."
+	if legacyWebsiteRegions[region] {
+		sep = "-"
+	}
+
+	return fmt.Sprintf("%s.s3-website%s%s.%s", bucket, sep, region, DNSSuffix(region))
+}
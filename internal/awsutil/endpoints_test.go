@@ -0,0 +1,39 @@
+package awsutil
+
+import "testing"
+
+func TestWebsiteEndpoint(t *testing.T) {
+	cases := []struct {
+		region string
+		suffix string
+		want   string
+	}{
+		// Commercial regions with a dash, and with a dot
+		{"us-east-1", "amazonaws.com", "site.s3-website-us-east-1.amazonaws.com"},
+		{"eu-west-1", "amazonaws.com", "site.s3-website-eu-west-1.amazonaws.com"},
+		{"eu-central-1", "amazonaws.com", "site.s3-website.eu-central-1.amazonaws.com"},
+		{"ap-south-1", "amazonaws.com", "site.s3-website.ap-south-1.amazonaws.com"},
+
+		// GovCloud shares the commercial suffix
+		{"us-gov-west-1", "amazonaws.com", "site.s3-website-us-gov-west-1.amazonaws.com"},
+		{"us-gov-east-1", "amazonaws.com", "site.s3-website.us-gov-east-1.amazonaws.com"},
+
+		{"cn-north-1", "amazonaws.com.cn", "site.s3-website.cn-north-1.amazonaws.com.cn"},
+		{"cn-northwest-1", "amazonaws.com.cn", "site.s3-website.cn-northwest-1.amazonaws.com.cn"},
+
+		{"us-iso-east-1", "c2s.ic.gov", "site.s3-website.us-iso-east-1.c2s.ic.gov"},
+		{"us-isob-east-1", "sc2s.sgov.gov", "site.s3-website.us-isob-east-1.sc2s.sgov.gov"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.region, func(t *testing.T) {
+			if got := DNSSuffix(tc.region); got != tc.suffix {
+				t.Errorf("DNSSuffix(%q) = %q, want %q", tc.region, got, tc.suffix)
+			}
+
+			if got := WebsiteEndpoint("site", tc.region); got != tc.want {
+				t.Errorf("WebsiteEndpoint(%q) = %q, want %q", tc.region, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package awsutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/processcreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Describe returns the message of err along with the error code, HTTP status
+// and request IDs AWS returned for it, which are needed to open a support
+// case. Errors which did not come from an AWS response are returned as is.
+func Describe(err error) string {
+	if ExpiredSSO(err) {
+		return fmt.Sprintf("%s (the AWS SSO session has expired, run \"aws sso login\" and retry)", err)
+	}
+
+	rf := requestFailure(err)
+	if rf == nil {
+		return err.Error()
+	}
+
+	details := []string{
+		"code: " + rf.Code(),
+		fmt.Sprintf("status: %d", rf.StatusCode()),
+	}
+
+	if id := rf.RequestID(); id != "" {
+		details = append(details, "request id: "+id)
+	}
+
+	if s3rf, ok := rf.(s3.RequestFailure); ok && s3rf.HostID() != "" {
+		details = append(details, "host id: "+s3rf.HostID())
+	}
+
+	return fmt.Sprintf("%s (%s)", rf.Message(), strings.Join(details, ", "))
+}
+
+// Error returns a gRPC status error with the given code, prefixing the
+// description of the AWS error err with the formatted message.
+func Error(code codes.Code, err error, format string, args ...interface{}) error {
+	return status.Errorf(code, "%s: %s", fmt.Sprintf(format, args...), Describe(err))
+}
+
+// ExpiredSSO reports whether err was caused by an expired or revoked AWS
+// SSO session.
+func ExpiredSSO(err error) bool {
+	for err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return false
+		}
+
+		switch aerr.Code() {
+		case ssocreds.ErrCodeSSOProviderInvalidToken, sso.ErrCodeUnauthorizedException:
+			return true
+		}
+
+		err = aerr.OrigErr()
+	}
+
+	return false
+}
+
+// FailedProcess reports whether err was caused by the credential_process
+// of a profile failing or printing invalid credentials.
+func FailedProcess(err error) bool {
+	for err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return false
+		}
+
+		switch aerr.Code() {
+		case processcreds.ErrCodeProcessProviderExecution, processcreds.ErrCodeProcessProviderParse,
+			processcreds.ErrCodeProcessProviderVersion, processcreds.ErrCodeProcessProviderRequired:
+			return true
+		}
+
+		err = aerr.OrigErr()
+	}
+
+	return false
+}
+
+// requestFailure finds the AWS request failure in the chain of err, if any.
+func requestFailure(err error) awserr.RequestFailure {
+	for err != nil {
+		if rf, ok := err.(awserr.RequestFailure); ok {
+			return rf
+		}
+
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return nil
+		}
+
+		err = aerr.OrigErr()
+	}
+
+	return nil
+}
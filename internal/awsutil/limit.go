@@ -0,0 +1,60 @@
+package awsutil
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// limitedTransport bounds the number of requests in flight through it. A
+// request holds its slot until its response body is closed, as the
+// connection stays in use while the body is read.
+type limitedTransport struct {
+	base http.RoundTripper
+	sem  chan struct{}
+}
+
+func newLimitedTransport(base http.RoundTripper, n int) *limitedTransport {
+	return &limitedTransport{base: base, sem: make(chan struct{}, n)}
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case t.sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		<-t.sem
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-t.sem }}
+	return resp, nil
+}
+
+// releasingBody releases its request's slot once, when it is closed or
+// read to the end.
+type releasingBody struct {
+	io.ReadCloser
+
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
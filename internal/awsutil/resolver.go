@@ -0,0 +1,55 @@
+package awsutil
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// ValidateEndpoints checks a map of service IDs, such as "s3" or "sts", to
+// the endpoint URLs replacing the default ones.
+func ValidateEndpoints(m map[string]string) error {
+	services := make([]string, 0, len(m))
+	for s := range m {
+		services = append(services, s)
+	}
+	sort.Strings(services)
+
+	for _, s := range services {
+		if s == "" || s != strings.ToLower(s) {
+			return fmt.Errorf("service %q must be a lowercase service ID such as \"s3\"", s)
+		}
+
+		u, err := url.Parse(strings.ReplaceAll(m[s], "{region}", "region"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("endpoint of %q must be an http or https URL", s)
+		}
+	}
+
+	return nil
+}
+
+// endpointResolver resolves the services in Endpoints to their configured
+// URL, with "{region}" replaced by the region of the client, and every
+// other service to its default endpoint. Overridden endpoints keep the
+// default signing name and region.
+func (c SessionConfig) endpointResolver() endpoints.Resolver {
+	return endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		e, err := endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+
+		u, ok := c.Endpoints[service]
+		if !ok {
+			return e, err
+		}
+
+		if err != nil {
+			e = endpoints.ResolvedEndpoint{SigningRegion: region}
+		}
+
+		e.URL = strings.ReplaceAll(u, "{region}", region)
+		return e, nil
+	})
+}
@@ -0,0 +1,285 @@
+package awsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// tlsVersions maps the accepted values of MinTLSVersion to their
+// crypto/tls constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// SessionConfig holds the options of the AWS sessions created by the
+// plugin's components.
+type SessionConfig struct {
+	Region string
+
+	// Accelerate sends S3 requests to the Transfer Acceleration endpoint.
+	Accelerate bool
+
+	// MinTLSVersion is the lowest TLS version, e.g. "1.2", negotiated with
+	// AWS. The Go default is used when empty.
+	MinTLSVersion string
+
+	// SharedConfigFile and SharedCredentialsFile replace the default
+	// locations of the AWS config and credentials files.
+	SharedConfigFile      string
+	SharedCredentialsFile string
+
+	// Profile is the profile of the shared config files to use, instead of
+	// AWS_PROFILE or "default". SSO and credential_process profiles are
+	// supported.
+	Profile string
+
+	// Endpoints maps service IDs, such as "s3", to the URL used instead of
+	// the service's default endpoint, e.g. for VPC endpoints.
+	Endpoints map[string]string
+
+	// MaxConnections bounds the number of requests in flight across
+	// everything using the session. It is unbounded when zero.
+	MaxConnections int
+
+	// CABundle is the path of a PEM file with certificate authorities
+	// trusted in addition to the system ones, e.g. for an S3-compatible
+	// endpoint with a certificate from a corporate CA.
+	CABundle string
+
+	// InsecureSkipVerify disables verification of the certificates of the
+	// endpoints connected to.
+	InsecureSkipVerify bool
+}
+
+// InsecureSkipVerifyWarning is shown by the components whenever
+// InsecureSkipVerify is set.
+const InsecureSkipVerifyWarning = "insecure_skip_verify is set: TLS certificates are NOT verified " +
+	"and credentials and content can be intercepted, only use it for testing"
+
+// ValidateTLSVersion checks that v is an accepted MinTLSVersion.
+func ValidateTLSVersion(v string) error {
+	if _, ok := tlsVersions[v]; ok || v == "" {
+		return nil
+	}
+
+	known := make([]string, 0, len(tlsVersions))
+	for k := range tlsVersions {
+		known = append(known, k)
+	}
+	sort.Strings(known)
+
+	return fmt.Errorf("must be one of %s", strings.Join(known, ", "))
+}
+
+// ValidateFile checks that path, if set, is a readable file.
+func ValidateFile(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("must be a readable file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("must be a readable file: %w", err)
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("must be a file, %q is a directory", path)
+	}
+
+	return nil
+}
+
+// ValidateCABundle checks that path, if set, is a readable PEM file with at
+// least one certificate.
+func ValidateCABundle(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	if err := ValidateFile(path); err != nil {
+		return err
+	}
+
+	_, err := loadCABundle(path)
+	return err
+}
+
+// loadCABundle returns the system certificate pool with the certificates
+// of the PEM file at path added.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%q has no PEM encoded certificates", path)
+	}
+
+	return pool, nil
+}
+
+// tlsConfig returns the TLS configuration of the session's transport, or
+// nil when the defaults apply.
+func (c SessionConfig) tlsConfig() (*tls.Config, error) {
+	if c.MinTLSVersion == "" && c.CABundle == "" && !c.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+	if c.MinTLSVersion != "" {
+		version, ok := tlsVersions[c.MinTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q", c.MinTLSVersion)
+		}
+
+		cfg.MinVersion = version
+	}
+
+	if c.CABundle != "" {
+		pool, err := loadCABundle(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load CA bundle: %w", err)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// sharedConfigFiles returns the shared config files to load, or nil to use
+// the SDK's default behavior.
+func (c SessionConfig) sharedConfigFiles() []string {
+	if c.SharedConfigFile == "" && c.SharedCredentialsFile == "" {
+		return nil
+	}
+
+	credentials := c.SharedCredentialsFile
+	if credentials == "" {
+		credentials = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if credentials == "" {
+		credentials = defaults.SharedCredentialsFilename()
+	}
+
+	config := c.SharedConfigFile
+	if config == "" {
+		config = os.Getenv("AWS_CONFIG_FILE")
+	}
+	if config == "" {
+		config = defaults.SharedConfigFilename()
+	}
+
+	// The same order the SDK uses for the default files
+	return []string{credentials, config}
+}
+
+// Session creates an AWS session with the configured options.
+func (c SessionConfig) Session() (*session.Session, error) {
+	cfg := &aws.Config{
+		Region:          aws.String(c.Region),
+		S3UseAccelerate: aws.Bool(c.Accelerate),
+	}
+
+	if len(c.Endpoints) > 0 {
+		cfg.EndpointResolver = c.endpointResolver()
+	}
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil || c.MaxConnections > 0 {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+
+		var rt http.RoundTripper = transport
+		if c.MaxConnections > 0 {
+			// Keep the idle connections the limit allows for reuse
+			transport.MaxIdleConnsPerHost = c.MaxConnections
+			rt = newLimitedTransport(transport, c.MaxConnections)
+		}
+
+		cfg.HTTPClient = &http.Client{Transport: rt}
+	}
+
+	// The config file is always read, as SSO and credential_process
+	// profiles can only be defined there
+	opts := session.Options{
+		Config:            *cfg,
+		Profile:           c.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+		SharedConfigFiles: c.sharedConfigFiles(),
+	}
+
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the credentials of a profile right away, whether it is set
+	// explicitly or through the environment, so a broken or expired profile
+	// fails here with a clear error rather than on the first request
+	if profile := c.profile(); profile != "" {
+		if _, err := sess.Config.Credentials.Get(); err != nil {
+			return nil, profileError(profile, err)
+		}
+	}
+
+	return sess, nil
+}
+
+// profile returns the profile of the shared config files in effect:
+// Profile, or the one the SDK takes from AWS_PROFILE or
+// AWS_DEFAULT_PROFILE.
+func (c SessionConfig) profile() string {
+	if c.Profile != "" {
+		return c.Profile
+	}
+
+	if p := os.Getenv("AWS_PROFILE"); p != "" {
+		return p
+	}
+
+	return os.Getenv("AWS_DEFAULT_PROFILE")
+}
+
+// profileError describes why the credentials of profile could not be
+// resolved.
+func profileError(profile string, err error) error {
+	if ExpiredSSO(err) {
+		return fmt.Errorf("the AWS SSO session of profile %q has expired, run \"aws sso login --profile %s\" and retry: %w", profile, profile, err)
+	}
+
+	if FailedProcess(err) {
+		return fmt.Errorf("the credential_process of profile %q failed, check that it runs on its own: %w", profile, err)
+	}
+
+	return fmt.Errorf("unable to get credentials of profile %q: %w", profile, err)
+}
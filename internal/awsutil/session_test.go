@@ -0,0 +1,44 @@
+package awsutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionProfileErrors(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(config, []byte("[profile broken]\ncredential_process = false\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		profile string
+		env     map[string]string
+	}{
+		{name: "profile", profile: "broken"},
+		{name: "AWS_PROFILE", env: map[string]string{"AWS_PROFILE": "broken"}},
+		{name: "AWS_DEFAULT_PROFILE", env: map[string]string{"AWS_DEFAULT_PROFILE": "broken"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, k := range []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+				t.Setenv(k, tc.env[k])
+			}
+
+			c := SessionConfig{Region: "us-east-1", SharedConfigFile: config, Profile: tc.profile}
+			_, err := c.Session()
+			if err == nil {
+				t.Fatal("created a session for a profile whose credential_process fails")
+			}
+
+			if !strings.Contains(err.Error(), `credential_process of profile "broken" failed`) {
+				t.Errorf("error %q doesn't say the credential_process of the profile failed", err)
+			}
+		})
+	}
+}
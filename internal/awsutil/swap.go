@@ -0,0 +1,92 @@
+package awsutil
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// SwapRoutingRules returns the website routing rules which serve the
+// generation under the live prefix, which is under root, at the top level
+// of the bucket. Requests for keys outside root, which don't exist, are
+// redirected into live. Missing keys inside root are redirected to
+// fallback in live, which must exist, rather than being redirected again.
+// Both 403 and 404 are covered, as buckets which can't be listed publicly
+// return 403 for missing keys.
+func SwapRoutingRules(root, live, fallback string) []*s3.RoutingRule {
+	var rules []*s3.RoutingRule
+	for _, code := range []string{"404", "403"} {
+		rules = append(rules, &s3.RoutingRule{
+			Condition: &s3.Condition{
+				KeyPrefixEquals:             aws.String(root + "/"),
+				HttpErrorCodeReturnedEquals: aws.String(code),
+			},
+			Redirect: &s3.Redirect{
+				ReplaceKeyWith:   aws.String(live + "/" + fallback),
+				HttpRedirectCode: aws.String("302"),
+			},
+		})
+	}
+
+	for _, code := range []string{"404", "403"} {
+		rules = append(rules, &s3.RoutingRule{
+			Condition: &s3.Condition{
+				HttpErrorCodeReturnedEquals: aws.String(code),
+			},
+			Redirect: &s3.Redirect{
+				ReplaceKeyPrefixWith: aws.String(live + "/"),
+				HttpRedirectCode:     aws.String("302"),
+			},
+		})
+	}
+
+	return rules
+}
+
+// LivePrefix returns the live prefix of rules returned by
+// SwapRoutingRules, or "" when rules weren't.
+func LivePrefix(rules []*s3.RoutingRule) string {
+	for _, r := range rules {
+		if r.Condition == nil || r.Redirect == nil || aws.StringValue(r.Condition.KeyPrefixEquals) != "" {
+			continue
+		}
+
+		if p := aws.StringValue(r.Redirect.ReplaceKeyPrefixWith); p != "" {
+			return strings.TrimSuffix(p, "/")
+		}
+	}
+
+	return ""
+}
+
+// RetargetSwap points a website configuration using SwapRoutingRules at
+// the generation under to instead. It reports false when website doesn't
+// use them.
+func RetargetSwap(website *s3.WebsiteConfiguration, to string) bool {
+	live := LivePrefix(website.RoutingRules)
+	if live == "" {
+		return false
+	}
+
+	var root, fallback string
+	for _, r := range website.RoutingRules {
+		if r.Condition != nil && r.Redirect != nil && aws.StringValue(r.Condition.KeyPrefixEquals) != "" {
+			root = strings.TrimSuffix(aws.StringValue(r.Condition.KeyPrefixEquals), "/")
+			fallback = strings.TrimPrefix(aws.StringValue(r.Redirect.ReplaceKeyWith), live+"/")
+			break
+		}
+	}
+
+	if root == "" {
+		return false
+	}
+
+	website.RoutingRules = SwapRoutingRules(root, to, fallback)
+	if website.ErrorDocument != nil {
+		key := strings.TrimPrefix(aws.StringValue(website.ErrorDocument.Key), live+"/")
+		website.ErrorDocument.Key = aws.String(to + "/" + key)
+	}
+
+	return true
+}
@@ -0,0 +1,105 @@
+package awsutil
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// MaxTags is the number of tags a single S3 object can carry. It is the
+// strictest limit of the resources ResourceTags fan out to, so it is applied
+// to every tag set.
+const MaxTags = 10
+
+// tagPattern matches the characters AWS allows in tag keys and values.
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+
+// ValidateTags checks tags against the AWS tagging constraints shared by S3
+// and CloudFront.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > MaxTags {
+		return fmt.Errorf("at most %d tags can be set, got %d", MaxTags, len(tags))
+	}
+
+	for k, v := range tags {
+		if n := utf8.RuneCountInString(k); n < 1 || n > 128 {
+			return fmt.Errorf("tag key %q must be between 1 and 128 characters", k)
+		}
+
+		if utf8.RuneCountInString(v) > 256 {
+			return fmt.Errorf("value of tag %q must be at most 256 characters", k)
+		}
+
+		if strings.HasPrefix(strings.ToLower(k), "aws:") {
+			return fmt.Errorf("tag key %q must not start with the reserved prefix \"aws:\"", k)
+		}
+
+		if !tagPattern.MatchString(k) {
+			return fmt.Errorf("tag key %q contains characters not allowed by AWS", k)
+		}
+
+		if !tagPattern.MatchString(v) {
+			return fmt.Errorf("value of tag %q contains characters not allowed by AWS", k)
+		}
+	}
+
+	return nil
+}
+
+// ObjectTagging encodes tags in the query string form expected by the
+// x-amz-tagging header on object uploads. It returns nil when there are no
+// tags so the header is omitted.
+func ObjectTagging(tags map[string]string) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	v := url.Values{}
+	for k, val := range tags {
+		v.Set(k, val)
+	}
+
+	return aws.String(v.Encode())
+}
+
+// S3Tags converts tags to the S3 API representation, sorted by key.
+func S3Tags(tags map[string]string) []*s3.Tag {
+	keys := sortedTagKeys(tags)
+
+	out := make([]*s3.Tag, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, &s3.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+
+	return out
+}
+
+// CloudFrontTags converts tags to the CloudFront API representation,
+// sorted by key.
+func CloudFrontTags(tags map[string]string) *cloudfront.Tags {
+	keys := sortedTagKeys(tags)
+
+	out := &cloudfront.Tags{Items: make([]*cloudfront.Tag, 0, len(keys))}
+	for _, k := range keys {
+		out.Items = append(out.Items, &cloudfront.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+
+	return out
+}
+
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
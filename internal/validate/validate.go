@@ -0,0 +1,60 @@
+// Package validate collects configuration problems so they can be reported
+// together instead of one at a time.
+package validate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Errors accumulates the problems found in a component's configuration.
+type Errors struct {
+	stanza   string
+	problems []string
+}
+
+// New returns an empty set of problems for the configuration of the given
+// stanza, e.g. "deploy".
+func New(stanza string) *Errors {
+	return &Errors{stanza: stanza}
+}
+
+// Add records a problem with field.
+func (e *Errors) Add(field, format string, args ...interface{}) {
+	e.problems = append(e.problems, fmt.Sprintf("%s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+// AddError records err as a problem with field if it is not nil.
+func (e *Errors) AddError(field string, err error) {
+	if err != nil {
+		e.Add(field, "%s", err)
+	}
+}
+
+// AddAll records every problem in other as a problem with field.
+func (e *Errors) AddAll(field string, other *Errors) {
+	for _, problem := range other.problems {
+		e.Add(field, "%s", problem)
+	}
+}
+
+// Problems returns the recorded problems, each prefixed with its field.
+func (e *Errors) Problems() []string {
+	return e.problems
+}
+
+// AddProblem records a problem returned by Problems as it is.
+func (e *Errors) AddProblem(problem string) {
+	e.problems = append(e.problems, problem)
+}
+
+// Err returns an error listing every recorded problem, or nil if there are
+// none.
+func (e *Errors) Err() error {
+	if len(e.problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("invalid %s configuration for the s3 plugin:\n  - %s",
+		e.stanza, strings.Join(e.problems, "\n  - "))
+}
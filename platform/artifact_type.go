@@ -0,0 +1,44 @@
+package platform
+
+import (
+	"path"
+	"strings"
+)
+
+// Kinds of artifact, which tune the checks of the deploy.
+const (
+	artifactTypeWebsite = "website"
+	artifactTypeAssets  = "assets"
+)
+
+var artifactTypes = []string{artifactTypeWebsite, artifactTypeAssets}
+
+func validArtifactType(s string) bool {
+	for _, known := range artifactTypes {
+		if s == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// artifactType returns ArtifactType, defaulting to a website.
+func (b *Platform) artifactType() string {
+	if b.config.ArtifactType != "" {
+		return b.config.ArtifactType
+	}
+
+	return artifactTypeWebsite
+}
+
+// hasHTML reports whether any of keys is an HTML file.
+func hasHTML(keys map[string]bool) bool {
+	for key := range keys {
+		if ext := strings.ToLower(path.Ext(key)); ext == ".html" || ext == ".htm" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,272 @@
+package platform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// assetMetaFields are the fields of an entry of the asset meta file.
+var assetMetaFields = map[string]bool{
+	"cacheControl": true,
+	"contentType":  true,
+	"headers":      true,
+}
+
+// assetMetaEntry is the entry of a file in the asset meta file.
+type assetMetaEntry struct {
+	CacheControl string            `json:"cacheControl"`
+	ContentType  string            `json:"contentType"`
+	Headers      map[string]string `json:"headers"`
+}
+
+// assetMeta maps the keys described by the asset meta file to their
+// headers, by canonical header name.
+type assetMeta map[string]map[string]string
+
+// value returns header of key, if the asset meta file sets it.
+func (m assetMeta) value(key, header string) (string, bool) {
+	v, ok := m[key][header]
+	return v, ok
+}
+
+// metadata returns the user metadata the asset meta file sets for key.
+func (m assetMeta) metadata(key string) map[string]*string {
+	var out map[string]*string
+	for h, v := range m[key] {
+		if !strings.HasPrefix(h, metadataHeaderPrefix) {
+			continue
+		}
+
+		if out == nil {
+			out = map[string]*string{}
+		}
+		out[strings.ToLower(strings.TrimPrefix(h, metadataHeaderPrefix))] = aws.String(v)
+	}
+
+	return out
+}
+
+// loadAssetMeta reads AssetMetaFile from the artifact root, if set and
+// present. Like loadHeadersFile, it returns a warning for every header S3
+// can't serve.
+func (p *Platform) loadAssetMeta(root string) ([]string, error) {
+	p.assetMeta = nil
+
+	if p.config.AssetMetaFile == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(p.config.AssetMetaFile)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to read %s: %s", p.config.AssetMetaFile, err)
+	}
+	defer f.Close()
+
+	meta, warnings, err := parseAssetMeta(f)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s", p.config.AssetMetaFile, err)
+	}
+
+	p.assetMeta = meta
+
+	return warnings, nil
+}
+
+// parseAssetMeta parses an asset meta file, a JSON object mapping paths in
+// the artifact to their cacheControl, contentType and headers. Every
+// problem is reported, including unknown fields, prefixed with the path of
+// its entry.
+func parseAssetMeta(r io.Reader) (assetMeta, []string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil || raw == nil {
+		return nil, nil, fmt.Errorf("must be a JSON object mapping paths to their entries")
+	}
+
+	paths := make([]string, 0, len(raw))
+	for p := range raw {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var (
+		meta     = assetMeta{}
+		warnings []string
+		problems []string
+	)
+
+	for _, p := range paths {
+		entry, err := decodeAssetMetaEntry(raw[p])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", p, err))
+			continue
+		}
+
+		key, err := sanitizeKey(strings.TrimPrefix(p, "/"))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", p, err))
+			continue
+		}
+
+		if _, ok := meta[key]; ok {
+			problems = append(problems, fmt.Sprintf("%s: %s is described more than once", p, key))
+			continue
+		}
+
+		headers, warns, probs := assetMetaHeaders(entry)
+		for _, w := range warns {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", p, w))
+		}
+		for _, pr := range probs {
+			problems = append(problems, fmt.Sprintf("%s: %s", p, pr))
+		}
+
+		meta[key] = headers
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return meta, warnings, nil
+}
+
+// decodeAssetMetaEntry decodes an entry of the asset meta file, reporting
+// every unknown field.
+func decodeAssetMetaEntry(data json.RawMessage) (assetMetaEntry, error) {
+	var entry assetMetaEntry
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return entry, fmt.Errorf("must be an object")
+	}
+
+	var unknown []string
+	for name := range fields {
+		if !assetMetaFields[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return entry, fmt.Errorf("unknown fields %s, expected cacheControl, contentType or headers", strings.Join(unknown, ", "))
+	}
+
+	if v, ok := fields["cacheControl"]; ok && json.Unmarshal(v, &entry.CacheControl) != nil {
+		return entry, fmt.Errorf("cacheControl must be a string")
+	}
+
+	if v, ok := fields["contentType"]; ok && json.Unmarshal(v, &entry.ContentType) != nil {
+		return entry, fmt.Errorf("contentType must be a string")
+	}
+
+	if v, ok := fields["headers"]; ok && json.Unmarshal(v, &entry.Headers) != nil {
+		return entry, fmt.Errorf("headers must be an object of strings")
+	}
+
+	return entry, nil
+}
+
+// assetMetaHeaders validates the headers of entry, with cacheControl and
+// contentType folded in, following the rules of the headers file.
+func assetMetaHeaders(entry assetMetaEntry) (map[string]string, []string, []string) {
+	var (
+		headers  = map[string]string{}
+		warnings []string
+		problems []string
+	)
+
+	names := make([]string, 0, len(entry.Headers))
+	for name := range entry.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, h := range names {
+		name := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(h))
+		value := strings.TrimSpace(entry.Headers[h])
+
+		if _, ok := headers[name]; ok {
+			problems = append(problems, fmt.Sprintf("%s is set more than once", name))
+			continue
+		}
+
+		switch {
+		case name == "" || strings.ContainsAny(name, " \t:"):
+			problems = append(problems, fmt.Sprintf("%q is not a valid header name", h))
+		case value == "":
+			problems = append(problems, fmt.Sprintf("%s must not be empty", name))
+		case name == "Content-Language" && !validLanguage(value):
+			problems = append(problems, "Content-Language must be a language tag such as \"en\" or \"pt-BR\"")
+		case name == metadataHeaderPrefix:
+			problems = append(problems, fmt.Sprintf("%s must be followed by a metadata name", name))
+		case !headersFileHeaders[name] && !strings.HasPrefix(name, metadataHeaderPrefix):
+			warnings = append(warnings, fmt.Sprintf("S3 can't serve %s, it is ignored", name))
+		default:
+			headers[name] = value
+		}
+	}
+
+	fields := []struct {
+		name, header, value string
+	}{
+		{"cacheControl", "Cache-Control", entry.CacheControl},
+		{"contentType", "Content-Type", entry.ContentType},
+	}
+
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+
+		if _, ok := headers[f.header]; ok {
+			problems = append(problems, fmt.Sprintf("%s can't be combined with %s in headers", f.name, f.header))
+			continue
+		}
+
+		headers[f.header] = strings.TrimSpace(f.value)
+	}
+
+	return headers, warnings, problems
+}
+
+// objectMetadata returns the user metadata of key from the headers file
+// and the asset meta file, which wins.
+func (p *Platform) objectMetadata(key string) map[string]*string {
+	metadata := p.headers.metadata(key)
+
+	for k, v := range p.assetMeta.metadata(key) {
+		if metadata == nil {
+			metadata = map[string]*string{}
+		}
+		metadata[k] = v
+	}
+
+	return metadata
+}
+
+// missingAssets returns the paths the asset meta file describes which
+// aren't keys of the artifact, in order.
+func (p *Platform) missingAssets(keys map[string]bool) []string {
+	var missing []string
+	for key := range p.assetMeta {
+		if !keys[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
@@ -0,0 +1,198 @@
+package platform
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// openArtifactFile opens the files read by fileBody.
+var openArtifactFile = func(path string) (io.ReadSeekCloser, error) {
+	return os.Open(path)
+}
+
+// fileBody is the body of an upload read from a file of the artifact. The
+// file is only open while the body is being read and is closed again at its
+// end, so the bodies of an artifact hold neither its contents in memory nor
+// its files open. Seeking back re-opens it on the next read.
+type fileBody struct {
+	path string
+	size int64
+
+	f   io.ReadSeekCloser
+	off int64
+}
+
+// Size returns the length of the body.
+func (b *fileBody) Size() int64 {
+	return b.size
+}
+
+// Read implements io.Reader.
+func (b *fileBody) Read(p []byte) (int, error) {
+	if b.off >= b.size {
+		b.Close()
+		return 0, io.EOF
+	}
+
+	if b.f == nil {
+		f, err := openArtifactFile(b.path)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := f.Seek(b.off, io.SeekStart); err != nil {
+			f.Close()
+			return 0, err
+		}
+
+		b.f = f
+	}
+
+	if rest := b.size - b.off; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+
+	n, err := b.f.Read(p)
+	b.off += int64(n)
+
+	// The file changed since it was walked
+	if err == io.EOF && b.off < b.size {
+		err = fmt.Errorf("%s: %w", b.path, io.ErrUnexpectedEOF)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+
+	if b.off >= b.size || err != nil {
+		b.Close()
+	}
+
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (b *fileBody) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.off
+	case io.SeekEnd:
+		offset += b.size
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if offset != b.off {
+		b.Close()
+		b.off = offset
+	}
+
+	return offset, nil
+}
+
+// Close closes the file if it is open. The body can still be read again.
+func (b *fileBody) Close() error {
+	if b.f == nil {
+		return nil
+	}
+
+	err := b.f.Close()
+	b.f = nil
+
+	return err
+}
+
+// bodySize returns the length of body, if it is known up front.
+func bodySize(body io.Reader) (int64, bool) {
+	if s, ok := body.(interface{ Size() int64 }); ok {
+		return s.Size(), true
+	}
+
+	return 0, false
+}
+
+// sniffLen is the number of bytes content type detection looks at.
+const sniffLen = 512
+
+// bodyDigest is what building the upload of a body needs to know of its
+// contents, read in a single pass over it.
+type bodyDigest struct {
+	// head is the start of the body, for content type detection
+	head []byte
+
+	// md5 and checksum are the MD5 and ChecksumAlgorithm checksum of the
+	// body, set when it is uploaded in a single part and they are enabled
+	md5      []byte
+	checksum []byte
+}
+
+// digestBody reads body, which holds size bytes, into a bodyDigest and
+// rewinds it. Only the first bytes are kept, the rest is hashed as it is
+// read.
+func (b *Platform) digestBody(body io.ReadSeeker, size int64) (bodyDigest, error) {
+	var (
+		d       bodyDigest
+		hashes  []io.Writer
+		md5Hash hash.Hash
+		sumHash hash.Hash
+	)
+
+	// Multipart uploads can't carry the MD5 or checksum of the whole
+	// object, their parts are checksummed by the SDK instead
+	if size < s3manager.DefaultUploadPartSize {
+		if b.config.VerifyChecksum {
+			md5Hash = md5.New()
+			hashes = append(hashes, md5Hash)
+		}
+
+		if sumHash = checksumHash(b.config.ChecksumAlgorithm); sumHash != nil {
+			hashes = append(hashes, sumHash)
+		}
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return d, err
+	}
+	d.head = head[:n]
+
+	if len(hashes) > 0 {
+		w := io.MultiWriter(hashes...)
+		w.Write(d.head)
+
+		if _, err := io.Copy(w, body); err != nil {
+			return d, err
+		}
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return d, err
+	}
+
+	if md5Hash != nil {
+		d.md5 = md5Hash.Sum(nil)
+	}
+	if sumHash != nil {
+		d.checksum = sumHash.Sum(nil)
+	}
+
+	return d, nil
+}
+
+// hashBody writes body to h and rewinds it.
+func hashBody(body io.ReadSeeker, h io.Writer) error {
+	if _, err := io.Copy(h, body); err != nil {
+		return err
+	}
+
+	_, err := body.Seek(0, io.SeekStart)
+	return err
+}
@@ -0,0 +1,241 @@
+package platform
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// cacheControlImmutable is applied to fingerprinted assets, whose content
+	// never changes for a given name.
+	cacheControlImmutable = "public, max-age=31536000, immutable"
+
+	// cacheControlPrivate keeps shared caches such as CDNs from storing
+	// objects which must only be served to an authorized user.
+	cacheControlPrivate = "private, no-store"
+
+	// cacheControlNoCache makes browsers revalidate HTML on every request so
+	// new fingerprinted asset names are picked up straight away.
+	cacheControlNoCache = "no-cache"
+
+	// cacheControlNoStore keeps service workers and web app manifests out
+	// of every cache, as a stale one keeps a PWA on its old version.
+	cacheControlNoStore = "no-cache, no-store, must-revalidate"
+)
+
+// defaultServiceWorkerFiles are the well-known names of service workers,
+// including Angular's, and web app manifests.
+var defaultServiceWorkerFiles = []string{
+	"**/sw.js",
+	"**/service-worker.js",
+	"**/serviceworker.js",
+	"**/ngsw-worker.js",
+	"**/*.webmanifest",
+}
+
+// defaultHashPattern matches a "." or "-" separated segment of 8 or more
+// letters and digits, such as the 3f9a2b1c in app.3f9a2b1c.js.
+var defaultHashPattern = regexp.MustCompile(`[.-]([0-9A-Za-z]{8,})\.`)
+
+// isFingerprinted reports whether the file name of key contains a content
+// hash. The default pattern additionally requires the segment to contain a
+// digit so that names like app.component.js are not mistaken for hashes.
+func (p *Platform) isFingerprinted(key string) bool {
+	name := path.Base(key)
+
+	if p.hashPattern != nil {
+		return p.hashPattern.MatchString(name)
+	}
+
+	for _, m := range defaultHashPattern.FindAllStringSubmatch(name, -1) {
+		if strings.ContainsAny(m[1], "0123456789") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cacheControl returns the Cache-Control header for key, or nil when the
+// object should be uploaded without one.
+func (p *Platform) cacheControl(key, contentType string) *string {
+	v := p.baseCacheControl(key, contentType)
+	if v != nil && (isHTML(key, contentType) || isJSON(key, contentType)) {
+		v = p.withStaleDirectives(*v)
+	}
+
+	return v
+}
+
+// baseCacheControl returns the Cache-Control header set for key by the
+// configuration, before StaleWhileRevalidate and StaleIfError.
+func (p *Platform) baseCacheControl(key, contentType string) *string {
+	if p.privateGlobs.matches(key) {
+		v := cacheControlPrivate
+		return &v
+	}
+
+	if v, ok := p.headerOverride(key, "Cache-Control"); ok {
+		return &v
+	}
+
+	if v, ok := p.rules.value(key, func(r Rule) string { return r.CacheControl }); ok {
+		return &v
+	}
+
+	if v, ok := p.dirRuleValue(key, func(r DirRule) string { return r.CacheControl }); ok {
+		return &v
+	}
+
+	if p.serviceWorkerNoCache() && p.serviceWorkers.matches(key) {
+		v := cacheControlNoStore
+		return &v
+	}
+
+	if p.config.ImmutableHashedAssets {
+		if isHTML(key, contentType) {
+			v := cacheControlNoCache
+			return &v
+		}
+
+		if p.isFingerprinted(key) {
+			v := cacheControlImmutable
+			return &v
+		}
+	}
+
+	// The headers file only yields to the CacheControl of the deploy
+	// stanza, not the deploy file's
+	if p.cacheControlTemplate == nil {
+		if v, ok := p.headerDefault(key, "Cache-Control"); ok {
+			return &v
+		}
+	}
+
+	return p.defaultCacheControl(key)
+}
+
+func (p *Platform) serviceWorkerNoCache() bool {
+	return p.config.ServiceWorkerNoCache == nil || *p.config.ServiceWorkerNoCache
+}
+
+// cacheControlData are the variables available to the CacheControl
+// template.
+type cacheControlData struct {
+	// Key is the object's key
+	Key string
+
+	// DeploymentID and Sequence identify the Waypoint deployment
+	DeploymentID string
+	Sequence     uint64
+
+	App       string
+	Project   string
+	Workspace string
+}
+
+// parseCacheControl compiles a CacheControl template and checks it renders
+// with the variables cacheControlData provides.
+func parseCacheControl(text string) (*template.Template, error) {
+	tmpl, err := template.New("cache_control").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tmpl.Execute(&bytes.Buffer{}, cacheControlData{}); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// defaultCacheControl renders the CacheControl template, or else the deploy
+// file's cache_control, for key. It returns nil when neither is set.
+func (p *Platform) defaultCacheControl(key string) *string {
+	tmpl := p.cacheControlTemplate
+	if tmpl == nil {
+		tmpl = p.fileCacheControl
+	}
+	if tmpl == nil {
+		return nil
+	}
+
+	data := p.templateData
+	data.Key = key
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		// The template was checked against the same data type when parsed
+		return nil
+	}
+
+	return optionalString(strings.TrimSpace(buf.String()))
+}
+
+// isHTML reports whether the object is an HTML document.
+func isHTML(key, contentType string) bool {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".html", ".htm":
+		return true
+	}
+
+	return strings.HasPrefix(contentType, "text/html")
+}
+
+// isJSON reports whether the object is a JSON document, such as a
+// prerendered API response.
+func isJSON(key, contentType string) bool {
+	if strings.EqualFold(path.Ext(key), ".json") {
+		return true
+	}
+
+	return strings.HasPrefix(contentType, "application/json")
+}
+
+// validateStaleDuration checks a StaleWhileRevalidate or StaleIfError
+// value, which becomes a number of seconds.
+func validateStaleDuration(s string) error {
+	if s == "" {
+		return nil
+	}
+
+	if d, err := time.ParseDuration(s); err != nil || d < time.Second || d%time.Second != 0 {
+		return fmt.Errorf("must be a whole number of seconds such as \"30s\" or \"1h\"")
+	}
+
+	return nil
+}
+
+// withStaleDirectives appends the stale-while-revalidate and stale-if-error
+// directives to v. They extend a max-age or s-maxage, so they are left out
+// when v has neither, or forbids serving stale content with no-cache or
+// no-store. Directives already in v are kept as they are.
+func (p *Platform) withStaleDirectives(v string) *string {
+	directives := map[string]bool{}
+	for _, d := range strings.Split(v, ",") {
+		name := strings.ToLower(strings.TrimSpace(d))
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name = strings.TrimSpace(name[:i])
+		}
+		directives[name] = true
+	}
+
+	if !directives["max-age"] && !directives["s-maxage"] || directives["no-cache"] || directives["no-store"] {
+		return &v
+	}
+
+	add := func(name, duration string) {
+		if d, err := time.ParseDuration(duration); err == nil && !directives[name] {
+			v += fmt.Sprintf(", %s=%d", name, int64(d/time.Second))
+		}
+	}
+	add("stale-while-revalidate", p.config.StaleWhileRevalidate)
+	add("stale-if-error", p.config.StaleIfError)
+
+	return &v
+}
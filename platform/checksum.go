@@ -0,0 +1,83 @@
+package platform
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// validChecksumAlgorithm reports whether S3 supports the checksum
+// algorithm a.
+func validChecksumAlgorithm(a string) bool {
+	for _, known := range s3.ChecksumAlgorithm_Values() {
+		if a == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checksumHash returns a hash computing the algorithm checksum, or nil
+// when no algorithm is set.
+func checksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case s3.ChecksumAlgorithmCrc32:
+		return crc32.NewIEEE()
+	case s3.ChecksumAlgorithmCrc32c:
+		return crc32.New(castagnoli)
+	case s3.ChecksumAlgorithmSha1:
+		return sha1.New()
+	case s3.ChecksumAlgorithmSha256:
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
+// setChecksum adds sum, the algorithm checksum of the body of in computed
+// by checksumHash, replacing any previous one. The AWS SDK only sends the
+// algorithm, so the checksum itself has to be provided. Nothing is added
+// without a sum, e.g. for objects uploaded in parts as the SDK can't
+// checksum their parts.
+func setChecksum(in *s3manager.UploadInput, algorithm string, sum []byte) {
+	in.ChecksumAlgorithm = nil
+	in.ChecksumCRC32 = nil
+	in.ChecksumCRC32C = nil
+	in.ChecksumSHA1 = nil
+	in.ChecksumSHA256 = nil
+
+	if sum == nil {
+		return
+	}
+
+	encoded := aws.String(base64.StdEncoding.EncodeToString(sum))
+	switch algorithm {
+	case s3.ChecksumAlgorithmCrc32:
+		in.ChecksumCRC32 = encoded
+	case s3.ChecksumAlgorithmCrc32c:
+		in.ChecksumCRC32C = encoded
+	case s3.ChecksumAlgorithmSha1:
+		in.ChecksumSHA1 = encoded
+	case s3.ChecksumAlgorithmSha256:
+		in.ChecksumSHA256 = encoded
+	default:
+		return
+	}
+
+	in.ChecksumAlgorithm = aws.String(algorithm)
+}
+
+// checksumAlgorithms lists the supported algorithms for error messages.
+func checksumAlgorithms() string {
+	return strings.Join(s3.ChecksumAlgorithm_Values(), ", ")
+}
@@ -0,0 +1,222 @@
+package platform
+
+import (
+	"bufio"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// languageTag loosely matches a BCP 47 language tag such as "en" or "zh-Hant-TW".
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// validLanguage reports whether lang is a comma separated list of language
+// tags, as allowed by the Content-Language header.
+func validLanguage(lang string) bool {
+	for _, tag := range strings.Split(lang, ",") {
+		if !languageTag.MatchString(strings.TrimSpace(tag)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateContentTypes checks the keys of the content type map are file
+// extensions.
+func validateContentTypes(types map[string]string) error {
+	for ext, t := range types {
+		if !strings.HasPrefix(ext, ".") || strings.Contains(ext, "/") {
+			return fmt.Errorf("%q must be a file extension such as \".js\"", ext)
+		}
+
+		if t == "" {
+			return fmt.Errorf("content type of %q must not be empty", ext)
+		}
+	}
+
+	return nil
+}
+
+// detectContentType reports whether content types should be sniffed from
+// the file contents, which is the default.
+func (p *Platform) detectContentType() bool {
+	return p.config.DetectContentType == nil || *p.config.DetectContentType
+}
+
+// contentType resolves the Content-Type of key from the first of these
+// which has one, an empty result meaning the object is uploaded without a
+// Content-Type:
+//
+//  1. the asset meta file, then the headers file when it takes precedence
+//  2. rule blocks, then the content_type_overrides globs
+//  3. dir_rule blocks
+//  4. ContentTypes, by extension
+//  5. MimeTypesFile, by extension
+//  6. the headers file, when the deploy stanza takes precedence
+//  7. the deploy file's content types, by extension
+//  8. detection from the contents, or Go's type for the extension when
+//     DetectOnlyExtensions excludes it
+//  9. DefaultContentType
+//
+// Globs are tried in the order they are declared and extensions match
+// regardless of case.
+func (p *Platform) contentType(key string, data []byte) string {
+	if t, ok := p.headerOverride(key, "Content-Type"); ok {
+		return t
+	}
+
+	if t, ok := p.rules.value(key, func(r Rule) string { return r.ContentType }); ok {
+		return t
+	}
+
+	if t, ok := p.dirRuleValue(key, func(r DirRule) string { return r.ContentType }); ok {
+		return t
+	}
+
+	ext := strings.ToLower(path.Ext(key))
+	if t, ok := p.config.ContentTypes[ext]; ok {
+		return t
+	}
+
+	if t, ok := p.mimeTypes[ext]; ok {
+		return t
+	}
+
+	if t, ok := p.headerDefault(key, "Content-Type"); ok {
+		return t
+	}
+
+	if t, ok := p.file.ContentTypes[ext]; ok {
+		return t
+	}
+
+	if t := p.detectedContentType(ext, data); t != "" {
+		return t
+	}
+
+	return p.config.DefaultContentType
+}
+
+// detectedContentType sniffs the Content-Type of data, unless detection is
+// disabled or DetectOnlyExtensions excludes ext, in which case the type Go
+// associates with ext is used instead.
+func (p *Platform) detectedContentType(ext string, data []byte) string {
+	if !p.detectContentType() {
+		return ""
+	}
+
+	if !p.detectsExtension(ext) {
+		return mime.TypeByExtension(ext)
+	}
+
+	p.detections++
+	return http.DetectContentType(data)
+}
+
+// detectsExtension reports whether files with ext have their content type
+// detected under DetectOnlyExtensions. Every extension is detected when it
+// is empty.
+func (p *Platform) detectsExtension(ext string) bool {
+	if len(p.config.DetectOnlyExtensions) == 0 {
+		return true
+	}
+
+	for _, detected := range p.config.DetectOnlyExtensions {
+		if ext == strings.ToLower(detected) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lowerKeys returns a copy of m with lower cased keys, so extensions match
+// regardless of case.
+func lowerKeys(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[strings.ToLower(k)] = v
+	}
+
+	return out
+}
+
+// loadMimeTypes reads MimeTypesFile, if set, and returns the number of
+// extensions it maps. It is called at the start of every deploy so an
+// edited file is picked up without reconfiguring.
+func (p *Platform) loadMimeTypes() (int, error) {
+	p.mimeTypes = nil
+
+	if p.config.MimeTypesFile == "" {
+		return 0, nil
+	}
+
+	f, err := os.Open(p.config.MimeTypesFile)
+	if err != nil {
+		return 0, status.Errorf(codes.FailedPrecondition, "unable to read mime_types_file: %s", err)
+	}
+	defer f.Close()
+
+	types, err := parseMimeTypes(bufio.NewScanner(f))
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid mime_types_file %s: %s", p.config.MimeTypesFile, err)
+	}
+
+	p.mimeTypes = types
+
+	return len(types), nil
+}
+
+// parseMimeTypes parses the mime.types format shared by Apache and nginx,
+// a media type followed by its extensions on each line. The "types { }"
+// wrapper and trailing ";" of nginx are accepted. The first mapping of an
+// extension wins.
+func parseMimeTypes(sc *bufio.Scanner) (map[string]string, error) {
+	types := map[string]string{}
+
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), ";"))
+		if line == "" || line == "}" || (strings.HasPrefix(line, "types") && strings.HasSuffix(line, "{")) {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if !strings.Contains(fields[0], "/") {
+			return nil, fmt.Errorf("line %d: %q is not a media type", n, fields[0])
+		}
+
+		for _, ext := range fields[1:] {
+			ext = "." + strings.ToLower(strings.TrimPrefix(ext, "."))
+			if strings.Contains(ext, "/") {
+				return nil, fmt.Errorf("line %d: %q is not a file extension", n, ext)
+			}
+
+			if _, ok := types[ext]; !ok {
+				types[ext] = fields[0]
+			}
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return types, nil
+}
@@ -0,0 +1,177 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// configuredPlatform returns a Platform configured with c as the SDK
+// would, filling in the required options c leaves empty.
+func configuredPlatform(t *testing.T, c DeployConfig) *Platform {
+	t.Helper()
+
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.BucketName == "" {
+		c.BucketName = "bucket"
+	}
+
+	p := &Platform{}
+	if err := p.ConfigSet(&c); err != nil {
+		t.Fatalf("invalid config: %s", err)
+	}
+	p.config = c
+
+	return p
+}
+
+func TestContentType(t *testing.T) {
+	// html is detected as text/html, binary as application/octet-stream
+	html := []byte("<!DOCTYPE html><html><body>hello</body></html>")
+	binary := []byte{0x00, 0x01, 0x02, 0x03}
+
+	disabled := false
+
+	cases := []struct {
+		name      string
+		config    DeployConfig
+		mimeTypes string
+		key       string
+		data      []byte
+		want      string
+	}{
+		{
+			name: "glob override wins over the extension map",
+			config: DeployConfig{
+				ContentTypeOverrides: map[string]string{"/feeds/*.xml": "application/rss+xml"},
+				ContentTypes:         map[string]string{".xml": "text/xml"},
+			},
+			key:  "feeds/news.xml",
+			want: "application/rss+xml",
+		},
+		{
+			name: "extension map applies outside the glob",
+			config: DeployConfig{
+				ContentTypeOverrides: map[string]string{"/feeds/*.xml": "application/rss+xml"},
+				ContentTypes:         map[string]string{".xml": "text/xml"},
+			},
+			key:  "sitemap.xml",
+			want: "text/xml",
+		},
+		{
+			name: "glob overrides tie in lexical order",
+			config: DeployConfig{
+				ContentTypeOverrides: map[string]string{
+					"/feeds/*.xml": "application/rss+xml",
+					"/feeds/**":    "application/atom+xml",
+				},
+			},
+			key:  "feeds/news.xml",
+			want: "application/atom+xml",
+		},
+		{
+			name: "rule blocks win over glob overrides",
+			config: DeployConfig{
+				Rules:                []Rule{{Match: "/feeds/**", ContentType: "application/xml"}},
+				ContentTypeOverrides: map[string]string{"/feeds/*.xml": "application/rss+xml"},
+			},
+			key:  "feeds/news.xml",
+			want: "application/xml",
+		},
+		{
+			name: "rule blocks tie in declaration order",
+			config: DeployConfig{
+				Rules: []Rule{
+					{Match: "/feeds/*.xml", ContentType: "application/rss+xml"},
+					{Match: "/feeds/**", ContentType: "application/xml"},
+				},
+			},
+			key:  "feeds/news.xml",
+			want: "application/rss+xml",
+		},
+		{
+			name:      "extension map wins over the mime.types file",
+			config:    DeployConfig{ContentTypes: map[string]string{".webmanifest": "application/json"}},
+			mimeTypes: "application/manifest+json webmanifest\n",
+			key:       "site.webmanifest",
+			want:      "application/json",
+		},
+		{
+			name:   "extension map matches regardless of case",
+			config: DeployConfig{ContentTypes: map[string]string{".WASM": "application/wasm"}},
+			key:    "app.Wasm",
+			data:   binary,
+			want:   "application/wasm",
+		},
+		{
+			name:      "mime.types file wins over detection",
+			mimeTypes: "application/manifest+json webmanifest\n",
+			key:       "site.webmanifest",
+			data:      html,
+			want:      "application/manifest+json",
+		},
+		{
+			name:      "mime.types file ties on its first mapping",
+			mimeTypes: "types {\n  text/x-first  dat;\n  text/x-second dat;\n}\n",
+			key:       "values.dat",
+			want:      "text/x-first",
+		},
+		{
+			name: "detection from the contents",
+			key:  "page",
+			data: html,
+			want: "text/html; charset=utf-8",
+		},
+		{
+			name:   "detection wins over the default",
+			config: DeployConfig{DefaultContentType: "application/octet-stream"},
+			key:    "page",
+			data:   html,
+			want:   "text/html; charset=utf-8",
+		},
+		{
+			name:   "detect_only_extensions uses the extension's type for other files",
+			config: DeployConfig{DetectOnlyExtensions: []string{""}},
+			key:    "style.css",
+			data:   binary,
+			want:   "text/css; charset=utf-8",
+		},
+		{
+			name:   "default when detection is disabled",
+			config: DeployConfig{DetectContentType: &disabled, DefaultContentType: "application/octet-stream"},
+			key:    "page",
+			data:   html,
+			want:   "application/octet-stream",
+		},
+		{
+			name:   "no type when nothing gives one",
+			config: DeployConfig{DetectContentType: &disabled},
+			key:    "page",
+			data:   html,
+			want:   "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mimeTypes != "" {
+				path := filepath.Join(t.TempDir(), "mime.types")
+				if err := os.WriteFile(path, []byte(tc.mimeTypes), 0644); err != nil {
+					t.Fatal(err)
+				}
+				tc.config.MimeTypesFile = path
+			}
+
+			p := configuredPlatform(t, tc.config)
+			if _, err := p.loadMimeTypes(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := p.contentType(tc.key, tc.data); got != tc.want {
+				t.Errorf("contentType(%q) = %q, want %q", tc.key, got, tc.want)
+			}
+		})
+	}
+}
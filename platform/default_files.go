@@ -0,0 +1,61 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// defaultFilePrefix marks a DefaultFiles value as the path of a local file
+// rather than the content itself.
+const defaultFilePrefix = "file:"
+
+// validateDefaultFiles checks that each key is a valid object key.
+func validateDefaultFiles(files map[string]string) error {
+	for key := range files {
+		if _, err := sanitizeKey(strings.TrimPrefix(key, "/")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// defaultFileObjects returns the objects for the DefaultFiles which are
+// not in the artifact, adding their keys to keys.
+func (b *Platform) defaultFileObjects(keys map[string]bool) ([]s3manager.BatchUploadObject, error) {
+	names := make([]string, 0, len(b.config.DefaultFiles))
+	for key := range b.config.DefaultFiles {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	var objects []s3manager.BatchUploadObject
+	for _, name := range names {
+		key := strings.TrimPrefix(name, "/")
+		if keys[key] {
+			continue
+		}
+
+		value := b.config.DefaultFiles[name]
+		data := []byte(value)
+
+		if strings.HasPrefix(value, defaultFilePrefix) {
+			var err error
+			data, err = os.ReadFile(strings.TrimPrefix(value, defaultFilePrefix))
+			if err != nil {
+				return nil, fmt.Errorf("unable to read default file for %q: %w", key, err)
+			}
+		}
+
+		keys[key] = true
+		objects = append(objects, s3manager.BatchUploadObject{
+			Object: b.uploadInput(key, data),
+		})
+	}
+
+	return objects, nil
+}
@@ -3,27 +3,521 @@ package platform
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-s3/builder"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/validate"
 	"github.com/hashicorp/waypoint-plugin-s3/registry"
 	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/hashicorp/waypoint-plugin-sdk/framework/resource"
+	sdk "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
 	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type DeployConfig struct {
 	Region     string `hcl:"region,optional"`
 	BucketName string `hcl:"bucket_name,optional"`
+
+	// Accelerate uploads through the bucket's S3 Transfer Acceleration
+	// endpoint. The bucket must have acceleration enabled and a DNS-compliant
+	// name without periods.
+	Accelerate bool `hcl:"accelerate,optional"`
+
+	// MinTLSVersion is the lowest TLS version, e.g. "1.2", used to connect
+	// to AWS.
+	MinTLSVersion string `hcl:"min_tls_version,optional"`
+
+	// EndpointResolver maps AWS service IDs, such as "s3" and "sts", to the
+	// URL used instead of their default endpoint. "{region}" in a URL is
+	// replaced by the region. Other services resolve as usual.
+	EndpointResolver map[string]string `hcl:"endpoint_resolver,optional"`
+
+	// SharedConfigFile is the path of the AWS config file, replacing
+	// ~/.aws/config.
+	SharedConfigFile string `hcl:"shared_config_file,optional"`
+
+	// SharedCredentialsFile is the path of the AWS credentials file,
+	// replacing ~/.aws/credentials.
+	SharedCredentialsFile string `hcl:"shared_credentials_file,optional"`
+
+	// Profile is the AWS profile to use, e.g. an SSO or credential_process
+	// profile, instead of AWS_PROFILE or "default".
+	Profile string `hcl:"profile,optional"`
+
+	// CABundle is the path of a PEM file with certificate authorities
+	// trusted in addition to the system ones, e.g. for an on-premises
+	// S3-compatible endpoint.
+	CABundle string `hcl:"ca_bundle,optional"`
+
+	// InsecureSkipVerify disables TLS certificate verification. Only use it
+	// for testing.
+	InsecureSkipVerify bool `hcl:"insecure_skip_verify,optional"`
+
+	// ResourceTags are applied to every uploaded object.
+	ResourceTags map[string]string `hcl:"resource_tags,optional"`
+
+	// ImmutableHashedAssets caches fingerprinted assets for a year and makes
+	// HTML revalidate on every request.
+	ImmutableHashedAssets bool `hcl:"immutable_hashed_assets,optional"`
+
+	// StaleWhileRevalidate and StaleIfError are durations, e.g. "1m",
+	// added as the stale-while-revalidate and stale-if-error directives to
+	// the Cache-Control of HTML and JSON objects which have a max-age.
+	StaleWhileRevalidate string `hcl:"stale_while_revalidate,optional"`
+	StaleIfError         string `hcl:"stale_if_error,optional"`
+
+	// ServiceWorkerNoCache keeps service workers and web app manifests from
+	// being cached, so PWAs pick up updates. Defaults to true.
+	ServiceWorkerNoCache *bool `hcl:"service_worker_no_cache,optional"`
+
+	// ServiceWorkerFiles are globs of the files ServiceWorkerNoCache applies
+	// to, replacing the well-known service worker names and *.webmanifest.
+	ServiceWorkerFiles []string `hcl:"service_worker_files,optional"`
+
+	// CacheControl is the Cache-Control header of objects no other option
+	// sets one for. It is a Go template which can reference the deployment,
+	// e.g. "public, max-age=600, deployment={{.DeploymentID}}".
+	CacheControl string `hcl:"cache_control,optional"`
+
+	// HashPattern overrides the regular expression used to detect content
+	// hashes in file names.
+	HashPattern string `hcl:"hash_pattern,optional"`
+
+	// Redirects maps object keys to the path or URL they redirect to. They
+	// only take effect when the bucket is configured for website hosting.
+	Redirects map[string]string `hcl:"redirects,optional"`
+
+	// RootRedirect redirects requests for the root of the website to the
+	// given path or URL. The bucket must have website hosting enabled.
+	RootRedirect string `hcl:"root_redirect,optional"`
+
+	// StorageClass is the storage class of uploaded objects, defaults to
+	// the bucket's default (STANDARD).
+	StorageClass string `hcl:"storage_class,optional"`
+
+	// StorageClasses maps globs to a storage class for matching objects,
+	// overriding StorageClass. Rules supersede it.
+	StorageClasses map[string]string `hcl:"storage_classes,optional"`
+
+	// EnableWebsite turns on static website hosting for the bucket once the
+	// artifact has been uploaded and reports the website URL, e.g. for
+	// preview environments without a release.
+	EnableWebsite bool `hcl:"enable_website,optional"`
+
+	// Workspaces override options of the stanza in the Waypoint workspace
+	// they are named after.
+	Workspaces []Workspace `hcl:"workspace,block"`
+
+	// SourceBucket switches the deploy to mirroring: instead of uploading
+	// the artifact, the objects under SourcePrefix in SourceBucket are
+	// copied into the bucket server-side, keeping their content type and
+	// metadata. SourceRegion defaults to Region.
+	SourceBucket string `hcl:"source_bucket,optional"`
+	SourcePrefix string `hcl:"source_prefix,optional"`
+	SourceRegion string `hcl:"source_region,optional"`
+
+	// IndexDocument is the website's index document, defaults to
+	// "index.html".
+	IndexDocument string `hcl:"index_document,optional"`
+
+	// ErrorDocument is the object served for website errors, e.g. "404.html".
+	ErrorDocument string `hcl:"error_document,optional"`
+
+	// ArtifactType is "website", the default, or "assets". A website needs
+	// the index document at its root and is expected to contain HTML,
+	// while assets, e.g. downloads, skip those checks.
+	ArtifactType string `hcl:"artifact_type,optional"`
+
+	// AtomicSwap uploads each deploy under a new prefix in SwapPrefix, which
+	// defaults to "releases", then switches the website to it with a single
+	// configuration change, so visitors never see a mix of two deploys.
+	// Requires EnableWebsite.
+	AtomicSwap bool   `hcl:"atomic_swap,optional"`
+	SwapPrefix string `hcl:"swap_prefix,optional"`
+
+	// ManifestKey is the object recording the checksums of the last deploy.
+	// When set, only objects which changed since then are uploaded.
+	ManifestKey string `hcl:"manifest_key,optional"`
+
+	// LatestPointerKey is an object, e.g. "latest.json", updated at the end
+	// of every deploy to identify it and its manifest. Requires ManifestKey.
+	LatestPointerKey string `hcl:"latest_pointer_key,optional"`
+
+	// WriteDeploySummary writes a JSON summary of every successful deploy,
+	// with its counts and Git metadata, to DeploySummaryKey, which
+	// defaults to "_deploy/latest.json".
+	WriteDeploySummary bool   `hcl:"write_deploy_summary,optional"`
+	DeploySummaryKey   string `hcl:"deploy_summary_key,optional"`
+
+	// VerifyChecksum sends the MD5 of each file as read from the artifact,
+	// so S3 rejects an object corrupted before or during the upload.
+	VerifyChecksum bool `hcl:"verify_checksum,optional"`
+
+	// ChecksumAlgorithm is an additional checksum, "CRC32", "CRC32C", "SHA1"
+	// or "SHA256", sent with each object so S3 validates it and stores it
+	// with the object.
+	ChecksumAlgorithm string `hcl:"checksum_algorithm,optional"`
+
+	// GenerateSRIManifest writes the SHA-384 subresource integrity hash of
+	// every script and stylesheet to SRIManifestKey, which defaults to
+	// "sri-manifest.json".
+	GenerateSRIManifest bool   `hcl:"generate_sri_manifest,optional"`
+	SRIManifestKey      string `hcl:"sri_manifest_key,optional"`
+
+	// InjectSRI adds integrity attributes to the script and link tags of
+	// HTML files which reference a hashed file. Requires GenerateSRIManifest.
+	InjectSRI bool `hcl:"inject_sri,optional"`
+
+	// SkipUnchanged compares each object with the one in the bucket by ETag
+	// and skips uploading it when the content is the same.
+	SkipUnchanged bool `hcl:"skip_unchanged,optional"`
+
+	// SkipUnchangedStrategy is how existing ETags are looked up: "head"
+	// sends a request per object, "list" lists the bucket and "auto", the
+	// default, picks one based on the number of objects.
+	SkipUnchangedStrategy string `hcl:"skip_unchanged_strategy,optional"`
+
+	// SkipUnchangedConcurrency is the number of HEAD requests run in
+	// parallel, defaults to 8.
+	SkipUnchangedConcurrency int `hcl:"skip_unchanged_concurrency,optional"`
+
+	// PreserveMetadata copies each object whose content matches the one in
+	// the bucket onto itself instead of uploading it, keeping its headers,
+	// ACL and tags. Unlike SkipUnchanged the object is rewritten, so its
+	// Last-Modified date changes and versioned buckets get a new version.
+	PreserveMetadata bool `hcl:"preserve_metadata,optional"`
+
+	// CheckMixedContent scans the HTML files for resources referenced over
+	// plain HTTP, which browsers block when the site is served over HTTPS,
+	// and reports them. FailOnMixedContent fails the deploy before anything
+	// is uploaded instead.
+	CheckMixedContent  bool `hcl:"check_mixed_content,optional"`
+	FailOnMixedContent bool `hcl:"fail_on_mixed_content,optional"`
+
+	// CloudFrontDistributionID is a distribution serving the bucket whose
+	// cache is invalidated once the deploy is complete.
+	CloudFrontDistributionID string `hcl:"cloudfront_distribution_id,optional"`
+
+	// InvalidateChangedOnly limits the invalidation to the paths of the
+	// objects uploaded or pruned, instead of "/*". More than 3000 paths
+	// are invalidated with "/*" instead.
+	InvalidateChangedOnly bool `hcl:"invalidate_changed_only,optional"`
+
+	// GitMetadata stores the commit, branch and CI build number of the
+	// deploy as the git-sha, git-branch and build-number user metadata of
+	// every object, or only of GitMetadataKey when set.
+	GitMetadata    bool   `hcl:"git_metadata,optional"`
+	GitMetadataKey string `hcl:"git_metadata_key,optional"`
+
+	// AllowedExtensions, e.g. [".html", ".css", ".js"], restricts the
+	// published files to those extensions so files such as .env or .pem
+	// never reach a public bucket. Other files are skipped.
+	AllowedExtensions []string `hcl:"allowed_extensions,optional"`
+
+	// FailOnDisallowed fails the deploy instead of skipping files which
+	// AllowedExtensions doesn't allow.
+	FailOnDisallowed bool `hcl:"fail_on_disallowed,optional"`
+
+	// Preflight checks the permissions needed by the enabled features with
+	// a throwaway object before anything is uploaded, reporting every
+	// missing permission at once.
+	Preflight bool `hcl:"preflight,optional"`
+
+	// CleanupIncompleteUploads aborts the multipart uploads of the deploy's
+	// keys which earlier, interrupted deploys left behind.
+	CleanupIncompleteUploads bool `hcl:"cleanup_incomplete_uploads,optional"`
+
+	// RequestPayer sends "x-amz-request-payer: requester" with every object
+	// request, which requester-pays buckets require. Other buckets ignore
+	// it.
+	RequestPayer bool `hcl:"request_payer,optional"`
+
+	// SortKeys uploads objects in lexical key order, so the logs of
+	// deploys of the same artifact can be diffed.
+	SortKeys bool `hcl:"sort_keys,optional"`
+
+	// MaxOpenFiles is the number of artifact files read at once while
+	// they are hashed before the upload, defaults to 64. Lower it to stay
+	// within the open file limit of the runner. Files are streamed from
+	// disk, so it doesn't bound memory.
+	MaxOpenFiles int `hcl:"max_open_files,optional"`
+
+	// OCIAuth holds the credentials used to pull an artifact the registry
+	// pushed to an OCI registry. Without it the Docker config of the runner
+	// is used.
+	OCIAuth *builder.ImageAuth `hcl:"oci_auth,block"`
+
+	// MaxObjects and MaxTotalBytes fail the deploy before anything is
+	// uploaded when the artifact has more objects or bytes, guarding
+	// against a misconfigured build. Unlimited when zero.
+	MaxObjects    int   `hcl:"max_objects,optional"`
+	MaxTotalBytes int64 `hcl:"max_total_bytes,optional"`
+
+	// MaxRetries is the number of times objects which failed to upload are
+	// retried, defaults to 3. Only the failed objects are uploaded again.
+	MaxRetries *int `hcl:"max_retries,optional"`
+
+	// Prune deletes objects in the bucket which are not part of the
+	// artifact once it has been uploaded.
+	Prune bool `hcl:"prune,optional"`
+
+	// PruneOrder is when prune runs: "after" the upload, the default, or
+	// "before" it, trading a window in which stale objects are still served
+	// for one in which they are already gone.
+	PruneOrder string `hcl:"prune_order,optional"`
+
+	// PruneSource is where prune finds the objects in the bucket: "list"
+	// (the default) lists the bucket, "inventory" reads the newest S3
+	// Inventory report described by PruneInventory, for buckets too large
+	// to list on every deploy.
+	PruneSource    string          `hcl:"prune_source,optional"`
+	PruneInventory *PruneInventory `hcl:"prune_inventory,block"`
+
+	// HandleVersioning is what the deploy does about versioned buckets,
+	// which keep overwritten and pruned objects as noncurrent versions:
+	// "warn" (the default), "ignore" or "purge-noncurrent", which deletes
+	// every noncurrent version once the upload and prune are done.
+	HandleVersioning string `hcl:"handle_versioning,optional"`
+
+	// MaxConnections bounds the number of requests to the bucket in flight
+	// at once, across the parts of an upload and the concurrent prune and
+	// skip_unchanged requests. Unbounded when zero.
+	MaxConnections int `hcl:"max_connections,optional"`
+
+	// PruneConcurrency is the number of delete requests run in parallel
+	// while pruning, defaults to 4.
+	PruneConcurrency int `hcl:"prune_concurrency,optional"`
+
+	// ContentTypes maps file extensions to the Content-Type of matching
+	// objects, taking precedence over detection.
+	ContentTypes map[string]string `hcl:"content_types,optional"`
+
+	// ContentTypeOverrides maps globs to the Content-Type of matching
+	// objects, e.g. "/feeds/*.xml" = "application/rss+xml", taking
+	// precedence over ContentTypes. Rules supersede it.
+	ContentTypeOverrides map[string]string `hcl:"content_type_overrides,optional"`
+
+	// DefaultContentType is the Content-Type of objects nothing else gives
+	// one, e.g. when detection is disabled.
+	DefaultContentType string `hcl:"default_content_type,optional"`
+
+	// DetectContentType sniffs the Content-Type from the first 512 bytes of
+	// each file, defaults to true.
+	DetectContentType *bool `hcl:"detect_content_type,optional"`
+
+	// DetectOnlyExtensions, e.g. ["", ".bin"], limits detection to files
+	// with those extensions, "" meaning files without one. Other files not
+	// covered by a mapping get the type Go associates with their extension.
+	DetectOnlyExtensions []string `hcl:"detect_only_extensions,optional"`
+
+	// MimeTypesFile is a mime.types file, in the Apache or nginx format,
+	// mapping extensions to the Content-Type of matching objects. It is
+	// read at the start of each deploy and consulted after ContentTypes.
+	MimeTypesFile string `hcl:"mime_types_file,optional"`
+
+	// Rules set headers for objects matching a glob, first match wins.
+	// They take precedence over the other header options.
+	Rules []Rule `hcl:"rule,block"`
+
+	// DirRules set headers for all objects under a directory. They take
+	// precedence over the other header options except Rules.
+	DirRules []DirRule `hcl:"dir_rule,block"`
+
+	// HeadersFile is a Netlify style headers file in the artifact, e.g.
+	// "_headers", declaring headers for path patterns. It is read before
+	// the upload and not uploaded.
+	HeadersFile string `hcl:"headers_file,optional"`
+
+	// HeadersFilePrecedence is "config", where every option of the deploy
+	// stanza wins over HeadersFile and the default, or "file".
+	HeadersFilePrecedence string `hcl:"headers_file_precedence,optional"`
+
+	// AssetMetaFile is a JSON file in the artifact, e.g. "asset-meta.json",
+	// written by the build to set the cacheControl, contentType and headers
+	// of individual files. It wins over every other header option except
+	// PrivateGlobs, and is read before the upload and not uploaded.
+	AssetMetaFile string `hcl:"asset_meta_file,optional"`
+
+	// ContentLanguage maps globs to the Content-Language of matching
+	// objects, e.g. "/fr/**" = "fr". Rules supersede it.
+	ContentLanguage map[string]string `hcl:"content_language,optional"`
+
+	// ACL is the canned ACL of uploaded objects, defaults to "public-read".
+	// Use "bucket-owner-full-control" when deploying to a bucket owned by
+	// another account.
+	ACL string `hcl:"acl,optional"`
+
+	// Grants gives explicit grantees access to uploaded objects instead of
+	// the canned public-read ACL. It can't be combined with a canned ACL.
+	Grants *Grants `hcl:"grants,block"`
+
+	// PrivateGlobs marks objects which must not be stored by shared caches,
+	// such as content gated by auth at the CDN. They are uploaded with
+	// "Cache-Control: private, no-store", overriding any other setting.
+	PrivateGlobs []string `hcl:"private_globs,optional"`
+
+	// PrivateACL additionally uploads objects matching PrivateGlobs with the
+	// private canned ACL rather than public-read.
+	PrivateACL bool `hcl:"private_acl,optional"`
+
+	// RespectOwnershipControls uploads objects without any ACL or grants
+	// when the bucket has ACLs disabled ("Bucket owner enforced" object
+	// ownership), defaults to true.
+	RespectOwnershipControls *bool `hcl:"respect_ownership_controls,optional"`
+
+	// StripPrefix removes a leading directory, e.g. "dist", from the path
+	// of each file in the artifact to form its key.
+	StripPrefix string `hcl:"strip_prefix,optional"`
+
+	// LowercaseKeys lowercases the key of every file, so references which
+	// differ from the file name only by case still resolve. The deploy fails
+	// when two files only differ by case.
+	LowercaseKeys bool `hcl:"lowercase_keys,optional"`
+
+	// KeyDelimiter replaces the "/" separating the directories in the keys
+	// of files from the artifact, e.g. "\" for consumers expecting Windows
+	// paths. Options matching keys see the replaced keys.
+	KeyDelimiter string `hcl:"key_delimiter,optional"`
+
+	// KeyTemplate renders the key of every object from its path, e.g.
+	// "{{.App}}/{{.Workspace}}/{{.Path}}", for a shared layout of several
+	// apps or workspaces in one bucket. It must place every path under the
+	// same prefix, which prune is limited to.
+	KeyTemplate string `hcl:"key_template,optional"`
+
+	// TrailingSlashPolicy canonicalizes the URLs of directory indexes on
+	// website endpoints with redirect objects: "add" redirects "/dir" to
+	// "/dir/", "strip" serves the index at "/dir" and redirects "/dir/" to
+	// it, and "none", the default, leaves them alone.
+	TrailingSlashPolicy string `hcl:"trailing_slash_policy,optional"`
+
+	// CreateFolderPlaceholders uploads a zero-byte "<dir>/" object for each
+	// directory of the artifact, for tools which treat the bucket like a
+	// filesystem. FolderPlaceholdersEmptyOnly limits them to directories
+	// which would otherwise leave no trace.
+	CreateFolderPlaceholders    bool `hcl:"create_folder_placeholders,optional"`
+	FolderPlaceholdersEmptyOnly bool `hcl:"folder_placeholders_empty_only,optional"`
+
+	// UploadIfAbsent are globs of objects, such as one-time seed files,
+	// which are only uploaded when they don't exist in the bucket yet.
+	UploadIfAbsent []string `hcl:"upload_if_absent,optional"`
+
+	// Metrics publishes counts and timings of each deploy for Prometheus.
+	Metrics *Metrics `hcl:"metrics,block"`
+
+	// DefaultFiles maps keys, e.g. "robots.txt", to content uploaded when
+	// the artifact has no such file. Values starting with "file:" are read
+	// from that local path.
+	DefaultFiles map[string]string `hcl:"default_files,optional"`
+
+	// RequiredObjects are keys, e.g. ["index.html", "404.html"], which must
+	// be part of the artifact for the deploy to go ahead.
+	RequiredObjects []string `hcl:"required_objects,optional"`
+
+	// LockKey is an object created for the duration of the deploy, so
+	// concurrent deploys to the same bucket fail instead of interleaving.
+	LockKey string `hcl:"lock_key,optional"`
+
+	// LockTTL is how long a lock is honored before it is assumed to belong
+	// to a crashed deploy and taken over, defaults to "15m".
+	LockTTL string `hcl:"lock_ttl,optional"`
 }
 
 type Platform struct {
 	config DeployConfig
+
+	hashPattern    *regexp.Regexp
+	rules          headerRules
+	dirRules       []DirRule
+	privateGlobs   globRules
+	uploadIfAbsent globRules
+	serviceWorkers globRules
+
+	// cacheControlTemplate is the parsed CacheControl, rendered with
+	// templateData which is filled in at the start of each deploy
+	cacheControlTemplate *template.Template
+	templateData         cacheControlData
+
+	// file holds the rules read from the artifact's deploy file, see
+	// loadDeployFile
+	file             deployFile
+	fileCacheControl *template.Template
+
+	// headers are the rules read from HeadersFile, see loadHeadersFile
+	headers headersFileRules
+
+	// assetMeta are the headers read from AssetMetaFile, see loadAssetMeta
+	assetMeta assetMeta
+
+	// mimeTypes maps extensions to content types, see loadMimeTypes
+	mimeTypes map[string]string
+
+	// aclsDisabled is set when the bucket enforces object ownership, see
+	// checkOwnershipControls
+	aclsDisabled bool
+
+	// base is the stanza as configured, which the Workspaces of the
+	// current deploy are applied to
+	base DeployConfig
+
+	// keyTemplate is the parsed KeyTemplate, and keyPrefix the prefix it
+	// placed the objects of the current deploy under
+	keyTemplate *template.Template
+	keyPrefix   string
+
+	// swapTo is the generation prefix of an AtomicSwap deploy, which the
+	// website is switched to once it has been uploaded
+	swapTo string
+
+	// gitMetadata is the Git metadata of the current deploy, see
+	// GitMetadata
+	gitMetadata map[string]*string
+
+	// detections counts the artifact files whose content type was sniffed
+	// during the current deploy
+	detections int
+
+	// heads caches the HEAD responses of the current deploy by key, nil
+	// for keys which don't exist, see headObjects
+	heads map[string]*s3.HeadObjectOutput
+}
+
+// knownStorageClasses are the storage classes objects can be uploaded with.
+var knownStorageClasses = []string{
+	"STANDARD",
+	"REDUCED_REDUNDANCY",
+	"STANDARD_IA",
+	"ONEZONE_IA",
+	"INTELLIGENT_TIERING",
+	"GLACIER",
+	"GLACIER_IR",
+	"DEEP_ARCHIVE",
+}
+
+func validStorageClass(class string) bool {
+	for _, c := range knownStorageClasses {
+		if c == class {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Implement Configurable
@@ -40,148 +534,1490 @@ func (p *Platform) ConfigSet(config interface{}) error {
 	}
 
 	// validate the config
+	v := validate.New("deploy")
+
+	// With workspace blocks the stanza only has to be valid once the
+	// overrides of a workspace are applied
+	if len(c.Workspaces) > 0 {
+		p.configureWorkspaces(c, v)
+		return v.Err()
+	}
+
+	p.configure(c, v)
+
+	return v.Err()
+}
+
+// configure validates c, recording its problems in v, and sets up the
+// rules and templates it defines.
+func (p *Platform) configure(c *DeployConfig, v *validate.Errors) {
 	if c.Region == "" {
-		return fmt.Errorf("region must be set to a valid AWS region")
+		v.Add("region", "must be set to a valid AWS region")
 	}
 
 	if c.BucketName == "" {
-		return fmt.Errorf("bucket_name must be set to a valid S3 bucket")
+		v.Add("bucket_name", "must be set to a valid S3 bucket")
 	}
 
-	return nil
-}
+	if c.Accelerate && c.EndpointResolver["s3"] != "" {
+		v.Add("accelerate", "can't be combined with an s3 endpoint in endpoint_resolver")
+	}
 
-// This function can be implemented to return various connection info required
-// to connect to your given platform for Resource Manager. It could return
-// a struct with client information, what namespace to connect to, a config,
-// and so on.
-func (p *Platform) getConnectContext() (interface{}, error) {
-	return nil, nil
-}
+	if c.Accelerate && strings.Contains(c.BucketName, ".") {
+		v.Add("accelerate", "requires a bucket_name without periods")
+	}
 
-// Implement Platform
-func (p *Platform) DeployFunc() interface{} {
-	// return a function which will be called by Waypoint
-	return p.deploy
-}
+	v.AddError("resource_tags", awsutil.ValidateTags(c.ResourceTags))
 
-// A BuildFunc does not have a strict signature, you can define the parameters
-// you need based on the Available parameters that the Waypoint SDK provides.
-// Waypoint will automatically inject parameters as specified
-// in the signature at run time.
-//
-// Available input parameters:
-// - context.Context
-// - *component.Source
-// - *component.JobInfo
-// - *component.DeploymentConfig
-// - hclog.Logger
-// - terminal.UI
-// - *component.LabelSet
+	if c.CacheControl != "" {
+		tmpl, err := parseCacheControl(c.CacheControl)
+		v.AddError("cache_control", err)
+		p.cacheControlTemplate = tmpl
+	}
 
-// In addition to default input parameters the registry.Zip from the Build step
-// can also be injected.
-//
-// The output parameters for BuildFunc must be a Struct which can
-// be serialzied to Protocol Buffers binary format and an error.
-// This Output Value will be made available for other functions
-// as an input parameter.
-// If an error is returned, Waypoint stops the execution flow and
-// returns an error to the user.
-func (b *Platform) deploy(
-	ctx context.Context,
-	ui terminal.UI,
-	log hclog.Logger,
-	dcr *component.DeclaredResourcesResp,
-	zip *registry.Zip,
-) (*Deployment, error) {
-	u := ui.Status()
-	defer u.Close()
-	u.Update("Deploy application")
-	// the session the S3 Uploader will use
-	sess := session.Must(session.NewSession(&aws.Config{Region: &b.config.Region}))
+	if c.KeyTemplate != "" {
+		tmpl, err := parseKeyTemplate(c.KeyTemplate)
+		v.AddError("key_template", err)
+		p.keyTemplate = tmpl
+	}
 
-	// create an uploader with the session and default options
-	uploader := s3manager.NewUploader(sess)
+	if c.HashPattern != "" {
+		re, err := regexp.Compile(c.HashPattern)
+		if err != nil {
+			v.Add("hash_pattern", "must be a valid regular expression: %s", err)
+		}
 
-	// walk temp dir
-	objects := []s3manager.BatchUploadObject{}
+		p.hashPattern = re
+	}
 
-	err := filepath.Walk(zip.Path, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if c.MaxRetries != nil && *c.MaxRetries < 0 {
+		v.Add("max_retries", "must not be negative")
+	}
+
+	for _, ext := range c.AllowedExtensions {
+		if !strings.HasPrefix(ext, ".") || strings.Contains(ext, "/") {
+			v.Add("allowed_extensions", "%q must be a file extension such as \".html\"", ext)
 		}
+	}
 
-		stat, err := os.Stat(path)
-		if err != nil {
-			return err
+	if c.FailOnDisallowed && len(c.AllowedExtensions) == 0 {
+		v.Add("fail_on_disallowed", "requires allowed_extensions to be set")
+	}
+
+	if c.MaxOpenFiles < 0 {
+		v.Add("max_open_files", "must not be negative")
+	}
+
+	if c.MaxObjects < 0 {
+		v.Add("max_objects", "must not be negative")
+	}
+
+	if c.MaxTotalBytes < 0 {
+		v.Add("max_total_bytes", "must not be negative")
+	}
+
+	if c.HandleVersioning != "" && !validVersioningBehavior(c.HandleVersioning) {
+		v.Add("handle_versioning", "must be one of %s", strings.Join(versioningBehaviors, ", "))
+	}
+
+	switch c.PruneOrder {
+	case "":
+	case pruneOrderBefore, pruneOrderAfter:
+		if !c.Prune {
+			v.Add("prune_order", "requires prune to be set")
 		}
+	default:
+		v.Add("prune_order", "must be %q or %q", pruneOrderBefore, pruneOrderAfter)
+	}
 
-		if stat.IsDir() {
-			return nil
+	switch c.PruneSource {
+	case "", pruneSourceList:
+		if c.PruneInventory != nil {
+			v.Add("prune_inventory", "requires prune_source to be \"inventory\"")
+		}
+	case pruneSourceInventory:
+		if !c.Prune {
+			v.Add("prune_source", "requires prune to be set")
 		}
 
-		relativePath, err := filepath.Rel(zip.Path, path)
-		if err != nil {
-			return err
+		if c.PruneInventory == nil {
+			v.Add("prune_source", "\"inventory\" requires a prune_inventory block")
+		} else {
+			v.AddError("prune_inventory", c.PruneInventory.Validate())
 		}
+	default:
+		v.Add("prune_source", "must be \"list\" or \"inventory\"")
+	}
 
-		f, err := os.Open(path)
-		if err != nil {
-			return fmt.Errorf("failed to open file %q, %v", path, err)
+	v.AddError("stale_while_revalidate", validateStaleDuration(c.StaleWhileRevalidate))
+	v.AddError("stale_if_error", validateStaleDuration(c.StaleIfError))
+
+	if c.KeyDelimiter != "" && !strings.Contains(keyDelimiters, c.KeyDelimiter) || len(c.KeyDelimiter) > 1 {
+		v.Add("key_delimiter", "must be one of the characters %s", strings.Join(strings.Split(keyDelimiters, ""), " "))
+	}
+
+	if c.InjectSRI && c.KeyDelimiter != "" && c.KeyDelimiter != "/" {
+		v.Add("inject_sri", "can't be combined with a key_delimiter other than \"/\"")
+	}
+
+	if c.TrailingSlashPolicy != "" {
+		if !validTrailingSlashPolicy(c.TrailingSlashPolicy) {
+			v.Add("trailing_slash_policy", "must be one of %s", strings.Join(trailingSlashPolicies, ", "))
 		}
 
-		fileInfo, _ := f.Stat()
-		size := fileInfo.Size()
+		if c.TrailingSlashPolicy != trailingSlashNone && c.KeyDelimiter != "" && c.KeyDelimiter != "/" {
+			v.Add("trailing_slash_policy", "can't be combined with a key_delimiter other than \"/\"")
+		}
+	}
 
-		buffer := make([]byte, size)
-		f.Read(buffer)
+	if c.CreateFolderPlaceholders && c.KeyDelimiter != "" && c.KeyDelimiter != "/" {
+		v.Add("create_folder_placeholders", "can't be combined with a key_delimiter other than \"/\"")
+	}
 
-		objects = append(objects, s3manager.BatchUploadObject{Object: &s3manager.UploadInput{
-			Key:         aws.String(relativePath),
-			Bucket:      aws.String(b.config.BucketName),
-			Body:        bytes.NewReader(buffer),
-			ACL:         aws.String("public-read"),
-			ContentType: aws.String(http.DetectContentType(buffer)),
-		}})
+	if c.FolderPlaceholdersEmptyOnly && !c.CreateFolderPlaceholders {
+		v.Add("folder_placeholders_empty_only", "requires create_folder_placeholders to be set")
+	}
 
-		return nil
-	})
+	if c.HeadersFile != "" {
+		if _, err := sanitizeKey(c.HeadersFile); err != nil {
+			v.Add("headers_file", "must be a path in the artifact: %s", err)
+		}
 
-	if err != nil {
-		return nil, err
+		if c.HeadersFile == deployFileName {
+			v.Add("headers_file", "can't be %s", deployFileName)
+		}
 	}
 
-	iter := &s3manager.UploadObjectsIterator{Objects: objects}
-	err = uploader.UploadWithIterator(ctx, iter)
-	if err != nil {
-		return nil, err
+	if c.AssetMetaFile != "" {
+		if _, err := sanitizeKey(c.AssetMetaFile); err != nil {
+			v.Add("asset_meta_file", "must be a path in the artifact: %s", err)
+		}
+
+		if c.AssetMetaFile == deployFileName || c.AssetMetaFile == c.HeadersFile {
+			v.Add("asset_meta_file", "can't be %s or headers_file", deployFileName)
+		}
 	}
 
-	u.Update("Application deployed")
+	if c.OCIAuth != nil {
+		v.AddError("oci_auth", c.OCIAuth.Validate())
+	}
 
-	return &Deployment{}, nil
-}
+	switch c.HeadersFilePrecedence {
+	case "", headersFileConfig, headersFileFirst:
+		if c.HeadersFilePrecedence != "" && c.HeadersFile == "" {
+			v.Add("headers_file_precedence", "requires headers_file to be set")
+		}
+	default:
+		v.Add("headers_file_precedence", "must be %q or %q", headersFileConfig, headersFileFirst)
+	}
 
-func (b *Platform) resourceDeploymentCreate(
-	ctx context.Context,
-	log hclog.Logger,
-	st terminal.Status,
-	ui terminal.UI,
-	zip *registry.Zip,
-	result *Deployment,
-) error {
-	// Create your deployment resource here!
+	if c.AtomicSwap {
+		if !c.EnableWebsite {
+			v.Add("atomic_swap", "requires enable_website to be set")
+		}
 
-	return nil
-}
+		if len(c.Redirects) > 0 || c.RootRedirect != "" {
+			v.Add("atomic_swap", "can't be combined with redirects or root_redirect")
+		}
 
-func (b *Platform) resourceDeploymentStatus(
-	ctx context.Context,
-	ui terminal.UI,
-	sg terminal.StepGroup,
-	zip *registry.Zip,
-) error {
-	// Determine health status of "this" resource.
-	return nil
+		if c.KeyDelimiter != "" && c.KeyDelimiter != "/" {
+			v.Add("atomic_swap", "can't be combined with a key_delimiter other than \"/\"")
+		}
+
+		if c.KeyTemplate != "" {
+			v.Add("atomic_swap", "can't be combined with key_template")
+		}
+	}
+
+	if c.SwapPrefix != "" {
+		if !c.AtomicSwap {
+			v.Add("swap_prefix", "requires atomic_swap to be set")
+		}
+
+		if _, err := sanitizeKey(strings.Trim(c.SwapPrefix, "/")); err != nil {
+			v.Add("swap_prefix", "must be a valid key prefix: %s", err)
+		}
+	}
+
+	if c.ChecksumAlgorithm != "" && !validChecksumAlgorithm(c.ChecksumAlgorithm) {
+		v.Add("checksum_algorithm", "must be one of %s", checksumAlgorithms())
+	}
+
+	if c.MaxConnections < 0 {
+		v.Add("max_connections", "must not be negative")
+	}
+
+	if c.PruneConcurrency < 0 {
+		v.Add("prune_concurrency", "must not be negative")
+	}
+
+	for _, ext := range c.DetectOnlyExtensions {
+		if ext != "" && (!strings.HasPrefix(ext, ".") || strings.Contains(ext, "/")) {
+			v.Add("detect_only_extensions", "%q must be a file extension such as \".bin\" or \"\"", ext)
+		}
+	}
+
+	if len(c.DetectOnlyExtensions) > 0 && c.DetectContentType != nil && !*c.DetectContentType {
+		v.Add("detect_only_extensions", "can't be combined with detect_content_type = false")
+	}
+
+	v.AddError("content_types", validateContentTypes(c.ContentTypes))
+
+	for _, glob := range sortedKeys(c.ContentTypeOverrides) {
+		if c.ContentTypeOverrides[glob] == "" {
+			v.Add("content_type_overrides", "content type of %q must not be empty", glob)
+		}
+	}
+	c.ContentTypes = lowerKeys(c.ContentTypes)
+
+	dirRules, err := compileDirRules(c.DirRules)
+	v.AddError("dir_rule", err)
+	p.dirRules = dirRules
+
+	if c.ACL != "" && !validACL(c.ACL) {
+		v.Add("acl", "must be one of %s", strings.Join(cannedACLs, ", "))
+	}
+
+	if c.Grants != nil {
+		v.AddError("grants", c.Grants.validate())
+
+		if c.ACL != "" {
+			v.Add("grants", "can't be combined with acl")
+		}
+
+		for _, r := range dirRules {
+			if r.ACL != "" {
+				v.Add("grants", "can't be combined with the acl of dir_rule %q", r.Prefix)
+			}
+		}
+	}
+
+	v.AddError("redirects", validateRedirects(c.Redirects))
+
+	if c.RootRedirect != "" && !validRedirectTarget(c.RootRedirect) {
+		v.Add("root_redirect", "must start with /, http:// or https://")
+	}
+
+	if c.StorageClass != "" && !validStorageClass(c.StorageClass) {
+		v.Add("storage_class", "must be one of %s", strings.Join(knownStorageClasses, ", "))
+	}
+
+	for glob, class := range c.StorageClasses {
+		if !validStorageClass(class) {
+			v.Add("storage_classes", "%q for %q must be one of %s", class, glob, strings.Join(knownStorageClasses, ", "))
+		}
+	}
+
+	for glob, lang := range c.ContentLanguage {
+		if !validLanguage(lang) {
+			v.Add("content_language", "%q for %q must be a language tag such as \"en\" or \"pt-BR\"", lang, glob)
+		}
+	}
+
+	// The maps predate rule blocks and are matched after them
+	headerRules, err := compileRules(append(append([]Rule(nil), c.Rules...), mapRules(c.StorageClasses, c.ContentLanguage, c.ContentTypeOverrides)...))
+	v.AddError("rule", err)
+	p.rules = headerRules
+
+	if c.AtomicSwap && headerRules.hasOnlyOnCreate() {
+		v.Add("rule", "only_on_create can't be combined with atomic_swap, which uploads every key anew")
+	}
+
+	if c.Grants != nil {
+		for _, r := range c.Rules {
+			if r.ACL != "" {
+				v.Add("grants", "can't be combined with the acl of rule %q", r.Match)
+			}
+		}
+	}
+
+	rules, err := compileGlobList(c.UploadIfAbsent)
+	v.AddError("upload_if_absent", err)
+	p.uploadIfAbsent = rules
+
+	rules, err = compileGlobList(c.PrivateGlobs)
+	v.AddError("private_globs", err)
+	p.privateGlobs = rules
+
+	serviceWorkers := c.ServiceWorkerFiles
+	if serviceWorkers == nil {
+		serviceWorkers = defaultServiceWorkerFiles
+	}
+
+	rules, err = compileGlobList(serviceWorkers)
+	v.AddError("service_worker_files", err)
+	p.serviceWorkers = rules
+
+	if c.PrivateACL && len(c.PrivateGlobs) == 0 {
+		v.Add("private_acl", "requires private_globs to be set")
+	}
+
+	v.AddError("min_tls_version", awsutil.ValidateTLSVersion(c.MinTLSVersion))
+	v.AddError("endpoint_resolver", awsutil.ValidateEndpoints(c.EndpointResolver))
+	v.AddError("shared_config_file", awsutil.ValidateFile(c.SharedConfigFile))
+	v.AddError("shared_credentials_file", awsutil.ValidateFile(c.SharedCredentialsFile))
+	v.AddError("ca_bundle", awsutil.ValidateCABundle(c.CABundle))
+
+	if !c.EnableWebsite && (c.IndexDocument != "" || c.ErrorDocument != "") {
+		v.Add("enable_website", "must be set to use index_document or error_document")
+	}
+
+	if c.IndexDocument != "" && strings.Contains(c.IndexDocument, "/") {
+		v.Add("index_document", "must be a file name such as \"index.html\" without a slash")
+	}
+
+	if c.SourceBucket != "" {
+		v.AddError("source_bucket", validateMirror(c))
+	} else if c.SourcePrefix != "" || c.SourceRegion != "" {
+		v.Add("source_bucket", "must be set to use source_prefix or source_region")
+	}
+
+	if c.ArtifactType != "" && !validArtifactType(c.ArtifactType) {
+		v.Add("artifact_type", "must be one of %s", strings.Join(artifactTypes, ", "))
+	}
+
+	if c.SkipUnchangedStrategy != "" && !validSkipStrategy(c.SkipUnchangedStrategy) {
+		v.Add("skip_unchanged_strategy", "must be one of %s", strings.Join(skipStrategies, ", "))
+	}
+
+	if c.SkipUnchangedConcurrency < 0 {
+		v.Add("skip_unchanged_concurrency", "must not be negative")
+	}
+
+	if c.PreserveMetadata && c.SkipUnchanged {
+		v.Add("preserve_metadata", "can't be combined with skip_unchanged")
+	}
+
+	if c.GitMetadataKey != "" && !c.GitMetadata {
+		v.Add("git_metadata_key", "requires git_metadata to be set")
+	}
+
+	if c.InvalidateChangedOnly && c.CloudFrontDistributionID == "" {
+		v.Add("invalidate_changed_only", "requires cloudfront_distribution_id to be set")
+	}
+
+	if c.FailOnMixedContent && !c.CheckMixedContent {
+		v.Add("fail_on_mixed_content", "requires check_mixed_content to be set")
+	}
+
+	if c.Metrics != nil {
+		v.AddError("metrics", c.Metrics.validate())
+	}
+
+	v.AddError("default_files", validateDefaultFiles(c.DefaultFiles))
+
+	if c.StripPrefix != "" && strings.Trim(c.StripPrefix, "/") == "" {
+		v.Add("strip_prefix", "must name a directory such as \"dist\"")
+	}
+
+	if c.LockTTL != "" {
+		if c.LockKey == "" {
+			v.Add("lock_ttl", "requires lock_key to be set")
+		}
+
+		if d, err := time.ParseDuration(c.LockTTL); err != nil || d <= 0 {
+			v.Add("lock_ttl", "must be a positive duration such as \"15m\"")
+		}
+	}
+
+	if c.LockKey != "" && c.LockKey == c.ManifestKey {
+		v.Add("lock_key", "must differ from manifest_key")
+	}
+
+	if !c.GenerateSRIManifest {
+		if c.SRIManifestKey != "" {
+			v.Add("sri_manifest_key", "requires generate_sri_manifest to be set")
+		}
+
+		if c.InjectSRI {
+			v.Add("inject_sri", "requires generate_sri_manifest to be set")
+		}
+	}
+
+	if c.DeploySummaryKey != "" {
+		if !c.WriteDeploySummary {
+			v.Add("deploy_summary_key", "requires write_deploy_summary to be set")
+		}
+
+		if key := strings.TrimPrefix(c.DeploySummaryKey, "/"); key == c.ManifestKey || key == c.LockKey || key == c.LatestPointerKey {
+			v.Add("deploy_summary_key", "must differ from manifest_key, lock_key and latest_pointer_key")
+		}
+	}
+
+	if c.LatestPointerKey != "" {
+		if c.ManifestKey == "" {
+			v.Add("latest_pointer_key", "requires manifest_key to be set")
+		}
+
+		if c.LatestPointerKey == c.ManifestKey || c.LatestPointerKey == c.LockKey {
+			v.Add("latest_pointer_key", "must differ from manifest_key and lock_key")
+		}
+	}
+}
+
+// This function can be implemented to return various connection info required
+// to connect to your given platform for Resource Manager. It could return
+// a struct with client information, what namespace to connect to, a config,
+// and so on.
+func (p *Platform) getConnectContext() (interface{}, error) {
+	return nil, nil
+}
+
+// Implement component.DeploymentWithUrl
+func (d *Deployment) URL() string {
+	return d.Url
+}
+
+// Implement Platform
+func (p *Platform) DeployFunc() interface{} {
+	// return a function which will be called by Waypoint
+	return p.deploy
+}
+
+// Implement Status
+func (p *Platform) StatusFunc() interface{} {
+	return p.status
+}
+
+// Resource manager will tell the Waypoint Plugin SDK how to create and delete
+// certain resources for your deployments.
+//
+// The deployment tracks the bucket the artifact was uploaded to. Objects are
+// shared between deployments to the same bucket, so the resource has no
+// destroy function and destroying a deployment leaves them in place.
+func (p *Platform) resourceManager(log hclog.Logger, dcr *component.DeclaredResourcesResp) *resource.Manager {
+	return resource.NewManager(
+		resource.WithLogger(log.Named("resource_manager")),
+		resource.WithValueProvider(p.getConnectContext),
+		resource.WithDeclaredResourcesResp(dcr),
+		resource.WithResource(resource.NewResource(
+			resource.WithName("bucket"),
+			resource.WithState(&Resource_Bucket{}),
+			resource.WithCreate(p.resourceBucketCreate),
+			resource.WithStatus(p.resourceBucketStatus),
+			resource.WithPlatform("s3"),
+			resource.WithCategoryDisplayHint(sdk.ResourceCategoryDisplayHint_STORAGE),
+		)),
+	)
+}
+
+// A BuildFunc does not have a strict signature, you can define the parameters
+// you need based on the Available parameters that the Waypoint SDK provides.
+// Waypoint will automatically inject parameters as specified
+// in the signature at run time.
+//
+// Available input parameters:
+// - context.Context
+// - *component.Source
+// - *component.JobInfo
+// - *component.DeploymentConfig
+// - hclog.Logger
+// - terminal.UI
+// - *component.LabelSet
+
+// In addition to default input parameters the registry.Zip from the Build step
+// can also be injected.
+//
+// The output parameters for BuildFunc must be a Struct which can
+// be serialzied to Protocol Buffers binary format and an error.
+// This Output Value will be made available for other functions
+// as an input parameter.
+// If an error is returned, Waypoint stops the execution flow and
+// returns an error to the user.
+func (b *Platform) deploy(
+	ctx context.Context,
+	ui terminal.UI,
+	log hclog.Logger,
+	dcr *component.DeclaredResourcesResp,
+	zip *registry.Zip,
+	dcfg *component.DeploymentConfig,
+	job *component.JobInfo,
+	src *component.Source,
+) (*Deployment, error) {
+	if err := b.useWorkspace(job.Workspace); err != nil {
+		return nil, err
+	}
+
+	b.templateData = cacheControlData{
+		DeploymentID: dcfg.Id,
+		Sequence:     dcfg.Sequence,
+		App:          job.App,
+		Project:      job.Project,
+		Workspace:    job.Workspace,
+	}
+	b.heads = nil
+	b.keyPrefix = ""
+
+	b.gitMetadata = nil
+	if b.config.GitMetadata || b.config.WriteDeploySummary {
+		b.gitMetadata = gitMetadata(ctx, src.Path)
+		log.Info("git metadata", "metadata", aws.StringValueMap(b.gitMetadata))
+	}
+
+	sg := ui.StepGroup()
+	defer sg.Wait()
+
+	result := &Deployment{
+		Region:                   b.config.Region,
+		BucketName:               b.config.BucketName,
+		CloudfrontDistributionId: b.config.CloudFrontDistributionID,
+	}
+
+	// Create our resource manager and create deployment resources
+	r := b.resourceManager(log, dcr)
+
+	// These params must match exactly to your resource manager functions. Otherwise
+	// they will not be invoked during CreateAll()
+	if err := r.CreateAll(
+		ctx, log, sg,
+		zip, result,
+	); err != nil {
+		return nil, err
+	}
+
+	// Store our resource state
+	result.ResourceState = r.State()
+
+	return result, nil
+}
+
+func (b *Platform) status(
+	ctx context.Context,
+	log hclog.Logger,
+	ui terminal.UI,
+	deployment *Deployment,
+) (*sdk.StatusReport, error) {
+	sg := ui.StepGroup()
+	defer sg.Wait()
+
+	s := sg.Add("Checking the status of the deployment...")
+	defer s.Abort()
+
+	r := b.resourceManager(log, nil)
+
+	// If we don't have resource state, this state is from an older version
+	// and we need to manually recreate it.
+	if deployment.ResourceState == nil {
+		r.Resource("bucket").SetState(&Resource_Bucket{
+			Name:   deployment.BucketName,
+			Region: deployment.Region,
+		})
+	} else {
+		// Load our set state
+		if err := r.LoadState(deployment.ResourceState); err != nil {
+			return nil, err
+		}
+	}
+
+	// This will call the StatusReport func on every defined resource in ResourceManager
+	report, err := r.StatusReport(ctx, log, sg, ui)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "resource manager failed to generate resource statuses: %s", err)
+	}
+
+	s.Update("Deployment is %s", strings.ToLower(report.Health.String()))
+	s.Done()
+
+	return report, nil
+}
+
+// resourceBucketCreate uploads the artifact to the bucket, which is tracked
+// as the deployment's resource.
+func (b *Platform) resourceBucketCreate(
+	ctx context.Context,
+	log hclog.Logger,
+	sg terminal.StepGroup,
+	zip *registry.Zip,
+	result *Deployment,
+	state *Resource_Bucket,
+) (err error) {
+	metrics := &deployMetrics{start: time.Now()}
+
+	// Once objects are being uploaded the bucket has changed, so report how
+	// far the deploy got along with the error
+	defer func() {
+		if err != nil && metrics.planned > 0 {
+			s := sg.Add(metrics.failureSummary(err))
+			s.Status(terminal.StatusError)
+			s.Done()
+		}
+	}()
+
+	if b.config.Metrics != nil {
+		defer func() {
+			// Metrics are reported for failed deploys too, and failing to
+			// publish them doesn't fail the deploy
+			if merr := b.publishMetrics(ctx, metrics, err == nil); merr != nil {
+				log.Warn("unable to publish deploy metrics", "error", merr)
+				warn(sg, "Unable to publish deploy metrics: %s", merr)
+			}
+		}()
+	}
+
+	if b.config.InsecureSkipVerify {
+		log.Warn("TLS certificate verification is disabled")
+		warn(sg, "%s", awsutil.InsecureSkipVerifyWarning)
+	}
+
+	step := sg.Add("Connecting to bucket %s...", b.config.BucketName)
+	defer step.Abort()
+
+	// the session the S3 Uploader will use
+	sc := b.sessionConfig(b.config.Region)
+	sc.Accelerate = b.config.Accelerate
+	sc.MaxConnections = b.config.MaxConnections
+
+	sess, err := sc.Session()
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "unable to create AWS session: %s", err)
+	}
+
+	if b.config.Accelerate {
+		if err := b.checkAccelerate(ctx, sess); err != nil {
+			return err
+		}
+	}
+
+	if b.respectOwnershipControls() {
+		b.checkOwnershipControls(ctx, log, sg, s3.New(sess))
+	}
+
+	versioned := false
+	if b.versioningBehavior() != versioningIgnore {
+		versioned = b.checkVersioning(ctx, log, sg, s3.New(sess))
+	}
+
+	// acl("") is the ACL of objects outside any dir_rule. Objects in buckets
+	// with ACLs disabled are always owned by the bucket owner.
+	if !b.aclsDisabled && b.config.Grants == nil && b.acl("") != "bucket-owner-full-control" {
+		b.checkBucketOwner(ctx, log, sg, s3.New(sess))
+	}
+
+	if b.config.Preflight {
+		step.Update("Checking permissions on bucket %s...", b.config.BucketName)
+
+		if err := b.preflight(ctx, s3.New(sess)); err != nil {
+			return err
+		}
+	}
+
+	if b.config.LockKey != "" {
+		step.Update("Acquiring deploy lock %s...", b.config.LockKey)
+
+		held, err := b.acquireLock(ctx, s3.New(sess))
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := b.releaseLock(s3.New(sess), held); err != nil {
+				log.Warn("unable to release deploy lock", "key", b.config.LockKey, "error", awsutil.Describe(err))
+				warn(sg, "Unable to release deploy lock %q, it expires after %s", b.config.LockKey, b.lockTTL())
+			}
+		}()
+	}
+
+	step.Done()
+
+	if b.config.SourceBucket != "" {
+		return b.mirror(ctx, log, sg, sess, result, state, metrics)
+	}
+
+	step = sg.Add("Reading artifact...")
+	defer step.Abort()
+
+	// create an uploader with the session and default options
+	uploader := s3manager.NewUploader(sess)
+
+	root, err := zip.Fetch(ctx, b.sessionConfig(""), b.config.OCIAuth)
+	if err != nil {
+		return err
+	}
+
+	if err := b.loadDeployFile(root); err != nil {
+		return err
+	}
+
+	mimeTypes, err := b.loadMimeTypes()
+	if err != nil {
+		return err
+	}
+
+	if b.config.MimeTypesFile != "" {
+		log.Info("loaded mime types", "path", b.config.MimeTypesFile, "extensions", mimeTypes)
+		step.Update("Loaded %d content types from %s", mimeTypes, b.config.MimeTypesFile)
+	}
+
+	headerWarnings, err := b.loadHeadersFile(root)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range headerWarnings {
+		warn(sg, "%s %s", b.config.HeadersFile, w)
+	}
+
+	assetWarnings, err := b.loadAssetMeta(root)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range assetWarnings {
+		warn(sg, "%s %s", b.config.AssetMetaFile, w)
+	}
+
+	b.detections = 0
+	artifact, err := b.readSource(dirSource(root))
+	if err != nil {
+		return err
+	}
+
+	objects, keys, unstripped := artifact.objects, artifact.keys, artifact.unstripped
+
+	if n := len(artifact.disallowed); n > 0 {
+		log.Warn("files with disallowed extensions", "paths", artifact.disallowed)
+
+		if b.config.FailOnDisallowed {
+			return status.Errorf(codes.FailedPrecondition, "%d files have an extension not in allowed_extensions, e.g. %q",
+				n, artifact.disallowed[0])
+		}
+
+		warn(sg, "Skipped %d files with an extension not in allowed_extensions, e.g. %q", n, artifact.disallowed[0])
+	}
+
+	if missing := b.missingAssets(keys); len(missing) > 0 {
+		log.Warn("asset meta entries without a file", "paths", missing)
+		warn(sg, "%s describes %d files which aren't in the artifact, e.g. %q", b.config.AssetMetaFile, len(missing), missing[0])
+	}
+
+	defaults, err := b.defaultFileObjects(keys)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "%s", err)
+	}
+
+	if len(defaults) > 0 {
+		objects = append(objects, defaults...)
+		step.Update("Read %d files from the artifact, adding %d default files", len(objects)-len(defaults), len(defaults))
+	} else {
+		step.Update("Read %d files from the artifact", len(objects))
+	}
+
+	if len(b.config.DetectOnlyExtensions) > 0 {
+		log.Info("detected content types", "files", b.detections)
+		step.Update("Detected the content type of %d of %d files", b.detections, len(objects))
+	}
+
+	if b.config.SortKeys {
+		sortObjects(objects)
+	}
+	step.Done()
+
+	if b.config.GenerateSRIManifest {
+		step = sg.Add("Computing subresource integrity hashes...")
+		defer step.Abort()
+
+		if keys[b.sriManifestKey()] {
+			return status.Errorf(codes.InvalidArgument, "sri_manifest_key %q conflicts with a file in the artifact", b.sriManifestKey())
+		}
+
+		hashes, err := integrityHashes(objects)
+		if err != nil {
+			return err
+		}
+
+		if b.config.InjectSRI {
+			n, err := injectIntegrity(objects, hashes)
+			if err != nil {
+				return err
+			}
+
+			step.Update("Hashed %d scripts and stylesheets, added integrity attributes to %d HTML files", len(hashes), n)
+		} else {
+			step.Update("Hashed %d scripts and stylesheets", len(hashes))
+		}
+
+		obj, err := b.sriManifest(hashes)
+		if err != nil {
+			return err
+		}
+
+		keys[b.sriManifestKey()] = true
+		objects = append(objects, obj)
+		step.Done()
+	}
+
+	if key := b.gitMetadataKey(); key != "" {
+		if keys[key] {
+			return status.Errorf(codes.InvalidArgument, "git_metadata_key %q conflicts with a file in the artifact", key)
+		}
+
+		keys[key] = true
+		objects = append(objects, b.gitMetadataMarker())
+	}
+
+	if b.config.TrailingSlashPolicy != "" && b.config.TrailingSlashPolicy != trailingSlashNone {
+		step = sg.Add("Applying trailing slash policy %q...", b.config.TrailingSlashPolicy)
+		defer step.Abort()
+
+		var n int
+		objects, n, err = b.applyTrailingSlash(objects, keys)
+		if err != nil {
+			return err
+		}
+
+		step.Update("Added trailing slash redirects for %d directories", n)
+		step.Done()
+	}
+
+	if b.config.CheckMixedContent {
+		step = sg.Add("Checking HTML for mixed content...")
+		defer step.Abort()
+
+		found, err := mixedContent(objects)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case len(found) == 0:
+			step.Update("No mixed content found")
+			step.Done()
+		case b.config.FailOnMixedContent:
+			return status.Errorf(codes.FailedPrecondition, "%d resources are referenced over http://: %s", len(found), summarizeMixedContent(found))
+		default:
+			log.Warn("mixed content", "locations", found)
+			step.Done()
+			warn(sg, "%d resources are referenced over http:// and will be blocked over HTTPS: %s", len(found), summarizeMixedContent(found))
+		}
+	}
+
+	if n := len(artifact.lowercased); n > 0 {
+		log.Info("lowercased keys", "paths", artifact.lowercased)
+		warn(sg, "Lowercased the keys of %d files, e.g. %q", n, artifact.lowercased[0])
+	}
+
+	if len(unstripped) > 0 {
+		log.Warn("files outside strip_prefix", "prefix", b.config.StripPrefix, "keys", unstripped)
+		warn(sg, "%d files are not under strip_prefix %q and keep their full path, e.g. %q",
+			len(unstripped), b.config.StripPrefix, unstripped[0])
+	}
+
+	// Only an explicit artifact_type fails the deploy over a missing index
+	// document, as earlier versions deployed such artifacts
+	missingIndex := b.artifactType() == artifactTypeWebsite && !keys[b.indexDocument()]
+	if missingIndex && b.config.ArtifactType == "" {
+		warn(sg, "The artifact has no %s at its root, set artifact_type to %q if it isn't a website", b.indexDocument(), artifactTypeAssets)
+	}
+
+	if b.artifactType() == artifactTypeWebsite && !hasHTML(keys) {
+		log.Warn("artifact contains no HTML files")
+		warn(sg, "The artifact contains no HTML files, which is likely a build error")
+	}
+
+	step = sg.Add("Verifying artifact...")
+	defer step.Abort()
+
+	var missing []string
+	for _, key := range b.config.RequiredObjects {
+		if !keys[strings.TrimPrefix(key, "/")] {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "required objects are missing from the artifact: %s", strings.Join(missing, ", "))
+	}
+
+	if missingIndex && b.config.ArtifactType != "" {
+		return status.Errorf(codes.FailedPrecondition, "artifact_type %q requires %s at the root of the artifact", artifactTypeWebsite, b.indexDocument())
+	}
+
+	var websiteDisabled bool
+	if len(b.config.Redirects) > 0 || b.config.RootRedirect != "" {
+		website, err := b.websiteConfig(ctx, s3.New(sess))
+		if err != nil {
+			return awsutil.Error(codes.FailedPrecondition, err, "unable to read website configuration of bucket %q", b.config.BucketName)
+		}
+
+		// The configuration is replaced once the objects are uploaded
+		if b.config.EnableWebsite {
+			website = b.configuredWebsite()
+		}
+
+		if website == nil {
+			if b.config.RootRedirect != "" {
+				return status.Errorf(codes.FailedPrecondition, "root_redirect requires website hosting to be enabled on bucket %q", b.config.BucketName)
+			}
+
+			websiteDisabled = true
+		}
+
+		redirects := b.redirectObjects()
+		if b.config.RootRedirect != "" {
+			o, err := b.rootRedirect(ctx, s3.New(sess), website)
+			if err != nil {
+				return err
+			}
+
+			if o != nil {
+				redirects = append(redirects, *o)
+			}
+		}
+
+		for _, o := range redirects {
+			if keys[*o.Object.Key] {
+				return status.Errorf(codes.InvalidArgument, "redirect %q conflicts with a file in the artifact", *o.Object.Key)
+			}
+
+			keys[*o.Object.Key] = true
+			objects = append(objects, o)
+		}
+	}
+
+	if b.config.LockKey != "" && keys[b.config.LockKey] {
+		return status.Errorf(codes.InvalidArgument, "lock_key %q conflicts with a file in the artifact", b.config.LockKey)
+	}
+
+	if b.config.ManifestKey != "" && keys[b.config.ManifestKey] {
+		return status.Errorf(codes.InvalidArgument, "manifest_key %q conflicts with a file in the artifact", b.config.ManifestKey)
+	}
+
+	if b.config.LatestPointerKey != "" && keys[b.config.LatestPointerKey] {
+		return status.Errorf(codes.InvalidArgument, "latest_pointer_key %q conflicts with a file in the artifact", b.config.LatestPointerKey)
+	}
+
+	if b.config.WriteDeploySummary && keys[b.deploySummaryKey()] {
+		return status.Errorf(codes.InvalidArgument, "deploy_summary_key %q conflicts with a file in the artifact", b.deploySummaryKey())
+	}
+
+	if b.keyTemplate != nil {
+		b.keyPrefix, keys, err = b.applyKeyTemplate(objects)
+		if err != nil {
+			return err
+		}
+
+		log.Info("rendered key_template", "prefix", b.keyPrefix)
+	}
+
+	if b.config.AtomicSwap {
+		// Missing pages are redirected to the fallback, which would loop if
+		// it were missing too
+		if !keys[b.swapFallback()] {
+			return status.Errorf(codes.FailedPrecondition, "atomic_swap requires %q in the artifact", b.swapFallback())
+		}
+
+		live, err := b.livePrefix(ctx, s3.New(sess))
+		if err != nil {
+			return awsutil.Error(codes.FailedPrecondition, err, "unable to read website configuration of bucket %q", b.config.BucketName)
+		}
+
+		b.swapTo = b.generationPrefix()
+		keys = prefixObjects(objects, b.swapTo)
+
+		result.Prefix = b.swapTo
+		result.PreviousPrefix = live
+	}
+
+	step.Done()
+
+	if websiteDisabled {
+		warn(sg, "Bucket %q does not have website hosting enabled, redirects will not take effect until it is", b.config.BucketName)
+	}
+
+	if b.config.CleanupIncompleteUploads {
+		step = sg.Add("Aborting incomplete multipart uploads...")
+		defer step.Abort()
+
+		n, err := b.abortIncompleteUploads(ctx, s3.New(sess), keys, metrics.start)
+		if err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to abort incomplete multipart uploads")
+		}
+
+		step.Update("Aborted %d incomplete multipart uploads", n)
+		step.Done()
+
+		if n > 0 {
+			log.Info("aborted incomplete multipart uploads", "count", n)
+			warn(sg, "A lifecycle rule with AbortIncompleteMultipartUpload on bucket %q removes incomplete uploads without a deploy", b.config.BucketName)
+		}
+	}
+
+	if b.rules.hasOnlyOnCreate() {
+		step = sg.Add("Checking for existing objects of only_on_create rules...")
+		defer step.Abort()
+
+		n, err := b.keepExistingHeaders(ctx, s3.New(sess), objects)
+		if err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to look up existing objects")
+		}
+
+		step.Update("Kept the existing headers of %d objects", n)
+		step.Done()
+	}
+
+	var next *manifest
+	if b.config.ManifestKey != "" {
+		step = sg.Add("Comparing with the previous deploy...")
+		defer step.Abort()
+
+		previous, err := b.loadManifest(ctx, s3.New(sess))
+		if err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to load manifest")
+		}
+
+		total := len(objects)
+		objects, next, err = changedObjects(objects, previous)
+		if err != nil {
+			return err
+		}
+		metrics.skipped = total - len(objects)
+
+		if previous == nil {
+			step.Update("No previous manifest found, uploading all %d objects", total)
+		} else {
+			step.Update("Skipping %d unchanged of %d objects", total-len(objects), total)
+		}
+
+		step.Done()
+	}
+
+	if b.config.SkipUnchanged {
+		step = sg.Add("Checking for unchanged objects...")
+		defer step.Abort()
+
+		total := len(objects)
+		objects, err = b.skipUnchanged(ctx, s3.New(sess), objects)
+		if err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to compare objects with the bucket")
+		}
+		metrics.skipped += total - len(objects)
+
+		step.Update("Skipping %d unchanged of %d objects", total-len(objects), total)
+		step.Done()
+	}
+
+	if b.config.PreserveMetadata {
+		step = sg.Add("Preserving unchanged objects...")
+		defer step.Abort()
+
+		total := len(objects)
+		var preserved int
+		objects, preserved, err = b.preserveUnchanged(ctx, s3.New(sess), objects)
+		if err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to preserve unchanged objects")
+		}
+		metrics.skipped += preserved
+
+		step.Update("Copied %d unchanged of %d objects in place", preserved, total)
+		step.Done()
+	}
+
+	var pruned []string
+	if b.config.Prune && b.pruneOrder() == pruneOrderBefore {
+		pruned, err = b.prune(ctx, log, sg, sess, keys, result.PreviousPrefix)
+		if err != nil {
+			return err
+		}
+
+		metrics.pruned = len(pruned)
+	}
+
+	objects, ifAbsent := b.splitIfAbsent(objects)
+
+	step = sg.Add("Uploading %d objects...", len(objects)+len(ifAbsent))
+	defer step.Abort()
+
+	metrics.planned = len(objects) + len(ifAbsent)
+
+	if err := b.uploadObjects(ctx, uploader, objects); err != nil {
+		metrics.addUploads(uploadedObjects(objects, err))
+		return err
+	}
+	metrics.addUploads(objects)
+
+	// changed are the keys whose content changed, for invalidation
+	changed := append(objectKeys(objects), pruned...)
+
+	var skippedAbsent int
+	if len(ifAbsent) > 0 {
+		step.Update("Uploading objects which don't exist yet...")
+
+		uploaded, err := b.putIfAbsent(ctx, s3.New(sess), ifAbsent)
+		metrics.addUploads(uploaded)
+		if err != nil {
+			return err
+		}
+		changed = append(changed, objectKeys(uploaded)...)
+
+		skippedAbsent = len(ifAbsent) - len(uploaded)
+		metrics.skipped += skippedAbsent
+	}
+
+	// The manifest is only written once all objects were uploaded, so a
+	// failed deploy is retried in full next time.
+	var manifestVersionID string
+	if next != nil {
+		step.Update("Storing manifest...")
+
+		manifestVersionID, err = b.storeManifest(ctx, s3.New(sess), next)
+		if err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to store manifest")
+		}
+	}
+
+	if len(ifAbsent) > 0 {
+		step.Update("Uploaded %d objects, skipped %d of %d upload_if_absent objects which already exist",
+			metrics.uploaded, skippedAbsent, len(ifAbsent))
+	} else {
+		step.Update("Uploaded %d objects", metrics.uploaded)
+	}
+	step.Done()
+
+	// The swap is the single change that makes the new generation live, so
+	// it happens as soon as it has been uploaded
+	if b.config.AtomicSwap {
+		step = sg.Add("Swapping the website to %s...", b.swapTo)
+		defer step.Abort()
+
+		if err := b.enableWebsite(ctx, s3.New(sess)); err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to swap the website of bucket %q", b.config.BucketName)
+		}
+
+		result.Url = "http://" + awsutil.WebsiteEndpoint(b.config.BucketName, b.config.Region)
+
+		step.Update("Website at %s now serves %s", result.Url, b.swapTo)
+		step.Done()
+	}
+
+	if b.config.Prune && b.pruneOrder() == pruneOrderAfter {
+		stale, err := b.prune(ctx, log, sg, sess, keys, result.PreviousPrefix)
+		if err != nil {
+			return err
+		}
+
+		metrics.pruned = len(stale)
+		changed = append(changed, stale...)
+	}
+
+	if versioned && b.versioningBehavior() == versioningPurgeNoncurrent {
+		step = sg.Add("Purging noncurrent object versions...")
+		defer step.Abort()
+
+		n, err := b.purgeNoncurrent(ctx, s3.New(sess))
+		if err != nil {
+			return err
+		}
+
+		step.Update("Purged %d noncurrent object versions", n)
+		step.Done()
+	}
+
+	// The pointer is updated last, once the deploy it points at is complete.
+	if b.config.LatestPointerKey != "" {
+		step = sg.Add("Updating %s...", b.config.LatestPointerKey)
+		defer step.Abort()
+
+		if err := b.storeLatestPointer(ctx, s3.New(sess), manifestVersionID); err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to update latest_pointer_key %q", b.config.LatestPointerKey)
+		}
+
+		step.Update("Updated %s to deployment %s", b.config.LatestPointerKey, b.templateData.DeploymentID)
+		step.Done()
+	}
+
+	return b.finishDeploy(ctx, log, sg, sess, result, state, metrics, changed)
+}
+
+// finishDeploy enables website hosting, invalidates the CloudFront
+// distribution and writes the deploy summary once the objects are in
+// place, and records the bucket as the deployment's resource. changed are
+// the keys uploaded or deleted.
+func (b *Platform) finishDeploy(
+	ctx context.Context,
+	log hclog.Logger,
+	sg terminal.StepGroup,
+	sess *session.Session,
+	result *Deployment,
+	state *Resource_Bucket,
+	metrics *deployMetrics,
+	changed []string,
+) error {
+	var step terminal.Step
+	if b.config.EnableWebsite && !b.config.AtomicSwap {
+		step = sg.Add("Enabling website hosting...")
+		defer step.Abort()
+
+		if err := b.enableWebsite(ctx, s3.New(sess)); err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to enable website hosting on bucket %q", b.config.BucketName)
+		}
+
+		result.Url = "http://" + awsutil.WebsiteEndpoint(b.config.BucketName, b.config.Region)
+
+		step.Update("Website available at %s", result.Url)
+		step.Done()
+	}
+
+	if b.config.CloudFrontDistributionID != "" {
+		step = sg.Add("Invalidating CloudFront distribution %s...", b.config.CloudFrontDistributionID)
+		defer step.Abort()
+
+		paths := b.invalidationPaths(changed)
+		if len(paths) == 0 {
+			step.Update("Nothing changed, skipping invalidation")
+		} else {
+			id, err := b.invalidate(ctx, sess, paths)
+			if err != nil {
+				return awsutil.Error(codes.Internal, err, "unable to invalidate CloudFront distribution %q", b.config.CloudFrontDistributionID)
+			}
+
+			log.Info("created invalidation", "id", id, "paths", len(paths))
+			step.Update("Created invalidation %s of %d paths", id, len(paths))
+		}
+		step.Done()
+	}
+
+	// The summary is written last, so it only ever describes a complete
+	// deploy
+	if b.config.WriteDeploySummary {
+		step = sg.Add("Writing deploy summary %s...", b.deploySummaryKey())
+		defer step.Abort()
+
+		if err := b.storeDeploySummary(ctx, s3.New(sess), metrics); err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to write deploy summary %q", b.deploySummaryKey())
+		}
+
+		step.Update("Wrote deploy summary %s", b.deploySummaryKey())
+		step.Done()
+	}
+
+	state.Name = b.config.BucketName
+	state.Region = b.config.Region
+
+	return nil
+}
+
+// warn adds a step to sg showing a warning.
+func warn(sg terminal.StepGroup, format string, args ...interface{}) {
+	s := sg.Add(format, args...)
+	s.Status(terminal.StatusWarn)
+	s.Done()
+}
+
+func (b *Platform) resourceBucketStatus(
+	ctx context.Context,
+	state *Resource_Bucket,
+	sr *resource.StatusResponse,
+) error {
+	report := &sdk.StatusReport_Resource{
+		Name:                state.Name,
+		Platform:            "s3",
+		CategoryDisplayHint: sdk.ResourceCategoryDisplayHint_STORAGE,
+	}
+	sr.Resources = append(sr.Resources, report)
+
+	sess, err := b.sessionConfig(state.Region).Session()
+	if err != nil {
+		return err
+	}
+
+	_, err = s3.New(sess).HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(state.Name),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
+			report.Health = sdk.StatusReport_MISSING
+			report.HealthMessage = "bucket does not exist"
+			return nil
+		}
+
+		report.Health = sdk.StatusReport_UNKNOWN
+		report.HealthMessage = fmt.Sprintf("unable to check bucket: %s", awsutil.Describe(err))
+		return nil
+	}
+
+	report.Health = sdk.StatusReport_READY
+	report.HealthMessage = "bucket exists"
+
+	return nil
+}
+
+// uploadInput builds the upload of data.
+func (b *Platform) uploadInput(key string, data []byte) *s3manager.UploadInput {
+	body := bytes.NewReader(data)
+
+	// Reading a bytes.Reader can't fail
+	d, _ := b.digestBody(body, body.Size())
+
+	return b.bodyUploadInput(key, body, d)
+}
+
+// bodyUploadInput builds the upload of a file from the artifact, whose
+// contents d was read from body by digestBody.
+func (b *Platform) bodyUploadInput(key string, body io.ReadSeeker, d bodyDigest) *s3manager.UploadInput {
+	contentType := b.contentType(key, d.head)
+
+	in := &s3manager.UploadInput{
+		Key:          aws.String(key),
+		Bucket:       aws.String(b.config.BucketName),
+		RequestPayer: b.requestPayer(),
+		Body:         body,
+		ContentType:  optionalString(contentType),
+		CacheControl: b.cacheControl(key, contentType),
+		StorageClass: b.storageClass(key),
+		Tagging:      awsutil.ObjectTagging(b.config.ResourceTags),
+
+		ContentLanguage: b.headerValue(key, "Content-Language", func(r Rule) string { return r.ContentLanguage }),
+		ContentEncoding: b.headerValue(key, "Content-Encoding", func(r Rule) string { return r.ContentEncoding }),
+
+		ContentDisposition: b.headerValue(key, "Content-Disposition", nil),
+		Metadata:           b.withGitMetadata(b.objectMetadata(key)),
+	}
+	b.setAccess(in, key)
+
+	if d.md5 != nil {
+		in.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(d.md5))
+	}
+	setChecksum(in, b.config.ChecksumAlgorithm, d.checksum)
+
+	return in
+}
+
+// ruleValue returns the field of the first rule matching key, or nil when
+// no rule sets it.
+func (b *Platform) ruleValue(key string, field func(Rule) string) *string {
+	if v, ok := b.rules.value(key, field); ok {
+		return aws.String(v)
+	}
+
+	return nil
+}
+
+// headerValue returns header for key from the headers file or the rules,
+// in the order of HeadersFilePrecedence, or nil when neither sets it. A
+// nil field means no rule can set the header.
+func (b *Platform) headerValue(key, header string, field func(Rule) string) *string {
+	if v, ok := b.headerOverride(key, header); ok {
+		return aws.String(v)
+	}
+
+	if field != nil {
+		if v := b.ruleValue(key, field); v != nil {
+			return v
+		}
+	}
+
+	if v, ok := b.headerDefault(key, header); ok {
+		return aws.String(v)
+	}
+
+	return nil
+}
+
+// requestPayer returns the x-amz-request-payer value for object requests,
+// or nil unless RequestPayer is set.
+func (b *Platform) requestPayer() *string {
+	if b.config.RequestPayer {
+		return aws.String(s3.RequestPayerRequester)
+	}
+
+	return nil
+}
+
+// sessionConfig returns the options of AWS sessions for region.
+func (b *Platform) sessionConfig(region string) awsutil.SessionConfig {
+	return awsutil.SessionConfig{
+		Region:                region,
+		MinTLSVersion:         b.config.MinTLSVersion,
+		Endpoints:             b.config.EndpointResolver,
+		SharedConfigFile:      b.config.SharedConfigFile,
+		SharedCredentialsFile: b.config.SharedCredentialsFile,
+		Profile:               b.config.Profile,
+		CABundle:              b.config.CABundle,
+		InsecureSkipVerify:    b.config.InsecureSkipVerify,
+	}
+}
+
+// stripPrefix removes StripPrefix from key. It reports false when key is
+// not under the prefix, in which case it is returned unchanged.
+func (b *Platform) stripPrefix(key string) (string, bool) {
+	prefix := strings.Trim(b.config.StripPrefix, "/")
+	if prefix == "" {
+		return key, true
+	}
+
+	if key == prefix {
+		return "", true
+	}
+
+	if !strings.HasPrefix(key, prefix+"/") {
+		return key, false
+	}
+
+	return strings.TrimPrefix(key, prefix+"/"), true
+}
+
+// acl returns the canned ACL for key.
+func (b *Platform) acl(key string) string {
+	if acl, ok := b.rules.value(key, func(r Rule) string { return r.ACL }); ok {
+		return acl
+	}
+
+	if acl, ok := b.dirRuleValue(key, func(r DirRule) string { return r.ACL }); ok {
+		return acl
+	}
+
+	if b.config.ACL != "" {
+		return b.config.ACL
+	}
+
+	if b.file.ACL != "" {
+		return b.file.ACL
+	}
+
+	return "public-read"
+}
+
+// storageClass returns the storage class for key, or nil to use the bucket's
+// default.
+func (b *Platform) storageClass(key string) *string {
+	if class := b.ruleValue(key, func(r Rule) string { return r.StorageClass }); class != nil {
+		return class
+	}
+
+	if b.config.StorageClass != "" {
+		return aws.String(b.config.StorageClass)
+	}
+
+	return nil
+}
+
+// checkAccelerate ensures Transfer Acceleration is enabled on the bucket so
+// uploads fail fast with a clear message rather than on the first object.
+func (b *Platform) checkAccelerate(ctx context.Context, sess *session.Session) error {
+	// The accelerate endpoint can't be used to query the bucket's own
+	// acceleration status, so use a regular client for the check.
+	svc := s3.New(sess, &aws.Config{S3UseAccelerate: aws.Bool(false)})
+
+	out, err := svc.GetBucketAccelerateConfigurationWithContext(ctx, &s3.GetBucketAccelerateConfigurationInput{
+		Bucket: aws.String(b.config.BucketName),
+	})
+	if err != nil {
+		return awsutil.Error(codes.FailedPrecondition, err, "unable to read transfer acceleration status of bucket %q", b.config.BucketName)
+	}
+
+	if aws.StringValue(out.Status) != s3.BucketAccelerateStatusEnabled {
+		return status.Errorf(codes.FailedPrecondition, "transfer acceleration is not enabled on bucket %q", b.config.BucketName)
+	}
+
+	return nil
+}
+
+// optionalString returns nil for an empty string so the corresponding
+// header is omitted from the request.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return aws.String(s)
 }
@@ -0,0 +1,159 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// deployFileName is the file in the artifact root declaring deploy rules
+// next to the site source. It is read before the upload and not uploaded.
+const deployFileName = ".waypoint-s3.yaml"
+
+// deployFile are the rules read from deployFileName. Every option set in
+// the deploy stanza takes precedence over the file.
+type deployFile struct {
+	ACL          string            `yaml:"acl"`
+	CacheControl string            `yaml:"cache_control"`
+	ContentTypes map[string]string `yaml:"content_types"`
+	DirRules     []deployFileRule  `yaml:"dir_rules"`
+}
+
+// deployFileRule is a dir_rule declared in deployFileName.
+type deployFileRule struct {
+	Prefix       string `yaml:"prefix"`
+	CacheControl string `yaml:"cache_control"`
+	ContentType  string `yaml:"content_type"`
+	ACL          string `yaml:"acl"`
+}
+
+// loadDeployFile reads deployFileName from the artifact root, if present,
+// and merges its rules under the configured ones. It is called at the
+// start of every deploy, so rules of a previous artifact never linger.
+func (p *Platform) loadDeployFile(root string) error {
+	p.file = deployFile{}
+	p.fileCacheControl = nil
+
+	// The configured rules were validated in ConfigSet
+	p.dirRules, _ = compileDirRules(p.config.DirRules)
+
+	f, err := os.Open(filepath.Join(root, deployFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "unable to read %s: %s", deployFileName, err)
+	}
+	defer f.Close()
+
+	var file deployFile
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return status.Errorf(codes.InvalidArgument, "invalid %s: %s", deployFileName, err)
+	}
+
+	if err := p.mergeDeployFile(file); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid %s: %s", deployFileName, err)
+	}
+
+	return nil
+}
+
+// mergeDeployFile validates file like the matching deploy options and
+// merges it under them.
+func (p *Platform) mergeDeployFile(file deployFile) error {
+	if file.ACL != "" && !validACL(file.ACL) {
+		return fmt.Errorf("acl must be one of %s", strings.Join(cannedACLs, ", "))
+	}
+
+	if err := validateContentTypes(file.ContentTypes); err != nil {
+		return fmt.Errorf("content_types: %s", err)
+	}
+	file.ContentTypes = lowerKeys(file.ContentTypes)
+
+	rules := make([]DirRule, len(file.DirRules))
+	for i, r := range file.DirRules {
+		rules[i] = DirRule{
+			Prefix:       r.Prefix,
+			CacheControl: r.CacheControl,
+			ContentType:  r.ContentType,
+			ACL:          r.ACL,
+		}
+	}
+
+	rules, err := compileDirRules(rules)
+	if err != nil {
+		return fmt.Errorf("dir_rules: %s", err)
+	}
+
+	if p.config.Grants != nil {
+		if file.ACL != "" {
+			return errors.New("acl can't be combined with the grants of the deploy stanza")
+		}
+
+		for _, r := range rules {
+			if r.ACL != "" {
+				return fmt.Errorf("acl of dir_rule %q can't be combined with the grants of the deploy stanza", r.Prefix)
+			}
+		}
+	}
+
+	if file.CacheControl != "" {
+		tmpl, err := parseCacheControl(file.CacheControl)
+		if err != nil {
+			return fmt.Errorf("cache_control: %s", err)
+		}
+
+		p.fileCacheControl = tmpl
+	}
+
+	p.file = file
+	p.dirRules = mergeDirRules(p.dirRules, rules)
+
+	return nil
+}
+
+// mergeDirRules returns the compiled rules of both lists, sorted longest
+// prefix first. Fields of rules with the same prefix are merged, with the
+// rule in configured winning over the rule in file.
+func mergeDirRules(configured, file []DirRule) []DirRule {
+	byPrefix := map[string]int{}
+	out := append([]DirRule(nil), configured...)
+	for i, r := range out {
+		byPrefix[r.Prefix] = i
+	}
+
+	for _, r := range file {
+		i, ok := byPrefix[r.Prefix]
+		if !ok {
+			out = append(out, r)
+			continue
+		}
+
+		if out[i].CacheControl == "" {
+			out[i].CacheControl = r.CacheControl
+		}
+		if out[i].ContentType == "" {
+			out[i].ContentType = r.ContentType
+		}
+		if out[i].ACL == "" {
+			out[i].ACL = r.ACL
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return len(out[i].Prefix) > len(out[j].Prefix)
+	})
+
+	return out
+}
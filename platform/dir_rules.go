@@ -0,0 +1,88 @@
+package platform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DirRule sets headers for every object under a directory.
+type DirRule struct {
+	// Prefix is the directory the rule applies to, e.g. "/assets/"
+	Prefix string `hcl:"prefix,label"`
+
+	CacheControl string `hcl:"cache_control,optional"`
+	ContentType  string `hcl:"content_type,optional"`
+	ACL          string `hcl:"acl,optional"`
+}
+
+// cannedACLs are the canned ACLs objects can be uploaded with.
+var cannedACLs = []string{
+	"private",
+	"public-read",
+	"public-read-write",
+	"authenticated-read",
+	"aws-exec-read",
+	"bucket-owner-read",
+	"bucket-owner-full-control",
+}
+
+func validACL(acl string) bool {
+	for _, a := range cannedACLs {
+		if a == acl {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compileDirRules validates the rules and returns them with normalized
+// prefixes, sorted longest prefix first.
+func compileDirRules(rules []DirRule) ([]DirRule, error) {
+	out := make([]DirRule, 0, len(rules))
+	seen := map[string]bool{}
+
+	for _, r := range rules {
+		if r.ACL != "" && !validACL(r.ACL) {
+			return nil, fmt.Errorf("%q: acl must be one of %s", r.Prefix, strings.Join(cannedACLs, ", "))
+		}
+
+		// Keys have no leading slash and a directory prefix must end in one
+		// so "/app" doesn't also match "application.js"
+		r.Prefix = strings.TrimPrefix(r.Prefix, "/")
+		if r.Prefix != "" && !strings.HasSuffix(r.Prefix, "/") {
+			r.Prefix += "/"
+		}
+
+		if seen[r.Prefix] {
+			return nil, fmt.Errorf("%q is declared more than once", r.Prefix)
+		}
+		seen[r.Prefix] = true
+
+		out = append(out, r)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return len(out[i].Prefix) > len(out[j].Prefix)
+	})
+
+	return out, nil
+}
+
+// dirRuleValue returns the value of the longest prefix rule matching key
+// which sets field. Each header is resolved separately, so a rule for "/"
+// can set the ACL while a rule for "/assets/" sets the Cache-Control.
+func (p *Platform) dirRuleValue(key string, field func(DirRule) string) (string, bool) {
+	for _, r := range p.dirRules {
+		if !strings.HasPrefix(key, r.Prefix) {
+			continue
+		}
+
+		if v := field(r); v != "" {
+			return v, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,115 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// objectError is the failure of an operation on a single object.
+type objectError struct {
+	Key string
+	Err error
+}
+
+// partialFailure is returned when an operation on many objects failed for
+// some of them. It lists every failed key rather than only the first.
+type partialFailure struct {
+	// Op describes the operation, e.g. "delete"
+	Op string
+
+	// Total is the number of objects the operation was attempted on
+	Total int
+
+	Errors []objectError
+}
+
+// maxListedErrors bounds how many failed keys are included in the message.
+const maxListedErrors = 10
+
+func (e *partialFailure) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "failed to %s %d of %d objects", e.Op, len(e.Errors), e.Total)
+
+	for i, oe := range e.Errors {
+		if i == maxListedErrors {
+			fmt.Fprintf(&sb, "; and %d more", len(e.Errors)-i)
+			break
+		}
+
+		fmt.Fprintf(&sb, "; %s: %s", oe.Key, oe.Err)
+	}
+
+	return sb.String()
+}
+
+// GRPCStatus allows the error to be returned from a component function.
+func (e *partialFailure) GRPCStatus() *status.Status {
+	return status.New(codes.Internal, e.Error())
+}
+
+// uploadError converts the error of a batch upload into a partialFailure
+// listing each failed key along with the AWS request IDs.
+func uploadError(err error, total int) error {
+	batchErr, ok := err.(*s3manager.BatchError)
+	if !ok {
+		return awsutil.Error(codes.Internal, err, "unable to upload objects")
+	}
+
+	failed := make([]objectError, len(batchErr.Errors))
+	for i, e := range batchErr.Errors {
+		msg := awsutil.Describe(e.OrigErr)
+		if isBadDigest(e.OrigErr) {
+			msg = "checksum mismatch, the object was corrupted before reaching S3: " + msg
+		}
+
+		failed[i] = objectError{
+			Key: aws.StringValue(e.Key),
+			Err: errors.New(msg),
+		}
+	}
+
+	return &partialFailure{Op: "upload", Total: total, Errors: failed}
+}
+
+// uploadedObjects returns the objects which were uploaded despite err, the
+// error of uploadObjects. Unless err lists the failed keys none of them
+// are known to have been.
+func uploadedObjects(objects []s3manager.BatchUploadObject, err error) []s3manager.BatchUploadObject {
+	var pf *partialFailure
+	if !errors.As(err, &pf) {
+		return nil
+	}
+
+	failed := map[string]bool{}
+	for _, oe := range pf.Errors {
+		failed[oe.Key] = true
+	}
+
+	var uploaded []s3manager.BatchUploadObject
+	for _, o := range objects {
+		if !failed[aws.StringValue(o.Object.Key)] {
+			uploaded = append(uploaded, o)
+		}
+	}
+
+	return uploaded
+}
+
+// isBadDigest reports whether S3 rejected an upload because its content
+// didn't match the Content-MD5 sent with it.
+func isBadDigest(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code() == "BadDigest"
+	}
+
+	return false
+}
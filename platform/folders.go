@@ -0,0 +1,68 @@
+package platform
+
+import (
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// folderContentType is the Content-Type of folder placeholders, as used by
+// tools which treat a bucket like a filesystem.
+const folderContentType = "application/x-directory"
+
+// addFolderPlaceholders adds a zero-byte "<dir>/" object for each of dirs,
+// the paths of the artifact's directories, or with
+// FolderPlaceholdersEmptyOnly only for those with no object under them.
+// Directories outside StripPrefix get none.
+func (b *Platform) addFolderPlaceholders(result *artifactObjects, dirs []string) error {
+	var keys []string
+	for _, d := range dirs {
+		key, err := sanitizeKey(d)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid directory name in artifact: %s", err)
+		}
+
+		key, ok := b.stripPrefix(key)
+		if !ok || key == "" {
+			continue
+		}
+
+		if b.config.LowercaseKeys {
+			key = strings.ToLower(key)
+		}
+
+		keys = append(keys, key+"/")
+	}
+
+	// nonEmpty holds every directory with an object or a directory under it
+	nonEmpty := map[string]bool{}
+	addParents := func(key string) {
+		for dir := path.Dir(strings.TrimSuffix(key, "/")); dir != "." && !nonEmpty[dir+"/"]; dir = path.Dir(dir) {
+			nonEmpty[dir+"/"] = true
+		}
+	}
+	for key := range result.keys {
+		addParents(key)
+	}
+	for _, key := range keys {
+		addParents(key)
+	}
+
+	for _, key := range keys {
+		if result.keys[key] || (b.config.FolderPlaceholdersEmptyOnly && nonEmpty[key]) {
+			continue
+		}
+
+		in := b.uploadInput(key, nil)
+		in.ContentType = aws.String(folderContentType)
+
+		result.keys[key] = true
+		result.objects = append(result.objects, s3manager.BatchUploadObject{Object: in})
+	}
+
+	return nil
+}
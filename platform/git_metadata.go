@@ -0,0 +1,141 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// The user metadata names the Git metadata is stored under, served as
+// x-amz-meta-<name>.
+const (
+	metaGitSHA      = "git-sha"
+	metaGitBranch   = "git-branch"
+	metaBuildNumber = "build-number"
+)
+
+// Environment variables of common CI systems holding the Git metadata, in
+// the order they are tried: GitHub Actions, GitLab CI, CircleCI,
+// Buildkite, Jenkins and Travis CI.
+var (
+	gitSHAEnv      = []string{"GITHUB_SHA", "CI_COMMIT_SHA", "CIRCLE_SHA1", "BUILDKITE_COMMIT", "GIT_COMMIT", "TRAVIS_COMMIT"}
+	gitBranchEnv   = []string{"GITHUB_HEAD_REF", "GITHUB_REF_NAME", "CI_COMMIT_REF_NAME", "CIRCLE_BRANCH", "BUILDKITE_BRANCH", "GIT_BRANCH", "TRAVIS_BRANCH"}
+	buildNumberEnv = []string{"GITHUB_RUN_NUMBER", "CI_PIPELINE_IID", "CIRCLE_BUILD_NUM", "BUILDKITE_BUILD_NUMBER", "BUILD_NUMBER", "TRAVIS_BUILD_NUMBER"}
+)
+
+// gitMetadata returns the Git metadata of the deploy. Each value is taken
+// from the first CI environment variable set, and the commit and branch
+// fall back to the Git repository in dir. Values which can't be found are
+// left out.
+func gitMetadata(ctx context.Context, dir string) map[string]*string {
+	meta := map[string]*string{}
+
+	set := func(name, value string) {
+		if value != "" {
+			meta[name] = aws.String(value)
+		}
+	}
+
+	sha := firstEnv(gitSHAEnv)
+	if sha == "" {
+		sha = gitOutput(ctx, dir, "rev-parse", "HEAD")
+	}
+	set(metaGitSHA, sha)
+
+	branch := firstEnv(gitBranchEnv)
+	if branch == "" {
+		branch = gitOutput(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD")
+	}
+
+	// A detached HEAD has no branch
+	if branch != "HEAD" {
+		set(metaGitBranch, branch)
+	}
+
+	set(metaBuildNumber, firstEnv(buildNumberEnv))
+
+	return meta
+}
+
+// firstEnv returns the value of the first of names which is set.
+func firstEnv(names []string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// gitOutput runs git with args in dir and returns its trimmed output, or ""
+// when it fails, e.g. as dir isn't a repository or git isn't installed.
+func gitOutput(ctx context.Context, dir string, args ...string) string {
+	if dir == "" {
+		return ""
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	return string(bytes.TrimSpace(out))
+}
+
+// withGitMetadata returns metadata with the Git metadata added, unless
+// GitMetadataKey limits it to the marker object. Names metadata already
+// sets are kept.
+func (b *Platform) withGitMetadata(metadata map[string]*string) map[string]*string {
+	if !b.config.GitMetadata || len(b.gitMetadata) == 0 || b.config.GitMetadataKey != "" {
+		return metadata
+	}
+
+	out := make(map[string]*string, len(metadata)+len(b.gitMetadata))
+	for k, v := range b.gitMetadata {
+		out[k] = v
+	}
+	for k, v := range metadata {
+		out[k] = v
+	}
+
+	return out
+}
+
+// gitMetadataMarker returns the upload of the GitMetadataKey object
+// carrying the Git metadata. Its body lists the metadata too, so it
+// changes with it and isn't skipped as unchanged.
+func (b *Platform) gitMetadataMarker() s3manager.BatchUploadObject {
+	names := make([]string, 0, len(b.gitMetadata))
+	for name := range b.gitMetadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&body, "%s=%s\n", name, aws.StringValue(b.gitMetadata[name]))
+	}
+
+	in := b.uploadInput(b.gitMetadataKey(), body.Bytes())
+	in.ContentType = aws.String("text/plain; charset=utf-8")
+	in.Metadata = b.gitMetadata
+
+	return s3manager.BatchUploadObject{Object: in}
+}
+
+// gitMetadataKey returns the key of the marker object, or "" when the Git
+// metadata is stored on every object.
+func (b *Platform) gitMetadataKey() string {
+	return strings.TrimPrefix(b.config.GitMetadataKey, "/")
+}
@@ -0,0 +1,83 @@
+package platform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// globRule is a compiled glob.
+type globRule struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// globRules is a list of globs.
+type globRules []globRule
+
+// compileGlobList compiles a list of glob patterns which carry no value.
+func compileGlobList(patterns []string) (globRules, error) {
+	rules := make(globRules, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := globToRegexp(p)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, globRule{pattern: p, re: re})
+	}
+
+	return rules, nil
+}
+
+// matches reports whether any rule matches key.
+func (r globRules) matches(key string) bool {
+	for _, rule := range r {
+		if rule.re.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globToRegexp converts a glob matched against object keys to a regular
+// expression. "*" matches within a single path segment, "**" matches across
+// segments and "?" matches a single character. A leading "/" is ignored as
+// keys are relative to the bucket.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	p := strings.TrimPrefix(pattern, "/")
+	if p == "" {
+		return nil, fmt.Errorf("glob pattern %q is empty", pattern)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '*':
+			if i+1 < len(p) && p[i+1] == '*' {
+				i++
+
+				// "**/" also matches no directories at all
+				if i+1 < len(p) && p[i+1] == '/' {
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	sb.WriteString("$")
+
+	return regexp.Compile(sb.String())
+}
@@ -0,0 +1,196 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+)
+
+// Grants gives explicit grantees permissions on uploaded objects instead of
+// a canned ACL. Each grantee has the form "id=<canonical user id>",
+// "uri=<group uri>" or "emailAddress=<email>".
+type Grants struct {
+	Read        []string `hcl:"read,optional"`
+	ReadACP     []string `hcl:"read_acp,optional"`
+	WriteACP    []string `hcl:"write_acp,optional"`
+	FullControl []string `hcl:"full_control,optional"`
+}
+
+// granteeTypes are the grantee types accepted by the x-amz-grant-* headers.
+var granteeTypes = []string{"id", "uri", "emailAddress"}
+
+// validate checks the grantees are in the expected form.
+func (g *Grants) validate() error {
+	for _, list := range [][]string{g.Read, g.ReadACP, g.WriteACP, g.FullControl} {
+		for _, grantee := range list {
+			t, v, ok := cut(grantee, "=")
+			if !ok || v == "" || !validGranteeType(t) {
+				return fmt.Errorf("grantee %q must have the form <type>=<value> with a type of %s",
+					grantee, strings.Join(granteeTypes, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+func validGranteeType(t string) bool {
+	for _, gt := range granteeTypes {
+		if gt == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// grantHeader formats grantees for an x-amz-grant-* header, returning nil
+// when there are none.
+func grantHeader(grantees []string) *string {
+	if len(grantees) == 0 {
+		return nil
+	}
+
+	parts := make([]string, len(grantees))
+	for i, grantee := range grantees {
+		t, v, _ := cut(grantee, "=")
+		parts[i] = fmt.Sprintf("%s=%q", t, v)
+	}
+
+	return aws.String(strings.Join(parts, ", "))
+}
+
+// setAccess applies either the explicit grants or the canned ACL for key to
+// an upload. S3 rejects requests which set both. Private objects always get
+// the private ACL when PrivateACL is set. Nothing is set when the bucket has
+// ACLs disabled.
+func (p *Platform) setAccess(in *s3manager.UploadInput, key string) {
+	// Buckets with ACLs disabled reject any request which sets one
+	if p.aclsDisabled {
+		return
+	}
+
+	if p.config.PrivateACL && p.privateGlobs.matches(key) {
+		in.ACL = aws.String("private")
+		return
+	}
+
+	if g := p.config.Grants; g != nil {
+		in.GrantRead = grantHeader(g.Read)
+		in.GrantReadACP = grantHeader(g.ReadACP)
+		in.GrantWriteACP = grantHeader(g.WriteACP)
+		in.GrantFullControl = grantHeader(g.FullControl)
+		return
+	}
+
+	in.ACL = aws.String(p.acl(key))
+}
+
+// cut slices s around the first instance of sep.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
+
+// checkBucketOwner warns when the bucket is owned by another account than
+// the credentials in use. Objects uploaded across accounts stay owned by
+// the uploader unless they grant the bucket owner full control, which
+// locks the bucket owner out of them. The check is best effort: the calls
+// it needs are often not permitted, in which case it is skipped.
+func (p *Platform) checkBucketOwner(ctx context.Context, log hclog.Logger, sg terminal.StepGroup, svc *s3.S3) {
+	bucketACL, err := svc.GetBucketAclWithContext(ctx, &s3.GetBucketAclInput{
+		Bucket: aws.String(p.config.BucketName),
+	})
+	if err != nil {
+		log.Debug("unable to read bucket owner, skipping cross-account check", "error", awsutil.Describe(err))
+		return
+	}
+
+	buckets, err := svc.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		log.Debug("unable to read caller's canonical id, skipping cross-account check", "error", awsutil.Describe(err))
+		return
+	}
+
+	if bucketACL.Owner == nil || buckets.Owner == nil {
+		return
+	}
+
+	if aws.StringValue(bucketACL.Owner.ID) != aws.StringValue(buckets.Owner.ID) {
+		warn(sg, "Bucket %q is owned by another account, set acl = \"bucket-owner-full-control\" so the bucket owner can access the uploaded objects",
+			p.config.BucketName)
+	}
+}
+
+// respectOwnershipControls reports whether ACLs are left out of uploads to
+// buckets which have them disabled, which is the default.
+func (p *Platform) respectOwnershipControls() bool {
+	return p.config.RespectOwnershipControls == nil || *p.config.RespectOwnershipControls
+}
+
+// checkOwnershipControls sets aclsDisabled when the bucket's object
+// ownership is "BucketOwnerEnforced", the default for new buckets, under
+// which uploads that set an ACL or grants fail. Buckets without ownership
+// controls, or whose controls can't be read, keep using ACLs.
+func (p *Platform) checkOwnershipControls(ctx context.Context, log hclog.Logger, sg terminal.StepGroup, svc *s3.S3) {
+	out, err := svc.GetBucketOwnershipControlsWithContext(ctx, &s3.GetBucketOwnershipControlsInput{
+		Bucket: aws.String(p.config.BucketName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "OwnershipControlsNotFoundError" {
+			log.Debug("unable to read bucket ownership controls, uploading with ACLs", "error", awsutil.Describe(err))
+		}
+		return
+	}
+
+	if out.OwnershipControls == nil {
+		return
+	}
+
+	for _, rule := range out.OwnershipControls.Rules {
+		if aws.StringValue(rule.ObjectOwnership) != "BucketOwnerEnforced" {
+			continue
+		}
+
+		p.aclsDisabled = true
+
+		if p.configuresACLs() {
+			warn(sg, "Bucket %q has ACLs disabled, uploading objects without the configured ACLs and grants", p.config.BucketName)
+		}
+		log.Info("bucket has ACLs disabled, uploading objects without ACLs", "bucket", p.config.BucketName)
+
+		return
+	}
+}
+
+// configuresACLs reports whether any ACL or grant is set explicitly.
+func (p *Platform) configuresACLs() bool {
+	if p.config.ACL != "" || p.config.Grants != nil || p.config.PrivateACL {
+		return true
+	}
+
+	for _, r := range p.config.DirRules {
+		if r.ACL != "" {
+			return true
+		}
+	}
+
+	for _, r := range p.config.Rules {
+		if r.ACL != "" {
+			return true
+		}
+	}
+
+	return false
+}
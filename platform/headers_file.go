@@ -0,0 +1,268 @@
+package platform
+
+import (
+	"bufio"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// headersFileConfig is the HeadersFilePrecedence where the deploy
+	// stanza wins over the headers file, the default
+	headersFileConfig = "config"
+
+	// headersFileFirst is the HeadersFilePrecedence where the headers file
+	// wins over the deploy stanza
+	headersFileFirst = "file"
+)
+
+// metadataHeaderPrefix is the prefix of the headers stored as user
+// metadata, the only custom headers S3 serves.
+const metadataHeaderPrefix = "X-Amz-Meta-"
+
+// headersFileHeaders are the headers the headers file can set besides
+// user metadata.
+var headersFileHeaders = map[string]bool{
+	"Cache-Control":       true,
+	"Content-Type":        true,
+	"Content-Encoding":    true,
+	"Content-Language":    true,
+	"Content-Disposition": true,
+}
+
+// headersFileRule is a path pattern of the headers file with the headers
+// declared under it.
+type headersFileRule struct {
+	re      *regexp.Regexp
+	headers map[string]string
+}
+
+// headersFileRules are the rules of the headers file in the order they
+// are declared.
+type headersFileRules []headersFileRule
+
+// value returns header of the first rule matching key which sets it.
+func (r headersFileRules) value(key, header string) (string, bool) {
+	for _, rule := range r {
+		if !rule.re.MatchString(key) {
+			continue
+		}
+
+		if v, ok := rule.headers[header]; ok {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+// metadata returns the user metadata of key, each entry taken from the
+// first matching rule which sets it.
+func (r headersFileRules) metadata(key string) map[string]*string {
+	var out map[string]*string
+	for _, rule := range r {
+		if !rule.re.MatchString(key) {
+			continue
+		}
+
+		for h, v := range rule.headers {
+			if !strings.HasPrefix(h, metadataHeaderPrefix) {
+				continue
+			}
+
+			name := strings.ToLower(strings.TrimPrefix(h, metadataHeaderPrefix))
+			if out == nil {
+				out = map[string]*string{}
+			}
+			if _, ok := out[name]; !ok {
+				out[name] = aws.String(v)
+			}
+		}
+	}
+
+	return out
+}
+
+// loadHeadersFile reads HeadersFile from the artifact root, if set and
+// present. It returns a warning for every header S3 can't serve, which is
+// ignored so files written for other hosts still work.
+func (p *Platform) loadHeadersFile(root string) ([]string, error) {
+	p.headers = nil
+
+	if p.config.HeadersFile == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(p.config.HeadersFile)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to read %s: %s", p.config.HeadersFile, err)
+	}
+	defer f.Close()
+
+	rules, warnings, err := parseHeadersFile(bufio.NewScanner(f), p.indexDocument())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %s", p.config.HeadersFile, err)
+	}
+
+	p.headers = rules
+
+	return warnings, nil
+}
+
+// parseHeadersFile parses the Netlify style headers file format: a path
+// pattern on an unindented line followed by indented "Name: value" lines.
+// Every error is reported with its line number.
+func parseHeadersFile(sc *bufio.Scanner, index string) (headersFileRules, []string, error) {
+	var (
+		rules    headersFileRules
+		warnings []string
+		problems []string
+	)
+
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			re, err := headersPatternToRegexp(trimmed, index)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %s", n, err))
+			}
+
+			rules = append(rules, headersFileRule{re: re, headers: map[string]string{}})
+			continue
+		}
+
+		if len(rules) == 0 {
+			problems = append(problems, fmt.Sprintf("line %d: header %q is not under a path", n, trimmed))
+			continue
+		}
+
+		i := strings.Index(trimmed, ":")
+		if i <= 0 {
+			problems = append(problems, fmt.Sprintf("line %d: %q must have the form \"Name: value\"", n, trimmed))
+			continue
+		}
+
+		name := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(trimmed[:i]))
+		value := strings.TrimSpace(trimmed[i+1:])
+
+		switch {
+		case strings.ContainsAny(name, " \t"):
+			problems = append(problems, fmt.Sprintf("line %d: %q is not a valid header name", n, name))
+		case value == "":
+			problems = append(problems, fmt.Sprintf("line %d: %s must not be empty", n, name))
+		case name == "Content-Language" && !validLanguage(value):
+			problems = append(problems, fmt.Sprintf("line %d: Content-Language must be a language tag such as \"en\" or \"pt-BR\"", n))
+		case name == metadataHeaderPrefix:
+			problems = append(problems, fmt.Sprintf("line %d: %s must be followed by a metadata name", n, name))
+		case !headersFileHeaders[name] && !strings.HasPrefix(name, metadataHeaderPrefix):
+			warnings = append(warnings, fmt.Sprintf("line %d: S3 can't serve %s, it is ignored", n, name))
+		default:
+			// Repeated headers are joined as they would be in a response
+			if prev, ok := rules[len(rules)-1].headers[name]; ok {
+				value = prev + ", " + value
+			}
+			rules[len(rules)-1].headers[name] = value
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return rules, warnings, nil
+}
+
+// headersPatternToRegexp converts a path pattern of the headers file to a
+// regular expression matched against keys. "*" matches any characters,
+// including "/", ":name" matches a single path segment and a trailing "/"
+// matches the index document of the directory.
+func headersPatternToRegexp(pattern, index string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pattern)
+	}
+
+	p := strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(p, "/") || p == "" {
+		p += index
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case c == '*':
+			sb.WriteString(".*")
+		case c == ':' && (i == 0 || p[i-1] == '/'):
+			j := i + 1
+			for j < len(p) && p[j] != '/' {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("path %q has a placeholder without a name", pattern)
+			}
+
+			sb.WriteString("[^/]+")
+			i = j - 1
+		case c == ' ' || c == '\t':
+			return nil, fmt.Errorf("path %q must not contain whitespace", pattern)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	sb.WriteString("$")
+
+	return regexp.Compile(sb.String())
+}
+
+// headersFileWins reports whether the headers file takes precedence over
+// the deploy stanza.
+func (p *Platform) headersFileWins() bool {
+	return p.config.HeadersFilePrecedence == headersFileFirst
+}
+
+// headerOverride returns header for key from the asset meta file, or from
+// the headers file when it takes precedence over the deploy stanza.
+func (p *Platform) headerOverride(key, header string) (string, bool) {
+	if v, ok := p.assetMeta.value(key, header); ok {
+		return v, true
+	}
+
+	if !p.headersFileWins() {
+		return "", false
+	}
+
+	return p.headers.value(key, header)
+}
+
+// headerDefault returns header from the headers file for key when the
+// deploy stanza takes precedence over the file, to be used once no option
+// sets it.
+func (p *Platform) headerDefault(key, header string) (string, bool) {
+	if p.headersFileWins() {
+		return "", false
+	}
+
+	return p.headers.value(key, header)
+}
@@ -0,0 +1,94 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+)
+
+// splitIfAbsent separates the objects matching UploadIfAbsent from the
+// ones which are always uploaded.
+func (b *Platform) splitIfAbsent(objects []s3manager.BatchUploadObject) (always, ifAbsent []s3manager.BatchUploadObject) {
+	if len(b.uploadIfAbsent) == 0 {
+		return objects, nil
+	}
+
+	for _, o := range objects {
+		if b.uploadIfAbsent.matches(aws.StringValue(o.Object.Key)) {
+			ifAbsent = append(ifAbsent, o)
+		} else {
+			always = append(always, o)
+		}
+	}
+
+	return always, ifAbsent
+}
+
+// putIfAbsent uploads each object with a conditional PutObject which only
+// succeeds when the key doesn't exist yet. It returns the objects which
+// were uploaded, the others already existed or failed.
+func (b *Platform) putIfAbsent(ctx context.Context, svc *s3.S3, objects []s3manager.BatchUploadObject) ([]s3manager.BatchUploadObject, error) {
+	var uploaded []s3manager.BatchUploadObject
+	var failed []objectError
+
+	for _, o := range objects {
+		in := o.Object
+
+		// Only the seekable bodies built by bodyUploadInput are supported,
+		// PutObject needs to be able to seek to sign the request
+		body, ok := in.Body.(io.ReadSeeker)
+		if !ok {
+			failed = append(failed, objectError{Key: aws.StringValue(in.Key), Err: errors.New("body is not seekable")})
+			continue
+		}
+
+		_, err := svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:                  in.Bucket,
+			Key:                     in.Key,
+			RequestPayer:            in.RequestPayer,
+			Body:                    body,
+			ACL:                     in.ACL,
+			CacheControl:            in.CacheControl,
+			ContentType:             in.ContentType,
+			ContentLanguage:         in.ContentLanguage,
+			ContentEncoding:         in.ContentEncoding,
+			ContentDisposition:      in.ContentDisposition,
+			ContentMD5:              in.ContentMD5,
+			ChecksumAlgorithm:       in.ChecksumAlgorithm,
+			ChecksumCRC32:           in.ChecksumCRC32,
+			ChecksumCRC32C:          in.ChecksumCRC32C,
+			ChecksumSHA1:            in.ChecksumSHA1,
+			ChecksumSHA256:          in.ChecksumSHA256,
+			StorageClass:            in.StorageClass,
+			Tagging:                 in.Tagging,
+			GrantRead:               in.GrantRead,
+			GrantReadACP:            in.GrantReadACP,
+			GrantWriteACP:           in.GrantWriteACP,
+			GrantFullControl:        in.GrantFullControl,
+			WebsiteRedirectLocation: in.WebsiteRedirectLocation,
+			Metadata:                in.Metadata,
+		}, withHeader("If-None-Match", "*"))
+
+		switch {
+		case err == nil:
+			uploaded = append(uploaded, o)
+		case isPreconditionFailed(err):
+			// The object exists, leave it alone
+		case isBadDigest(err):
+			failed = append(failed, objectError{Key: aws.StringValue(in.Key), Err: errors.New("checksum mismatch, the object was corrupted before reaching S3: " + awsutil.Describe(err))})
+		default:
+			failed = append(failed, objectError{Key: aws.StringValue(in.Key), Err: errors.New(awsutil.Describe(err))})
+		}
+	}
+
+	if len(failed) > 0 {
+		return uploaded, &partialFailure{Op: "upload", Total: len(objects), Errors: failed}
+	}
+
+	return uploaded, nil
+}
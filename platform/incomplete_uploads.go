@@ -0,0 +1,63 @@
+package platform
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// abortIncompleteUploads aborts the multipart uploads of keys, or of any
+// generation with AtomicSwap, left behind by earlier deploys, so their
+// parts stop being billed. Only uploads initiated before the deploy
+// started are aborted. It returns the number of uploads aborted.
+func (b *Platform) abortIncompleteUploads(ctx context.Context, svc *s3.S3, keys map[string]bool, started time.Time) (int, error) {
+	var prefix string
+	if b.config.AtomicSwap {
+		prefix = b.swapRoot() + "/"
+	}
+
+	var stale []*s3.MultipartUpload
+	err := svc.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(b.config.BucketName),
+	}, func(page *s3.ListMultipartUploadsOutput, _ bool) bool {
+		for _, u := range page.Uploads {
+			key := aws.StringValue(u.Key)
+			if !keys[key] && (prefix == "" || !strings.HasPrefix(key, prefix)) {
+				continue
+			}
+
+			if !aws.TimeValue(u.Initiated).Before(started) {
+				continue
+			}
+
+			stale = append(stale, u)
+		}
+
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, u := range stale {
+		_, err := svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:       aws.String(b.config.BucketName),
+			RequestPayer: b.requestPayer(),
+			Key:          u.Key,
+			UploadId:     u.UploadId,
+		})
+		// The upload may have been completed or aborted since it was listed
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+			continue
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(stale), nil
+}
@@ -0,0 +1,95 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// maxInvalidationPaths is the number of paths from which a single "/*"
+// invalidation is created instead. CloudFront allows up to 3000 paths in
+// progress at a time, and bills each path beyond the free tier, while a
+// wildcard counts as one.
+const maxInvalidationPaths = 3000
+
+// invalidateAll is the path invalidating every object of a distribution.
+const invalidateAll = "/*"
+
+// invalidationPaths returns the paths to invalidate after a deploy which
+// uploaded or deleted keys. Unless InvalidateChangedOnly is set, or every
+// key changed with AtomicSwap, everything is invalidated. An index
+// document also invalidates the directory URL serving it.
+func (b *Platform) invalidationPaths(keys []string) []string {
+	if !b.config.InvalidateChangedOnly || b.config.AtomicSwap {
+		return []string{invalidateAll}
+	}
+
+	index := b.indexDocument()
+
+	set := map[string]bool{}
+	for _, key := range keys {
+		set[invalidationPath(key)] = true
+
+		if path.Base(key) == index {
+			set[invalidationPath(strings.TrimSuffix(key, index))] = true
+		}
+	}
+
+	if len(set) > maxInvalidationPaths {
+		return []string{invalidateAll}
+	}
+
+	paths := make([]string, 0, len(set))
+	for p := range set {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// invalidationPath returns the URL path of key. "*" is escaped as
+// CloudFront treats it as a wildcard.
+func invalidationPath(key string) string {
+	p := (&url.URL{Path: "/" + key}).EscapedPath()
+	return strings.ReplaceAll(p, "*", "%2A")
+}
+
+// invalidate creates an invalidation of paths on CloudFrontDistributionID
+// and returns its ID. It doesn't wait for the invalidation to complete.
+func (b *Platform) invalidate(ctx context.Context, sess *session.Session, paths []string) (string, error) {
+	out, err := cloudfront.New(sess).CreateInvalidationWithContext(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(b.config.CloudFrontDistributionID),
+		InvalidationBatch: &cloudfront.InvalidationBatch{
+			CallerReference: aws.String(fmt.Sprintf("waypoint-%s-%d", b.templateData.DeploymentID, time.Now().UnixNano())),
+			Paths: &cloudfront.Paths{
+				Items:    aws.StringSlice(paths),
+				Quantity: aws.Int64(int64(len(paths))),
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.Invalidation.Id), nil
+}
+
+// objectKeys returns the keys of objects.
+func objectKeys(objects []s3manager.BatchUploadObject) []string {
+	keys := make([]string, len(objects))
+	for i, o := range objects {
+		keys[i] = aws.StringValue(o.Object.Key)
+	}
+
+	return keys
+}
@@ -0,0 +1,281 @@
+package platform
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	pruneSourceList      = "list"
+	pruneSourceInventory = "inventory"
+)
+
+// defaultInventoryMaxAge is the age of the newest usable inventory report
+// when PruneInventory.MaxAge is not set. Reports are delivered daily.
+const defaultInventoryMaxAge = 48 * time.Hour
+
+// PruneInventory locates the S3 Inventory reports of the bucket used by
+// prune_source = "inventory".
+type PruneInventory struct {
+	// Bucket receives the inventory reports.
+	Bucket string `hcl:"bucket"`
+
+	// Region is the region of Bucket, defaults to the deploy's region.
+	Region string `hcl:"region,optional"`
+
+	// Prefix is where the reports of one inventory configuration are
+	// delivered, "<destination prefix>/<source bucket>/<configuration ID>".
+	// The newest report under it is used.
+	Prefix string `hcl:"prefix,optional"`
+
+	// ManifestKey is the manifest.json of a specific report, used instead
+	// of looking up the newest one under Prefix.
+	ManifestKey string `hcl:"manifest_key,optional"`
+
+	// MaxAge is the age beyond which a report is refused, e.g. "72h".
+	MaxAge string `hcl:"max_age,optional"`
+}
+
+// Validate checks that exactly one of Prefix and ManifestKey is set.
+func (i *PruneInventory) Validate() error {
+	if (i.Prefix == "") == (i.ManifestKey == "") {
+		return errors.New("requires exactly one of prefix and manifest_key")
+	}
+
+	if i.MaxAge != "" {
+		if d, err := time.ParseDuration(i.MaxAge); err != nil || d <= 0 {
+			return errors.New("max_age must be a positive duration such as \"72h\"")
+		}
+	}
+
+	return nil
+}
+
+func (i *PruneInventory) maxAge() time.Duration {
+	if d, err := time.ParseDuration(i.MaxAge); err == nil {
+		return d
+	}
+
+	return defaultInventoryMaxAge
+}
+
+// pruneSource returns PruneSource, defaulting to "list".
+func (p *Platform) pruneSource() string {
+	if p.config.PruneSource == "" {
+		return pruneSourceList
+	}
+
+	return p.config.PruneSource
+}
+
+// inventoryManifest is the manifest.json of an inventory report.
+type inventoryManifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	CreationTimestamp string `json:"creationTimestamp"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+// reportDate matches the directory of a report under the inventory prefix,
+// such as "2021-10-12T01-00Z/".
+var reportDate = regexp.MustCompile(`/\d{4}-\d{2}-\d{2}T\d{2}-\d{2}Z/$`)
+
+// inventoryStaleKeys lists the objects in the newest inventory report of the
+// bucket which are not in keep, and returns when the report was taken. svc
+// must be in the region of the inventory bucket.
+func (p *Platform) inventoryStaleKeys(ctx context.Context, svc *s3.S3, keep map[string]bool) ([]string, time.Time, error) {
+	inv := p.config.PruneInventory
+
+	m, err := p.loadInventoryManifest(ctx, svc)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if m.SourceBucket != p.config.BucketName {
+		return nil, time.Time{}, fmt.Errorf("inventory report is for bucket %q, not %q", m.SourceBucket, p.config.BucketName)
+	}
+
+	ms, err := strconv.ParseInt(m.CreationTimestamp, 10, 64)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("inventory report has an invalid creationTimestamp %q", m.CreationTimestamp)
+	}
+
+	taken := time.Unix(0, ms*int64(time.Millisecond))
+	if age := time.Since(taken); age > inv.maxAge() {
+		return nil, taken, fmt.Errorf("newest inventory report is from %s, older than max_age %s",
+			taken.UTC().Format(time.RFC3339), inv.maxAge())
+	}
+
+	if m.FileFormat != "CSV" {
+		return nil, taken, fmt.Errorf("inventory report is in %s format, only CSV is supported", m.FileFormat)
+	}
+
+	columns := map[string]int{}
+	for i, c := range strings.Split(m.FileSchema, ",") {
+		columns[strings.TrimSpace(c)] = i
+	}
+
+	if _, ok := columns["Key"]; !ok {
+		return nil, taken, fmt.Errorf("inventory report schema %q has no Key field", m.FileSchema)
+	}
+
+	stale := []string{}
+	for _, f := range m.Files {
+		err := p.readInventoryFile(ctx, svc, f.Key, columns, func(key string) {
+			if !keep[key] {
+				stale = append(stale, key)
+			}
+		})
+		if err != nil {
+			return nil, taken, fmt.Errorf("unable to read inventory file %q: %w", f.Key, err)
+		}
+	}
+
+	return stale, taken, nil
+}
+
+// loadInventoryManifest reads ManifestKey, or the manifest of the newest
+// complete report under Prefix.
+func (p *Platform) loadInventoryManifest(ctx context.Context, svc *s3.S3) (*inventoryManifest, error) {
+	inv := p.config.PruneInventory
+
+	candidates := []string{inv.ManifestKey}
+	if inv.ManifestKey == "" {
+		var err error
+		candidates, err = p.inventoryReports(ctx, svc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A report which is still being delivered has no manifest yet, so fall
+	// back to the previous one
+	for _, key := range candidates {
+		out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(inv.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey && inv.ManifestKey == "" {
+				continue
+			}
+
+			return nil, err
+		}
+
+		var m inventoryManifest
+		err = json.NewDecoder(out.Body).Decode(&m)
+		out.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inventory manifest %q is not valid JSON: %s", key, err)
+		}
+
+		return &m, nil
+	}
+
+	return nil, fmt.Errorf("no inventory report found under s3://%s/%s", inv.Bucket, inv.Prefix)
+}
+
+// inventoryReports returns the manifest keys of the reports under Prefix,
+// newest first.
+func (p *Platform) inventoryReports(ctx context.Context, svc *s3.S3) ([]string, error) {
+	inv := p.config.PruneInventory
+	prefix := strings.Trim(inv.Prefix, "/") + "/"
+
+	var dirs []string
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(inv.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, cp := range page.CommonPrefixes {
+			if dir := aws.StringValue(cp.Prefix); reportDate.MatchString(dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The date format sorts chronologically
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	keys := make([]string, len(dirs))
+	for i, dir := range dirs {
+		keys[i] = path.Join(dir, "manifest.json")
+	}
+
+	return keys, nil
+}
+
+// readInventoryFile calls fn with the key of every current object listed in
+// the gzipped CSV file at key.
+func (p *Platform) readInventoryFile(ctx context.Context, svc *s3.S3, key string, columns map[string]int, fn func(string)) error {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(p.config.PruneInventory.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	gz, err := gzip.NewReader(out.Body)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	r := csv.NewReader(gz)
+	r.FieldsPerRecord = len(columns)
+	r.ReuseRecord = true
+
+	isLatest, versioned := columns["IsLatest"]
+	isDeleteMarker := columns["IsDeleteMarker"]
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Reports including all versions list noncurrent versions and
+		// delete markers too
+		if versioned && (record[isLatest] != "true" || record[isDeleteMarker] == "true") {
+			continue
+		}
+
+		// Keys are URL-encoded in CSV reports
+		k, err := url.QueryUnescape(record[columns["Key"]])
+		if err != nil {
+			return fmt.Errorf("invalid key %q: %s", record[columns["Key"]], err)
+		}
+
+		fn(k)
+	}
+}
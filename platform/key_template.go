@@ -0,0 +1,146 @@
+package platform
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// keyTemplateData are the variables available to KeyTemplate.
+type keyTemplateData struct {
+	// Path is the key the object would have without KeyTemplate
+	Path string
+
+	// DeploymentID and Sequence identify the Waypoint deployment
+	DeploymentID string
+	Sequence     uint64
+
+	App       string
+	Project   string
+	Workspace string
+}
+
+// parseKeyTemplate compiles a KeyTemplate and checks it places every path
+// under the same prefix, so the keys of a deploy can't collide or escape
+// it.
+func parseKeyTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("key_template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := keyTemplateData{
+		DeploymentID: "01FZ0Q9X4M2V",
+		Sequence:     1,
+		App:          "app",
+		Project:      "project",
+		Workspace:    "default",
+	}
+
+	if _, err := keyTemplatePrefix(tmpl, sample); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// keyTemplatePrefix returns the prefix tmpl places every path under with
+// data, checking it renders a valid key for paths at and below the root.
+func keyTemplatePrefix(tmpl *template.Template, data keyTemplateData) (string, error) {
+	var prefix string
+	for i, p := range []string{"index.html", "assets/app.js"} {
+		data.Path = p
+
+		key, err := renderKeyTemplate(tmpl, data)
+		if err != nil {
+			return "", err
+		}
+
+		if !strings.HasSuffix(key, p) {
+			return "", fmt.Errorf("must end with {{.Path}}, rendered %q for %q", key, p)
+		}
+
+		pre := strings.TrimSuffix(key, p)
+		if i > 0 && pre != prefix {
+			return "", fmt.Errorf("must render the same prefix for every path, rendered %q and %q", prefix, pre)
+		}
+		prefix = pre
+
+		if _, err := sanitizeKey(key); err != nil {
+			return "", fmt.Errorf("must render a valid key: %s", err)
+		}
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		return "", fmt.Errorf("must separate {{.Path}} with a \"/\", rendered the prefix %q", prefix)
+	}
+
+	return prefix, nil
+}
+
+func renderKeyTemplate(tmpl *template.Template, data keyTemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// applyKeyTemplate moves objects to the keys KeyTemplate renders for them,
+// returning the prefix they share and their new keys.
+func (b *Platform) applyKeyTemplate(objects []s3manager.BatchUploadObject) (string, map[string]bool, error) {
+	data := keyTemplateData{
+		DeploymentID: b.templateData.DeploymentID,
+		Sequence:     b.templateData.Sequence,
+		App:          b.templateData.App,
+		Project:      b.templateData.Project,
+		Workspace:    b.templateData.Workspace,
+	}
+
+	prefix, err := keyTemplatePrefix(b.keyTemplate, data)
+	if err != nil {
+		return "", nil, status.Errorf(codes.InvalidArgument, "key_template %s", err)
+	}
+
+	keys := map[string]bool{}
+	for _, o := range objects {
+		data.Path = aws.StringValue(o.Object.Key)
+
+		key, err := renderKeyTemplate(b.keyTemplate, data)
+		if err != nil {
+			return "", nil, status.Errorf(codes.InvalidArgument, "key_template failed for %q: %s", data.Path, err)
+		}
+
+		if key != prefix+data.Path {
+			return "", nil, status.Errorf(codes.InvalidArgument, "key_template rendered %q for %q, outside the prefix %q", key, data.Path, prefix)
+		}
+
+		if len(key) > maxKeyLength {
+			return "", nil, status.Errorf(codes.InvalidArgument, "key_template rendered %q for %q, longer than %d bytes", key, data.Path, maxKeyLength)
+		}
+
+		o.Object.Key = aws.String(key)
+		keys[key] = true
+	}
+
+	return prefix, keys, nil
+}
+
+// withPrefix returns the keys which are under prefix.
+func withPrefix(keys []string, prefix string) []string {
+	var out []string
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, k)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,53 @@
+package platform
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxKeyLength is the longest key S3 accepts, in bytes.
+const maxKeyLength = 1024
+
+// keyDelimiters are the accepted values of KeyDelimiter.
+const keyDelimiters = `/\.-_!`
+
+// sanitizeKey turns the path of a file relative to the artifact root into
+// an object key. Separators are normalized to "/", including backslashes
+// in artifacts produced on Windows, and paths which are not valid keys or
+// could escape the root are rejected.
+func sanitizeKey(rel string) (string, error) {
+	key := strings.ReplaceAll(filepath.ToSlash(rel), `\`, "/")
+
+	if !utf8.ValidString(key) {
+		return "", fmt.Errorf("%q is not valid UTF-8", rel)
+	}
+
+	if len(key) > maxKeyLength {
+		return "", fmt.Errorf("%q is longer than %d bytes", rel, maxKeyLength)
+	}
+
+	if strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("%q is an absolute path", rel)
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		switch segment {
+		case "":
+			return "", fmt.Errorf("%q contains an empty path segment", rel)
+		case ".", "..":
+			return "", fmt.Errorf("%q contains a %q path segment", rel, segment)
+		}
+	}
+
+	// Control characters can't be represented in the XML of S3 responses
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("%q contains a control character", rel)
+		}
+	}
+
+	return key, nil
+}
@@ -0,0 +1,65 @@
+package platform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeKey(t *testing.T) {
+	cases := []struct {
+		name string
+		rel  string
+		want string
+
+		// err is part of the expected error, if any
+		err string
+	}{
+		{name: "file", rel: "index.html", want: "index.html"},
+		{name: "nested", rel: "assets/js/app.js", want: "assets/js/app.js"},
+		{name: "dots in names", rel: "a..b/.well-known/c.d", want: "a..b/.well-known/c.d"},
+		{name: "spaces and unicode", rel: "docs/über uns.html", want: "docs/über uns.html"},
+		{name: "backslashes", rel: `assets\js\app.js`, want: "assets/js/app.js"},
+		{name: "mixed separators", rel: `assets\js/app.js`, want: "assets/js/app.js"},
+		{name: "longest key", rel: strings.Repeat("a", maxKeyLength), want: strings.Repeat("a", maxKeyLength)},
+
+		{name: "parent", rel: "..", err: `contains a ".." path segment`},
+		{name: "leading parent", rel: "../secret", err: `contains a ".." path segment`},
+		{name: "inner parent", rel: "assets/../../secret", err: `contains a ".." path segment`},
+		{name: "backslash parent", rel: `assets\..\..\secret`, err: `contains a ".." path segment`},
+		{name: "current directory", rel: "./index.html", err: `contains a "." path segment`},
+		{name: "leading slash", rel: "/etc/passwd", err: "is an absolute path"},
+		{name: "leading backslash", rel: `\etc\passwd`, err: "is an absolute path"},
+		{name: "empty", rel: "", err: "contains an empty path segment"},
+		{name: "empty segment", rel: "assets//app.js", err: "contains an empty path segment"},
+		{name: "trailing slash", rel: "assets/", err: "contains an empty path segment"},
+		{name: "newline", rel: "index\n.html", err: "contains a control character"},
+		{name: "nul", rel: "index\x00.html", err: "contains a control character"},
+		{name: "delete", rel: "index\x7f.html", err: "contains a control character"},
+		{name: "invalid UTF-8", rel: "index\xff.html", err: "is not valid UTF-8"},
+		{name: "too long", rel: strings.Repeat("a", maxKeyLength+1), err: "is longer than 1024 bytes"},
+		{name: "too long in bytes", rel: strings.Repeat("é", maxKeyLength/2+1), err: "is longer than 1024 bytes"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := sanitizeKey(tc.rel)
+
+			if tc.err != "" {
+				if err == nil {
+					t.Fatalf("sanitizeKey(%q) = %q, want an error", tc.rel, got)
+				}
+				if !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("sanitizeKey(%q) error = %q, want it to contain %q", tc.rel, err, tc.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("sanitizeKey(%q) unexpected error: %s", tc.rel, err)
+			}
+			if got != tc.want {
+				t.Errorf("sanitizeKey(%q) = %q, want %q", tc.rel, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// latestPointer is the object written to LatestPointerKey, identifying the
+// deploy currently in the bucket.
+type latestPointer struct {
+	Version      int    `json:"version"`
+	DeploymentID string `json:"deployment_id"`
+	Sequence     uint64 `json:"sequence"`
+	Workspace    string `json:"workspace,omitempty"`
+
+	// ManifestKey is the manifest listing the deploy's objects.
+	// ManifestVersionID is set in versioned buckets, where it pins the
+	// manifest of this deploy even after later deploys overwrite it.
+	ManifestKey       string `json:"manifest_key"`
+	ManifestVersionID string `json:"manifest_version_id,omitempty"`
+
+	DeployedAt time.Time `json:"deployed_at"`
+}
+
+const latestPointerVersion = 1
+
+// storeLatestPointer writes the pointer to the deploy which just finished.
+// A single PUT replaces the previous pointer atomically, and it is never
+// cached so consumers always resolve the current deploy.
+func (p *Platform) storeLatestPointer(ctx context.Context, svc *s3.S3, manifestVersionID string) error {
+	data, err := json.Marshal(&latestPointer{
+		Version:           latestPointerVersion,
+		DeploymentID:      p.templateData.DeploymentID,
+		Sequence:          p.templateData.Sequence,
+		Workspace:         p.templateData.Workspace,
+		ManifestKey:       p.config.ManifestKey,
+		ManifestVersionID: manifestVersionID,
+		DeployedAt:        time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(p.config.BucketName),
+		RequestPayer: p.requestPayer(),
+		Key:          aws.String(p.config.LatestPointerKey),
+		Body:         bytes.NewReader(data),
+		ContentType:  aws.String("application/json"),
+		CacheControl: aws.String("no-cache"),
+	})
+	return err
+}
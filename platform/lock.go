@@ -0,0 +1,182 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultLockTTL is how long a deploy lock is honored when LockTTL is not
+// set. A lock older than this is assumed to belong to a crashed deploy.
+const defaultLockTTL = 15 * time.Minute
+
+// deployLock is the content of the lock object.
+type deployLock struct {
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// heldLock is a lock acquired by this deploy.
+type heldLock struct {
+	id   string
+	etag string
+}
+
+// withHeader returns a request option setting an HTTP header, used for the
+// conditional requests the SDK has no fields for.
+func withHeader(name, value string) request.Option {
+	return func(r *request.Request) {
+		r.HTTPRequest.Header.Set(name, value)
+	}
+}
+
+// lockTTL returns the configured lock TTL.
+func (p *Platform) lockTTL() time.Duration {
+	if p.config.LockTTL == "" {
+		return defaultLockTTL
+	}
+
+	// Validated in ConfigSet
+	d, _ := time.ParseDuration(p.config.LockTTL)
+	return d
+}
+
+// acquireLock creates the lock object with a conditional write, so exactly
+// one of several racing deploys succeeds. An expired lock is taken over,
+// conditional on it not having changed since it was read.
+func (p *Platform) acquireLock(ctx context.Context, svc *s3.S3) (*heldLock, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+
+	owner, _ := os.Hostname()
+	lock := deployLock{
+		ID:      hex.EncodeToString(idBytes),
+		Owner:   owner,
+		Expires: time.Now().Add(p.lockTTL()).UTC(),
+	}
+
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+
+	put := func(opt request.Option) (*s3.PutObjectOutput, error) {
+		return svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:       aws.String(p.config.BucketName),
+			RequestPayer: p.requestPayer(),
+			Key:          aws.String(p.config.LockKey),
+			Body:         bytes.NewReader(data),
+			ContentType:  aws.String("application/json"),
+		}, opt)
+	}
+
+	out, err := put(withHeader("If-None-Match", "*"))
+	if err == nil {
+		return &heldLock{id: lock.ID, etag: aws.StringValue(out.ETag)}, nil
+	}
+
+	if !isPreconditionFailed(err) {
+		return nil, awsutil.Error(codes.Internal, err, "unable to create deploy lock %q", p.config.LockKey)
+	}
+
+	// The lock exists, check whether it is still live
+	existing, etag, err := p.readLock(ctx, svc)
+	if err != nil {
+		return nil, awsutil.Error(codes.Internal, err, "unable to read deploy lock %q", p.config.LockKey)
+	}
+
+	if time.Now().Before(existing.Expires) {
+		return nil, status.Errorf(codes.Aborted,
+			"another deploy to bucket %q holds the lock %q (owner %q, expires %s)",
+			p.config.BucketName, p.config.LockKey, existing.Owner, existing.Expires.Format(time.RFC3339))
+	}
+
+	out, err = put(withHeader("If-Match", etag))
+	if err != nil {
+		if isPreconditionFailed(err) {
+			return nil, status.Errorf(codes.Aborted,
+				"another deploy to bucket %q took over the expired lock %q", p.config.BucketName, p.config.LockKey)
+		}
+
+		return nil, awsutil.Error(codes.Internal, err, "unable to take over expired deploy lock %q", p.config.LockKey)
+	}
+
+	return &heldLock{id: lock.ID, etag: aws.StringValue(out.ETag)}, nil
+}
+
+// readLock returns the current lock and its ETag.
+func (p *Platform) readLock(ctx context.Context, svc *s3.S3) (*deployLock, string, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:       aws.String(p.config.BucketName),
+		RequestPayer: p.requestPayer(),
+		Key:          aws.String(p.config.LockKey),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer out.Body.Close()
+
+	var lock deployLock
+	if err := json.NewDecoder(out.Body).Decode(&lock); err != nil {
+		// An unreadable lock can't be checked for expiry, so treat it as
+		// expired rather than blocking deploys forever
+		return &deployLock{}, aws.StringValue(out.ETag), nil
+	}
+
+	return &lock, aws.StringValue(out.ETag), nil
+}
+
+// releaseLock deletes the lock if it is still the one this deploy created.
+// It uses its own context so the lock is released even when the deploy was
+// cancelled.
+func (p *Platform) releaseLock(svc *s3.S3, held *heldLock) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(p.config.BucketName),
+		RequestPayer: p.requestPayer(),
+		Key:          aws.String(p.config.LockKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The lock expired and was taken over by another deploy
+	if aws.StringValue(head.ETag) != held.etag {
+		return nil
+	}
+
+	_, err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket:       aws.String(p.config.BucketName),
+		RequestPayer: p.requestPayer(),
+		Key:          aws.String(p.config.LockKey),
+	})
+	return err
+}
+
+// isPreconditionFailed reports whether a conditional request failed
+// because its condition did not hold.
+func isPreconditionFailed(err error) bool {
+	if rf, ok := err.(awserr.RequestFailure); ok {
+		return rf.StatusCode() == http.StatusPreconditionFailed
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// manifest records the checksum of every object uploaded by a deploy, so the
+// next deploy can work out what changed with a single request.
+type manifest struct {
+	Version int               `json:"version"`
+	Objects map[string]string `json:"objects"`
+}
+
+const manifestVersion = 1
+
+// loadManifest fetches the manifest of the previous deploy. It returns nil
+// when there is none, in which case everything is uploaded.
+func (p *Platform) loadManifest(ctx context.Context, svc *s3.S3) (*manifest, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:       aws.String(p.config.BucketName),
+		RequestPayer: p.requestPayer(),
+		Key:          aws.String(p.config.ManifestKey),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	var m manifest
+	if err := json.NewDecoder(out.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("manifest %q is not valid JSON: %s", p.config.ManifestKey, err)
+	}
+
+	// A manifest written by a different version of the plugin may not be
+	// comparable, so fall back to a full upload.
+	if m.Version != manifestVersion {
+		return nil, nil
+	}
+
+	return &m, nil
+}
+
+// storeManifest writes the manifest for the objects of this deploy. It
+// returns the manifest's version ID, which is empty unless the bucket is
+// versioned.
+func (p *Platform) storeManifest(ctx context.Context, svc *s3.S3, m *manifest) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(p.config.BucketName),
+		RequestPayer: p.requestPayer(),
+		Key:          aws.String(p.config.ManifestKey),
+		Body:         bytes.NewReader(data),
+		ContentType:  aws.String("application/json"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.VersionId), nil
+}
+
+// objectChecksum returns a checksum covering both the body and the settings
+// of an upload, so a change to e.g. its Cache-Control also counts as a
+// change. The body is rewound afterwards so it can still be uploaded.
+func objectChecksum(in *s3manager.UploadInput) (string, error) {
+	body, ok := in.Body.(io.ReadSeeker)
+	if !ok {
+		return "", fmt.Errorf("body of %q is not seekable", aws.StringValue(in.Key))
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	settings := *in
+	settings.Body = nil
+
+	meta, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	h.Write(meta)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// changedObjects builds the manifest for objects and returns those which
+// differ from the previous manifest.
+func changedObjects(objects []s3manager.BatchUploadObject, previous *manifest) ([]s3manager.BatchUploadObject, *manifest, error) {
+	current := &manifest{
+		Version: manifestVersion,
+		Objects: map[string]string{},
+	}
+
+	changed := []s3manager.BatchUploadObject{}
+	for _, o := range objects {
+		sum, err := objectChecksum(o.Object)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key := aws.StringValue(o.Object.Key)
+		current.Objects[key] = sum
+
+		if previous != nil && previous.Objects[key] == sum {
+			continue
+		}
+
+		changed = append(changed, o)
+	}
+
+	return changed, current, nil
+}
@@ -0,0 +1,219 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// defaultMetricsJob is the pushgateway job deploy metrics are grouped under
+// when Metrics.Job is not set.
+const defaultMetricsJob = "waypoint_s3_deploy"
+
+// Metrics publishes deploy metrics in the Prometheus text format.
+type Metrics struct {
+	// Textfile is written for node_exporter's textfile collector. It is
+	// replaced atomically so the collector never reads a partial file.
+	Textfile string `hcl:"textfile,optional"`
+
+	// Pushgateway is the URL of a Prometheus pushgateway, e.g.
+	// "http://pushgateway:9091".
+	Pushgateway string `hcl:"pushgateway,optional"`
+
+	// Job groups the metrics in the pushgateway, defaults to
+	// "waypoint_s3_deploy".
+	Job string `hcl:"job,optional"`
+}
+
+func (m *Metrics) validate() error {
+	if m.Textfile == "" && m.Pushgateway == "" {
+		return fmt.Errorf("requires textfile or pushgateway to be set")
+	}
+
+	if m.Pushgateway != "" {
+		u, err := url.Parse(m.Pushgateway)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("pushgateway must be an http or https URL")
+		}
+	}
+
+	return nil
+}
+
+// deployMetrics are collected during a deploy.
+type deployMetrics struct {
+	start    time.Time
+	uploaded int
+	bytes    int64
+	skipped  int
+	pruned   int
+
+	// planned is the number of objects the deploy set out to upload
+	planned int
+}
+
+// addUploads records uploaded objects.
+func (d *deployMetrics) addUploads(objects []s3manager.BatchUploadObject) {
+	d.uploaded += len(objects)
+
+	for _, o := range objects {
+		if size, ok := bodySize(o.Object.Body); ok {
+			d.bytes += size
+		}
+	}
+}
+
+// failureSummary describes how far a deploy which failed with err got, so
+// what was already changed in the bucket isn't lost behind the error.
+func (d *deployMetrics) failureSummary(err error) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Deploy failed after uploading %d of %d objects (%s)", d.uploaded, d.planned, formatBytes(d.bytes))
+
+	if d.pruned > 0 {
+		fmt.Fprintf(&sb, " and pruning %d", d.pruned)
+	}
+
+	var pf *partialFailure
+	if errors.As(err, &pf) && len(pf.Errors) > 0 {
+		fmt.Fprintf(&sb, ", failed to %s %s", pf.Op, pf.Errors[0].Key)
+
+		if n := len(pf.Errors) - 1; n > 0 {
+			fmt.Fprintf(&sb, " and %d more", n)
+		}
+	}
+
+	return sb.String()
+}
+
+// formatBytes renders n in binary units, e.g. "12.3 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// format renders the metrics in the Prometheus text exposition format.
+func (d *deployMetrics) format(bucket string, success bool) []byte {
+	var buf bytes.Buffer
+	labels := fmt.Sprintf("{bucket=%q}", bucket)
+
+	metric := func(name, typ, help string, value interface{}) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, typ)
+		fmt.Fprintf(&buf, "%s%s %v\n", name, labels, value)
+	}
+
+	successValue := 0
+	if success {
+		successValue = 1
+	}
+
+	metric("waypoint_s3_deploy_success", "gauge", "Whether the last deploy succeeded.", successValue)
+	metric("waypoint_s3_deploy_timestamp_seconds", "gauge", "Unix time the last deploy finished.", time.Now().Unix())
+	metric("waypoint_s3_deploy_duration_seconds", "gauge", "Duration of the last deploy.", time.Since(d.start).Seconds())
+	metric("waypoint_s3_deploy_objects_uploaded", "gauge", "Objects uploaded by the last deploy.", d.uploaded)
+	metric("waypoint_s3_deploy_bytes_uploaded", "gauge", "Bytes uploaded by the last deploy.", d.bytes)
+	metric("waypoint_s3_deploy_objects_skipped", "gauge", "Unchanged objects skipped by the last deploy.", d.skipped)
+	metric("waypoint_s3_deploy_objects_pruned", "gauge", "Stale objects deleted by the last deploy.", d.pruned)
+
+	return buf.Bytes()
+}
+
+// publishMetrics writes the deploy metrics to the configured destinations.
+func (b *Platform) publishMetrics(ctx context.Context, d *deployMetrics, success bool) error {
+	m := b.config.Metrics
+	data := d.format(b.config.BucketName, success)
+
+	if m.Textfile != "" {
+		if err := writeFileAtomic(m.Textfile, data); err != nil {
+			return fmt.Errorf("unable to write metrics textfile: %w", err)
+		}
+	}
+
+	if m.Pushgateway != "" {
+		if err := pushMetrics(ctx, m, b.config.BucketName, data); err != nil {
+			return fmt.Errorf("unable to push metrics: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// pushMetrics replaces the metrics of the job and bucket in the pushgateway.
+func pushMetrics(ctx context.Context, m *Metrics, bucket string, data []byte) error {
+	job := m.Job
+	if job == "" {
+		job = defaultMetricsJob
+	}
+
+	u := strings.TrimSuffix(m.Pushgateway, "/") +
+		"/metrics/job/" + url.PathEscape(job) +
+		"/bucket/" + url.PathEscape(bucket)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,288 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxCopySize is the largest object a single CopyObject request copies.
+const maxCopySize = 5 << 30
+
+// mirrorConcurrency is the number of objects copied from SourceBucket at a
+// time.
+const mirrorConcurrency = 16
+
+// mirrorObject is an object of SourceBucket and the key it is copied to.
+type mirrorObject struct {
+	source string
+	key    string
+	size   int64
+}
+
+// validateMirror checks SourceBucket isn't combined with options which
+// apply to the files of the artifact, which a mirror doesn't read.
+func validateMirror(c *DeployConfig) error {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"atomic_swap", c.AtomicSwap},
+		{"manifest_key", c.ManifestKey != ""},
+		{"latest_pointer_key", c.LatestPointerKey != ""},
+		{"skip_unchanged", c.SkipUnchanged},
+		{"preserve_metadata", c.PreserveMetadata},
+		{"key_template", c.KeyTemplate != ""},
+		{"strip_prefix", c.StripPrefix != ""},
+		{"generate_sri_manifest", c.GenerateSRIManifest},
+		{"check_mixed_content", c.CheckMixedContent},
+		{"git_metadata", c.GitMetadata},
+		{"default_files", len(c.DefaultFiles) > 0},
+		{"required_objects", len(c.RequiredObjects) > 0},
+		{"redirects", len(c.Redirects) > 0 || c.RootRedirect != ""},
+		{"prune_inventory", c.PruneInventory != nil},
+		{"asset_meta_file", c.AssetMetaFile != ""},
+	}
+
+	var set []string
+	for _, o := range conflicts {
+		if o.set {
+			set = append(set, o.name)
+		}
+	}
+
+	if len(set) > 0 {
+		return fmt.Errorf("can't be combined with %s", strings.Join(set, ", "))
+	}
+
+	if c.SourceBucket == c.BucketName && strings.Trim(c.SourcePrefix, "/") == "" {
+		return fmt.Errorf("must be another bucket than bucket_name unless source_prefix is set")
+	}
+
+	if c.Prune && c.SourceBucket == c.BucketName {
+		return fmt.Errorf("can't be the deploy's own bucket with prune, which would delete the source")
+	}
+
+	return nil
+}
+
+// sourcePrefix returns SourcePrefix as a key prefix ending in "/", or "".
+func (b *Platform) sourcePrefix() string {
+	prefix := strings.Trim(b.config.SourcePrefix, "/")
+	if prefix == "" {
+		return ""
+	}
+
+	return prefix + "/"
+}
+
+// sourceObjects lists the objects under SourcePrefix in SourceBucket, keyed
+// by their path below the prefix. Folder placeholders are skipped.
+func (b *Platform) sourceObjects(ctx context.Context, svc *s3.S3) ([]mirrorObject, error) {
+	prefix := b.sourcePrefix()
+
+	var objects []mirrorObject
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.config.SourceBucket),
+		Prefix: optionalString(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, o := range page.Contents {
+			source := aws.StringValue(o.Key)
+
+			key := strings.TrimPrefix(source, prefix)
+			if key == "" || strings.HasSuffix(key, "/") {
+				continue
+			}
+
+			objects = append(objects, mirrorObject{
+				source: source,
+				key:    key,
+				size:   aws.Int64Value(o.Size),
+			})
+		}
+
+		return true
+	})
+
+	return objects, err
+}
+
+// copyFromSource copies objects from SourceBucket into the bucket with up
+// to mirrorConcurrency requests at a time. It returns the keys copied
+// before the first failure, if any.
+func (b *Platform) copyFromSource(ctx context.Context, svc *s3.S3, objects []mirrorObject) ([]string, error) {
+	queue := make(chan mirrorObject)
+	go func() {
+		defer close(queue)
+
+		for _, o := range objects {
+			select {
+			case queue <- o:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu       sync.Mutex
+		copied   []string
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	for i := 0; i < mirrorConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for o := range queue {
+				err := b.copyObjectFromSource(ctx, svc, o)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					copied = append(copied, o.key)
+				case firstErr == nil:
+					firstErr = fmt.Errorf("%s: %w", o.source, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return copied, err
+	}
+
+	return copied, firstErr
+}
+
+// copyObjectFromSource copies o with its content type and metadata. A copy
+// doesn't keep the ACL, so the ACL or grants the deploy would upload the
+// key with are set instead.
+func (b *Platform) copyObjectFromSource(ctx context.Context, svc *s3.S3, o mirrorObject) error {
+	access := &s3manager.UploadInput{}
+	b.setAccess(access, o.key)
+
+	_, err := svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(b.config.BucketName),
+		Key:               aws.String(o.key),
+		CopySource:        aws.String((&url.URL{Path: b.config.SourceBucket + "/" + o.source}).EscapedPath()),
+		MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+		RequestPayer:      b.requestPayer(),
+		StorageClass:      b.storageClass(o.key),
+		ACL:               access.ACL,
+		GrantRead:         access.GrantRead,
+		GrantReadACP:      access.GrantReadACP,
+		GrantWriteACP:     access.GrantWriteACP,
+		GrantFullControl:  access.GrantFullControl,
+	})
+
+	return err
+}
+
+// mirror deploys by copying the objects under SourcePrefix in SourceBucket
+// into the bucket server-side, instead of uploading the artifact.
+func (b *Platform) mirror(
+	ctx context.Context,
+	log hclog.Logger,
+	sg terminal.StepGroup,
+	sess *session.Session,
+	result *Deployment,
+	state *Resource_Bucket,
+	metrics *deployMetrics,
+) error {
+	source := "s3://" + b.config.SourceBucket + "/" + b.sourcePrefix()
+
+	step := sg.Add("Listing %s...", source)
+	defer step.Abort()
+
+	region := b.config.SourceRegion
+	if region == "" {
+		region = b.config.Region
+	}
+
+	srcSess, err := b.sessionConfig(region).Session()
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "unable to create AWS session: %s", err)
+	}
+
+	objects, err := b.sourceObjects(ctx, s3.New(srcSess))
+	if err != nil {
+		return awsutil.Error(codes.FailedPrecondition, err, "unable to list %s", source)
+	}
+
+	if len(objects) == 0 {
+		return status.Errorf(codes.FailedPrecondition, "%s contains no objects", source)
+	}
+
+	keys := map[string]bool{}
+	var size int64
+	for _, o := range objects {
+		if o.size > maxCopySize {
+			return status.Errorf(codes.FailedPrecondition, "%s is %s, larger than the %s a copy supports",
+				o.source, formatBytes(o.size), formatBytes(maxCopySize))
+		}
+
+		keys[o.key] = true
+		size += o.size
+	}
+
+	step.Update("Found %d objects (%s) in %s", len(objects), formatBytes(size), source)
+	step.Done()
+
+	var pruned []string
+	if b.config.Prune && b.pruneOrder() == pruneOrderBefore {
+		pruned, err = b.prune(ctx, log, sg, sess, keys, "")
+		if err != nil {
+			return err
+		}
+
+		metrics.pruned = len(pruned)
+	}
+
+	step = sg.Add("Copying %d objects...", len(objects))
+	defer step.Abort()
+
+	metrics.planned = len(objects)
+
+	changed, err := b.copyFromSource(ctx, s3.New(sess), objects)
+	metrics.uploaded = len(changed)
+	if err != nil {
+		return awsutil.Error(codes.Internal, err, "unable to copy from %s", source)
+	}
+	metrics.bytes = size
+
+	log.Info("copied objects", "source", source, "objects", len(changed))
+	step.Update("Copied %d objects from %s", len(changed), source)
+	step.Done()
+
+	changed = append(changed, pruned...)
+
+	if b.config.Prune && b.pruneOrder() == pruneOrderAfter {
+		stale, err := b.prune(ctx, log, sg, sess, keys, "")
+		if err != nil {
+			return err
+		}
+
+		metrics.pruned = len(stale)
+		changed = append(changed, stale...)
+	}
+
+	return b.finishDeploy(ctx, log, sg, sess, result, state, metrics, changed)
+}
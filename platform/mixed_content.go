@@ -0,0 +1,116 @@
+package platform
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	// mixedContentScanLimit is the number of bytes of each HTML file scanned
+	// for mixed content.
+	mixedContentScanLimit = 2 << 20
+
+	// mixedContentReportLimit is the number of findings reported in full.
+	mixedContentReportLimit = 20
+)
+
+var (
+	// mixedContentAttr matches an attribute loading a resource, or
+	// submitting a form, over plain HTTP.
+	mixedContentAttr = regexp.MustCompile(`(?i)\s(?:src|srcset|poster|data|action|formaction)\s*=\s*["']?\s*http://`)
+
+	// mixedContentURL matches a CSS url() or @import of a plain HTTP
+	// resource in an inline style.
+	mixedContentURL = regexp.MustCompile(`(?i)(?:url\(\s*["']?|@import\s+["'])\s*http://`)
+
+	// mixedContentLink matches a link tag with a plain HTTP href.
+	mixedContentLink = regexp.MustCompile(`(?i)<link\b[^>]*\shref\s*=\s*["']?\s*http://[^>]*>`)
+
+	// mixedContentRel matches the link relations which load a resource, as
+	// opposed to e.g. canonical which only names a URL.
+	mixedContentRel = regexp.MustCompile(`(?i)\srel\s*=\s*["']?[^"'>]*\b(?:stylesheet|icon|preload|modulepreload|manifest|prefetch)\b`)
+)
+
+// mixedContent returns a "key:line" entry for every plain HTTP resource
+// reference in the HTML objects, which browsers block or warn about when
+// the page is served over HTTPS. Encoded and binary bodies are skipped and
+// only the first mixedContentScanLimit bytes of each file are scanned.
+func mixedContent(objects []s3manager.BatchUploadObject) ([]string, error) {
+	var found []string
+	for _, o := range objects {
+		key := aws.StringValue(o.Object.Key)
+		if ext := strings.ToLower(path.Ext(key)); ext != ".html" && ext != ".htm" {
+			continue
+		}
+
+		if o.Object.ContentEncoding != nil || o.Object.WebsiteRedirectLocation != nil {
+			continue
+		}
+
+		data, err := readBody(o.Object)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) > mixedContentScanLimit {
+			data = data[:mixedContentScanLimit]
+		}
+
+		if bytes.IndexByte(data, 0) >= 0 {
+			continue
+		}
+
+		var offsets []int
+		for _, re := range []*regexp.Regexp{mixedContentAttr, mixedContentURL} {
+			for _, m := range re.FindAllIndex(data, -1) {
+				offsets = append(offsets, m[0])
+			}
+		}
+
+		for _, m := range mixedContentLink.FindAllIndex(data, -1) {
+			if mixedContentRel.Match(data[m[0]:m[1]]) {
+				offsets = append(offsets, m[0])
+			}
+		}
+
+		lines := map[int]bool{}
+		for _, off := range offsets {
+			lines[bytes.Count(data[:off], []byte("\n"))+1] = true
+		}
+
+		for _, line := range sortedLines(lines) {
+			found = append(found, fmt.Sprintf("%s:%d", key, line))
+		}
+	}
+
+	return found, nil
+}
+
+// sortedLines returns the line numbers of lines in ascending order.
+func sortedLines(lines map[int]bool) []int {
+	out := make([]int, 0, len(lines))
+	for line := range lines {
+		out = append(out, line)
+	}
+
+	sort.Ints(out)
+
+	return out
+}
+
+// summarizeMixedContent lists the first findings, noting how many more
+// there are.
+func summarizeMixedContent(found []string) string {
+	if len(found) <= mixedContentReportLimit {
+		return strings.Join(found, ", ")
+	}
+
+	return fmt.Sprintf("%s and %d more", strings.Join(found[:mixedContentReportLimit], ", "), len(found)-mixedContentReportLimit)
+}
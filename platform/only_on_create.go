@@ -0,0 +1,122 @@
+package platform
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// hasOnlyOnCreate reports whether any rule sets OnlyOnCreate.
+func (r headerRules) hasOnlyOnCreate() bool {
+	for _, rule := range r {
+		if rule.OnlyOnCreate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// onlyOnCreate reports whether the first rule matching key which sets
+// field has OnlyOnCreate set.
+func (r headerRules) onlyOnCreate(key string, field func(Rule) string) bool {
+	for _, rule := range r {
+		if !rule.re.MatchString(key) {
+			continue
+		}
+
+		if field(rule.Rule) != "" {
+			return rule.OnlyOnCreate
+		}
+	}
+
+	return false
+}
+
+// matchesOnlyOnCreate reports whether key matches a rule with OnlyOnCreate
+// set.
+func (r headerRules) matchesOnlyOnCreate(key string) bool {
+	for _, rule := range r {
+		if rule.OnlyOnCreate && rule.re.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keepExistingHeaders gives the objects which already exist in the bucket
+// the existing value of every header an OnlyOnCreate rule would set, so
+// those rules only apply to new keys. It returns the number of objects
+// which kept a header.
+func (b *Platform) keepExistingHeaders(ctx context.Context, svc *s3.S3, objects []s3manager.BatchUploadObject) (int, error) {
+	var candidates []s3manager.BatchUploadObject
+	for _, o := range objects {
+		if b.rules.matchesOnlyOnCreate(aws.StringValue(o.Object.Key)) {
+			candidates = append(candidates, o)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+
+	heads, err := b.headObjects(ctx, svc, candidates)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := 0
+	for _, o := range candidates {
+		in := o.Object
+		key := aws.StringValue(in.Key)
+
+		head, ok := heads[key]
+		if !ok {
+			continue
+		}
+
+		changed := false
+
+		// A header is only the rule's when nothing which takes precedence
+		// over rules sets it
+		if b.fromOnlyOnCreate(key, "Cache-Control", func(r Rule) string { return r.CacheControl }) && !b.privateGlobs.matches(key) {
+			in.CacheControl = head.CacheControl
+			changed = true
+		}
+
+		if b.fromOnlyOnCreate(key, "Content-Type", func(r Rule) string { return r.ContentType }) {
+			in.ContentType = head.ContentType
+			changed = true
+		}
+
+		if b.fromOnlyOnCreate(key, "Content-Language", func(r Rule) string { return r.ContentLanguage }) {
+			in.ContentLanguage = head.ContentLanguage
+			changed = true
+		}
+
+		if b.rules.onlyOnCreate(key, func(r Rule) string { return r.StorageClass }) {
+			// HEAD omits the class of STANDARD objects
+			in.StorageClass = head.StorageClass
+			changed = true
+		}
+
+		if changed {
+			kept++
+		}
+	}
+
+	return kept, nil
+}
+
+// fromOnlyOnCreate reports whether header of key comes from an OnlyOnCreate
+// rule rather than the asset meta or headers file.
+func (b *Platform) fromOnlyOnCreate(key, header string, field func(Rule) string) bool {
+	if _, ok := b.headerOverride(key, header); ok {
+		return false
+	}
+
+	return b.rules.onlyOnCreate(key, field)
+}
@@ -0,0 +1,144 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// preflightKey prefixes the throwaway object written and deleted by the
+// preflight. A timestamp suffix keeps concurrent deploys from sharing it.
+const preflightKey = ".waypoint-s3-preflight-"
+
+// preflight probes the permissions the enabled features need before
+// anything is uploaded, returning a single PermissionDenied error listing
+// every missing one. It writes a throwaway object with the same ACL and
+// grants as the uploads, reads and lists it when the deploy will, and
+// deletes it again.
+func (b *Platform) preflight(ctx context.Context, svc *s3.S3) error {
+	key := preflightKey + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	var missing []string
+	probe := func(permission, reason string, err error) error {
+		switch {
+		case err == nil:
+			return nil
+		case isAccessDenied(err):
+			missing = append(missing, fmt.Sprintf("%s (%s)", permission, reason))
+			return nil
+		default:
+			return awsutil.Error(codes.Internal, err, "preflight check of %s failed", permission)
+		}
+	}
+
+	// The upload input carries the ACL or grants, which need
+	// s3:PutObjectAcl on top of s3:PutObject
+	upload := b.uploadInput(key, nil)
+	put := &s3.PutObjectInput{
+		Bucket:           upload.Bucket,
+		Key:              upload.Key,
+		RequestPayer:     upload.RequestPayer,
+		Body:             bytes.NewReader(nil),
+		ACL:              upload.ACL,
+		GrantRead:        upload.GrantRead,
+		GrantReadACP:     upload.GrantReadACP,
+		GrantWriteACP:    upload.GrantWriteACP,
+		GrantFullControl: upload.GrantFullControl,
+		StorageClass:     upload.StorageClass,
+		Tagging:          upload.Tagging,
+	}
+
+	reason := "uploading objects"
+	if put.ACL != nil || put.GrantRead != nil || put.GrantFullControl != nil {
+		reason += ", s3:PutObjectAcl is needed to set their ACL"
+	}
+	if put.Tagging != nil {
+		reason += ", s3:PutObjectTagging is needed to tag them"
+	}
+
+	_, err := svc.PutObjectWithContext(ctx, put)
+	if err := probe("s3:PutObject", reason, err); err != nil {
+		return err
+	}
+	written := err == nil
+
+	// Reading an object which doesn't exist is refused without
+	// s3:ListBucket, so reads can only be probed once the object exists
+	if written && (b.config.ManifestKey != "" || b.config.LockKey != "") {
+		_, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket:       aws.String(b.config.BucketName),
+			RequestPayer: b.requestPayer(),
+			Key:          aws.String(key),
+		})
+		if err := probe("s3:GetObject", "reading manifest_key and lock_key", err); err != nil {
+			return err
+		}
+	}
+
+	if (b.config.Prune && b.pruneSource() == pruneSourceList) || b.config.SkipUnchanged || b.config.PreserveMetadata || b.rules.hasOnlyOnCreate() {
+		_, err := svc.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket:       aws.String(b.config.BucketName),
+			RequestPayer: b.requestPayer(),
+			Prefix:       aws.String(key),
+			MaxKeys:      aws.Int64(1),
+		})
+		if err := probe("s3:ListBucket", "listing objects for prune, skip_unchanged, preserve_metadata and only_on_create", err); err != nil {
+			return err
+		}
+	}
+
+	if b.config.CleanupIncompleteUploads {
+		_, err := svc.ListMultipartUploadsWithContext(ctx, &s3.ListMultipartUploadsInput{
+			Bucket:     aws.String(b.config.BucketName),
+			Prefix:     aws.String(key),
+			MaxUploads: aws.Int64(1),
+		})
+		if err := probe("s3:ListBucketMultipartUploads", "listing incomplete uploads for cleanup_incomplete_uploads", err); err != nil {
+			return err
+		}
+	}
+
+	if written {
+		_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket:       aws.String(b.config.BucketName),
+			RequestPayer: b.requestPayer(),
+			Key:          aws.String(key),
+		})
+
+		reason := "removing the preflight object " + key
+		if b.config.Prune {
+			reason = "pruning objects"
+		}
+		if err := probe("s3:DeleteObject", reason, err); err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		return status.Errorf(codes.PermissionDenied, "missing permissions on bucket %q:\n  - %s",
+			b.config.BucketName, strings.Join(missing, "\n  - "))
+	}
+
+	return nil
+}
+
+// isAccessDenied reports whether a request was refused for lack of
+// permission.
+func isAccessDenied(err error) bool {
+	if rf, ok := err.(awserr.RequestFailure); ok {
+		return rf.StatusCode() == http.StatusForbidden
+	}
+
+	return false
+}
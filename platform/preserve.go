@@ -0,0 +1,181 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// preserveUnchanged copies the objects whose content matches the object
+// already in the bucket onto themselves instead of uploading them again, so
+// their metadata, ACL and tags are kept. It returns the objects which still
+// need uploading and the number of objects copied.
+func (b *Platform) preserveUnchanged(ctx context.Context, svc *s3.S3, objects []s3manager.BatchUploadObject) ([]s3manager.BatchUploadObject, int, error) {
+	heads, err := b.headObjects(ctx, svc, objects)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	remote := make(map[string]string, len(heads))
+	for key, out := range heads {
+		remote[key] = aws.StringValue(out.ETag)
+	}
+
+	changed := make([]s3manager.BatchUploadObject, 0, len(objects))
+	var unchanged []string
+	for _, o := range objects {
+		same, err := sameContent(o.Object, remote)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if same {
+			unchanged = append(unchanged, aws.StringValue(o.Object.Key))
+		} else {
+			changed = append(changed, o)
+		}
+	}
+
+	if err := b.copyInPlace(ctx, svc, unchanged, heads); err != nil {
+		return nil, 0, err
+	}
+
+	return changed, len(unchanged), nil
+}
+
+// copyInPlace copies keys onto themselves, sending up to
+// SkipUnchangedConcurrency requests at a time.
+func (b *Platform) copyInPlace(ctx context.Context, svc *s3.S3, keys []string, heads map[string]*s3.HeadObjectOutput) error {
+	workers := b.config.SkipUnchangedConcurrency
+	if workers <= 0 {
+		workers = defaultSkipUnchangedConcurrency
+	}
+
+	queue := make(chan string)
+	go func() {
+		defer close(queue)
+
+		for _, key := range keys {
+			select {
+			case queue <- key:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for key := range queue {
+				err := b.copyObjectInPlace(ctx, svc, key, heads[key])
+				if err == nil {
+					continue
+				}
+
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", key, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return firstErr
+}
+
+// copyObjectInPlace copies key onto itself. S3 rejects such a copy unless
+// the metadata is replaced, so the headers of the existing object are sent
+// back unchanged. Tags are copied by default and the ACL, which a copy
+// doesn't keep, is read and sent back as grants.
+func (b *Platform) copyObjectInPlace(ctx context.Context, svc *s3.S3, key string, head *s3.HeadObjectOutput) error {
+	in := &s3.CopyObjectInput{
+		Bucket:                  aws.String(b.config.BucketName),
+		Key:                     aws.String(key),
+		CopySource:              aws.String((&url.URL{Path: b.config.BucketName + "/" + key}).EscapedPath()),
+		MetadataDirective:       aws.String(s3.MetadataDirectiveReplace),
+		RequestPayer:            b.requestPayer(),
+		ContentType:             head.ContentType,
+		CacheControl:            head.CacheControl,
+		ContentEncoding:         head.ContentEncoding,
+		ContentLanguage:         head.ContentLanguage,
+		ContentDisposition:      head.ContentDisposition,
+		Metadata:                head.Metadata,
+		WebsiteRedirectLocation: head.WebsiteRedirectLocation,
+		StorageClass:            head.StorageClass,
+	}
+
+	if head.Expires != nil {
+		if t, err := http.ParseTime(aws.StringValue(head.Expires)); err == nil {
+			in.Expires = aws.Time(t)
+		}
+	}
+
+	// Buckets with ACLs disabled reject any request which sets one
+	if !b.aclsDisabled {
+		acl, err := svc.GetObjectAclWithContext(ctx, &s3.GetObjectAclInput{
+			Bucket:       aws.String(b.config.BucketName),
+			Key:          aws.String(key),
+			RequestPayer: b.requestPayer(),
+		})
+		if err != nil {
+			return err
+		}
+
+		setGrants(in, acl.Grants)
+	}
+
+	_, err := svc.CopyObjectWithContext(ctx, in)
+	return err
+}
+
+// setGrants sets the x-amz-grant-* headers of a copy to grants.
+func setGrants(in *s3.CopyObjectInput, grants []*s3.Grant) {
+	byPermission := map[string][]string{}
+	for _, g := range grants {
+		if g.Grantee == nil {
+			continue
+		}
+
+		var grantee string
+		switch {
+		case g.Grantee.ID != nil:
+			grantee = "id=" + aws.StringValue(g.Grantee.ID)
+		case g.Grantee.URI != nil:
+			grantee = "uri=" + aws.StringValue(g.Grantee.URI)
+		case g.Grantee.EmailAddress != nil:
+			grantee = "emailAddress=" + aws.StringValue(g.Grantee.EmailAddress)
+		default:
+			continue
+		}
+
+		p := aws.StringValue(g.Permission)
+		byPermission[p] = append(byPermission[p], grantee)
+	}
+
+	in.GrantRead = grantHeader(byPermission[s3.PermissionRead])
+	in.GrantReadACP = grantHeader(byPermission[s3.PermissionReadAcp])
+	in.GrantWriteACP = grantHeader(byPermission[s3.PermissionWriteAcp])
+	in.GrantFullControl = grantHeader(byPermission[s3.PermissionFullControl])
+}
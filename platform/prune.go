@@ -0,0 +1,255 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// deleteBatchSize is the maximum number of keys a DeleteObjects request
+// accepts.
+const deleteBatchSize = 1000
+
+// defaultPruneConcurrency is the number of delete batches run in parallel
+// when PruneConcurrency is not set.
+const defaultPruneConcurrency = 4
+
+// When prune deletes stale objects, relative to the upload.
+const (
+	pruneOrderBefore = "before"
+	pruneOrderAfter  = "after"
+)
+
+func (p *Platform) pruneOrder() string {
+	if p.config.PruneOrder == "" {
+		return pruneOrderAfter
+	}
+
+	return p.config.PruneOrder
+}
+
+// prune deletes the objects in the bucket which are not in keys, apart
+// from the generation at previousPrefix, and returns their keys. The keys
+// of the objects the deploy manages itself are added to keys.
+func (b *Platform) prune(
+	ctx context.Context,
+	log hclog.Logger,
+	sg terminal.StepGroup,
+	sess *session.Session,
+	keys map[string]bool,
+	previousPrefix string,
+) ([]string, error) {
+	step := sg.Add("Pruning stale objects...")
+	defer step.Abort()
+
+	if b.config.ManifestKey != "" {
+		keys[b.config.ManifestKey] = true
+	}
+
+	if b.config.LockKey != "" {
+		keys[b.config.LockKey] = true
+	}
+
+	if b.config.LatestPointerKey != "" {
+		keys[b.config.LatestPointerKey] = true
+	}
+
+	if b.config.WriteDeploySummary {
+		keys[b.deploySummaryKey()] = true
+	}
+
+	var stale []string
+	if b.pruneSource() == pruneSourceInventory {
+		step.Update("Reading inventory report...")
+
+		region := b.config.PruneInventory.Region
+		if region == "" {
+			region = b.config.Region
+		}
+
+		invSess, err := b.sessionConfig(region).Session()
+		if err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "unable to create AWS session: %s", err)
+		}
+
+		var taken time.Time
+		stale, taken, err = b.inventoryStaleKeys(ctx, s3.New(invSess), keys)
+		if err != nil {
+			return nil, awsutil.Error(codes.FailedPrecondition, err, "unable to read the inventory of bucket %q", b.config.BucketName)
+		}
+
+		log.Info("pruning from inventory report", "taken", taken)
+		step.Update("Pruning %d stale objects from the inventory report of %s...", len(stale), taken.UTC().Format(time.RFC3339))
+	} else {
+		var err error
+		stale, err = b.staleKeys(ctx, s3.New(sess), keys)
+		if err != nil {
+			return nil, awsutil.Error(codes.Internal, err, "unable to list objects to prune")
+		}
+	}
+
+	// Other apps and workspaces share the bucket. The inventory covers
+	// all of it
+	if b.keyPrefix != "" {
+		stale = withPrefix(stale, b.keyPrefix)
+	}
+
+	// The previous generation is kept so it can be swapped back to
+	if previousPrefix != "" {
+		stale = withoutPrefix(stale, previousPrefix+"/")
+	}
+
+	if err := b.deleteKeys(ctx, s3.New(sess), stale); err != nil {
+		return nil, err
+	}
+
+	step.Update("Pruned %d stale objects", len(stale))
+	step.Done()
+
+	return stale, nil
+}
+
+// staleKeys lists the objects in the bucket, or under the prefix of
+// KeyTemplate, which are not in keep.
+func (p *Platform) staleKeys(ctx context.Context, svc *s3.S3, keep map[string]bool) ([]string, error) {
+	stale := []string{}
+
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:       aws.String(p.config.BucketName),
+		RequestPayer: p.requestPayer(),
+		Prefix:       optionalString(p.keyPrefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			if key := aws.StringValue(o.Key); !keep[key] {
+				stale = append(stale, key)
+			}
+		}
+
+		return true
+	})
+
+	return stale, err
+}
+
+// deleteKeys deletes the current version of keys.
+func (p *Platform) deleteKeys(ctx context.Context, svc *s3.S3, keys []string) error {
+	ids := make([]*s3.ObjectIdentifier, len(keys))
+	for i, k := range keys {
+		ids[i] = &s3.ObjectIdentifier{Key: aws.String(k)}
+	}
+
+	return p.deleteObjects(ctx, svc, ids)
+}
+
+// deleteObjects deletes objects in batches, running up to PruneConcurrency
+// batches at a time. Objects which could not be deleted are collected into
+// a partialFailure.
+func (p *Platform) deleteObjects(ctx context.Context, svc *s3.S3, ids []*s3.ObjectIdentifier) error {
+	workers := p.config.PruneConcurrency
+	if workers <= 0 {
+		workers = defaultPruneConcurrency
+	}
+
+	batches := make(chan []*s3.ObjectIdentifier)
+	go func() {
+		defer close(batches)
+
+		for start := 0; start < len(ids); start += deleteBatchSize {
+			end := start + deleteBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+
+			select {
+			case batches <- ids[start:end]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu     sync.Mutex
+		failed []objectError
+		wg     sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for batch := range batches {
+				errs := p.deleteBatch(ctx, svc, batch)
+
+				mu.Lock()
+				failed = append(failed, errs...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return &partialFailure{Op: "delete", Total: len(ids), Errors: failed}
+	}
+
+	return nil
+}
+
+// deleteBatch deletes up to deleteBatchSize objects with a single request.
+func (p *Platform) deleteBatch(ctx context.Context, svc *s3.S3, batch []*s3.ObjectIdentifier) []objectError {
+	out, err := svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket:       aws.String(p.config.BucketName),
+		RequestPayer: p.requestPayer(),
+		Delete: &s3.Delete{
+			Objects: batch,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		// The whole request failed, so none of the batch was deleted
+		errs := make([]objectError, len(batch))
+		for i, id := range batch {
+			errs[i] = objectError{Key: objectName(id.Key, id.VersionId), Err: errors.New(awsutil.Describe(err))}
+		}
+
+		return errs
+	}
+
+	errs := make([]objectError, 0, len(out.Errors))
+	for _, e := range out.Errors {
+		errs = append(errs, objectError{
+			Key: objectName(e.Key, e.VersionId),
+			Err: fmt.Errorf("%s: %s", aws.StringValue(e.Code), aws.StringValue(e.Message)),
+		})
+	}
+
+	return errs
+}
+
+// objectName is the key of an object, followed by its version when one is
+// set.
+func objectName(key, version *string) string {
+	if version == nil {
+		return aws.StringValue(key)
+	}
+
+	return fmt.Sprintf("%s (version %s)", aws.StringValue(key), aws.StringValue(version))
+}
@@ -0,0 +1,128 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validRedirectTarget reports whether target is in a form S3 accepts for
+// x-amz-website-redirect-location.
+func validRedirectTarget(target string) bool {
+	return strings.HasPrefix(target, "/") ||
+		strings.HasPrefix(target, "http://") ||
+		strings.HasPrefix(target, "https://")
+}
+
+// validateRedirects checks the configured redirects.
+func validateRedirects(redirects map[string]string) error {
+	for key, target := range redirects {
+		if strings.Trim(key, "/") == "" {
+			return fmt.Errorf("source key must not be empty")
+		}
+
+		if !validRedirectTarget(target) {
+			return fmt.Errorf("target %q of %q must start with /, http:// or https://", target, key)
+		}
+	}
+
+	return nil
+}
+
+// redirectObjects returns a zero-byte object for each configured redirect,
+// carrying the redirect target as website redirect metadata.
+func (p *Platform) redirectObjects() []s3manager.BatchUploadObject {
+	keys := make([]string, 0, len(p.config.Redirects))
+	for k := range p.config.Redirects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	objects := []s3manager.BatchUploadObject{}
+	for _, k := range keys {
+		objects = append(objects, p.redirectObject(strings.TrimPrefix(k, "/"), p.config.Redirects[k]))
+	}
+
+	return objects
+}
+
+// redirectObject returns a zero-byte object redirecting key to target.
+func (p *Platform) redirectObject(key, target string) s3manager.BatchUploadObject {
+	in := &s3manager.UploadInput{
+		Key:                     aws.String(key),
+		Bucket:                  aws.String(p.config.BucketName),
+		RequestPayer:            p.requestPayer(),
+		Body:                    strings.NewReader(""),
+		WebsiteRedirectLocation: aws.String(target),
+		Tagging:                 awsutil.ObjectTagging(p.config.ResourceTags),
+	}
+	p.setAccess(in, key)
+
+	return s3manager.BatchUploadObject{Object: in}
+}
+
+// rootRedirect makes requests for the root of the website redirect to
+// RootRedirect. A bucket which already redirects all requests is pointed at
+// the new host; otherwise the index document is replaced by a redirect
+// object, which is returned for upload.
+func (p *Platform) rootRedirect(ctx context.Context, svc *s3.S3, website *s3.GetBucketWebsiteOutput) (*s3manager.BatchUploadObject, error) {
+	if website.RedirectAllRequestsTo != nil {
+		u, err := url.Parse(p.config.RootRedirect)
+		if err != nil || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"bucket %q redirects all requests, so root_redirect must be a URL without a path such as https://example.com",
+				p.config.BucketName)
+		}
+
+		_, err = svc.PutBucketWebsiteWithContext(ctx, &s3.PutBucketWebsiteInput{
+			Bucket: aws.String(p.config.BucketName),
+			WebsiteConfiguration: &s3.WebsiteConfiguration{
+				RedirectAllRequestsTo: &s3.RedirectAllRequestsTo{
+					HostName: aws.String(u.Host),
+					Protocol: aws.String(u.Scheme),
+				},
+			},
+		})
+		if err != nil {
+			return nil, awsutil.Error(codes.Internal, err, "unable to update website redirect of bucket %q", p.config.BucketName)
+		}
+
+		return nil, nil
+	}
+
+	index := "index.html"
+	if website.IndexDocument != nil {
+		index = aws.StringValue(website.IndexDocument.Suffix)
+	}
+
+	o := p.redirectObject(index, p.config.RootRedirect)
+	return &o, nil
+}
+
+// websiteConfig returns the static website hosting configuration of the
+// bucket, or nil when website hosting is not enabled. Redirect objects have
+// no effect without it.
+func (p *Platform) websiteConfig(ctx context.Context, svc *s3.S3) (*s3.GetBucketWebsiteOutput, error) {
+	out, err := svc.GetBucketWebsiteWithContext(ctx, &s3.GetBucketWebsiteInput{
+		Bucket: aws.String(p.config.BucketName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchWebsiteConfiguration" {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return out, nil
+}
@@ -0,0 +1,117 @@
+package platform
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule sets headers for every object whose key matches a glob. Rules are
+// tried in the order they are declared and each header is taken from the
+// first matching rule which sets it.
+type Rule struct {
+	// Match is the glob matched against keys, e.g. "/assets/**/*.js"
+	Match string `hcl:"match,label"`
+
+	CacheControl    string `hcl:"cache_control,optional"`
+	ContentType     string `hcl:"content_type,optional"`
+	ContentEncoding string `hcl:"content_encoding,optional"`
+	ContentLanguage string `hcl:"content_language,optional"`
+	StorageClass    string `hcl:"storage_class,optional"`
+	ACL             string `hcl:"acl,optional"`
+
+	// OnlyOnCreate applies the rule only to keys which don't exist in the
+	// bucket yet. Existing objects keep the headers the rule would set.
+	OnlyOnCreate bool `hcl:"only_on_create,optional"`
+}
+
+// headerRule is a Rule with its compiled glob.
+type headerRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// headerRules are rules in the order they are matched.
+type headerRules []headerRule
+
+// compileRules validates rules and compiles their globs, keeping their
+// order.
+func compileRules(rules []Rule) (headerRules, error) {
+	out := make(headerRules, 0, len(rules))
+
+	for _, r := range rules {
+		re, err := globToRegexp(r.Match)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.ACL != "" && !validACL(r.ACL) {
+			return nil, fmt.Errorf("%q: acl must be one of %s", r.Match, strings.Join(cannedACLs, ", "))
+		}
+
+		if r.StorageClass != "" && !validStorageClass(r.StorageClass) {
+			return nil, fmt.Errorf("%q: storage_class must be one of %s", r.Match, strings.Join(knownStorageClasses, ", "))
+		}
+
+		if r.ContentLanguage != "" && !validLanguage(r.ContentLanguage) {
+			return nil, fmt.Errorf("%q: content_language must be a language tag such as \"en\" or \"pt-BR\"", r.Match)
+		}
+
+		// The encoding describes the body, which is uploaded again, and an
+		// object's ACL isn't part of its HEAD response
+		if r.OnlyOnCreate && (r.ContentEncoding != "" || r.ACL != "") {
+			return nil, fmt.Errorf("%q: only_on_create can't be combined with content_encoding or acl", r.Match)
+		}
+
+		out = append(out, headerRule{Rule: r, re: re})
+	}
+
+	return out, nil
+}
+
+// mapRules converts the storage_classes, content_language and
+// content_type_overrides maps to rules, one per glob, in lexical order so
+// matching stays deterministic. They are matched after the rule blocks.
+func mapRules(storageClasses, contentLanguage, contentTypes map[string]string) []Rule {
+	var out []Rule
+
+	for _, glob := range sortedKeys(storageClasses) {
+		out = append(out, Rule{Match: glob, StorageClass: storageClasses[glob]})
+	}
+
+	for _, glob := range sortedKeys(contentLanguage) {
+		out = append(out, Rule{Match: glob, ContentLanguage: contentLanguage[glob]})
+	}
+
+	for _, glob := range sortedKeys(contentTypes) {
+		out = append(out, Rule{Match: glob, ContentType: contentTypes[glob]})
+	}
+
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// value returns the field of the first rule matching key which sets it.
+func (r headerRules) value(key string, field func(Rule) string) (string, bool) {
+	for _, rule := range r {
+		if !rule.re.MatchString(key) {
+			continue
+		}
+
+		if v := field(rule.Rule); v != "" {
+			return v, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,322 @@
+package platform
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// artifactFile is a file of the artifact to upload.
+type artifactFile struct {
+	// Path is the file's path relative to the artifact root, as produced by
+	// the source. It is turned into a key by sanitizeKey.
+	Path string
+
+	// Size is the length of Body.
+	Size int64
+
+	// Body stays valid after the callback it is passed to, it is read
+	// again when the file is uploaded.
+	Body io.ReadSeeker
+
+	// Dir is set for directories, which have no Body. They are produced
+	// before the files under them.
+	Dir bool
+}
+
+// artifactSource produces the files of an artifact, calling fn for each
+// one in turn and stopping at the first error. Sources decouple where the
+// files come from, such as a directory on disk, from how they are
+// uploaded.
+type artifactSource func(fn func(artifactFile) error) error
+
+// defaultMaxOpenFiles is the number of artifact files read at once when
+// MaxOpenFiles is not set, well below the common limit of 1024 open files.
+const defaultMaxOpenFiles = 64
+
+// dirSource produces the files under root in walk order. Symbolic links
+// are followed. Files are not read by the walk, their bodies open them
+// when they are read.
+func dirSource(root string) artifactSource {
+	return func(fn func(artifactFile) error) error {
+		return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			stat, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+
+			relativePath, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+
+			if stat.IsDir() {
+				if relativePath == "." {
+					return nil
+				}
+
+				return fn(artifactFile{Path: relativePath, Dir: true})
+			}
+
+			return fn(artifactFile{
+				Path: relativePath,
+				Size: stat.Size(),
+				Body: &fileBody{path: path, size: stat.Size()},
+			})
+		})
+	}
+}
+
+// artifactObjects is the upload set built from an artifact source.
+type artifactObjects struct {
+	objects []s3manager.BatchUploadObject
+
+	// keys holds every key in objects
+	keys map[string]bool
+
+	// size is the total size of the bodies of objects
+	size int64
+
+	// unstripped are the keys of files outside strip_prefix, which are
+	// uploaded under their full path
+	unstripped []string
+
+	// lowercased are the paths of files whose key was lowercased by
+	// lowercase_keys
+	lowercased []string
+
+	// disallowed are the paths of files skipped because their extension
+	// isn't in allowed_extensions
+	disallowed []string
+}
+
+// readSource consumes src into upload inputs. Bodies are not held in
+// memory: they are read once up front by digestBody, at most MaxOpenFiles
+// at a time, and again when they are uploaded.
+func (b *Platform) readSource(src artifactSource) (*artifactObjects, error) {
+	result := &artifactObjects{keys: map[string]bool{}}
+
+	// files are the files behind result.objects, whose inputs are built
+	// once their bodies are digested
+	var files []sourceFile
+
+	// paths maps lowercased keys to the file they came from, to report
+	// files which only differ by case
+	paths := map[string]string{}
+
+	// sources maps keys to the file they came from, to report files which
+	// end up with the same key
+	sources := map[string]string{}
+
+	// dirs are the directories to add placeholders for
+	var dirs []string
+
+	err := src(func(f artifactFile) error {
+		if f.Dir {
+			if b.config.CreateFolderPlaceholders {
+				dirs = append(dirs, f.Path)
+			}
+
+			return nil
+		}
+
+		// The deploy, headers and asset meta files were already read by
+		// loadDeployFile, loadHeadersFile and loadAssetMeta
+		if f.Path == deployFileName || b.readBeforeUpload(f.Path) {
+			return nil
+		}
+
+		key, err := sanitizeKey(f.Path)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid file name in artifact: %s", err)
+		}
+
+		if !b.allowedExtension(key) {
+			result.disallowed = append(result.disallowed, f.Path)
+			return nil
+		}
+
+		key, ok := b.stripPrefix(key)
+		if !ok {
+			result.unstripped = append(result.unstripped, key)
+		}
+		if key == "" {
+			return status.Errorf(codes.InvalidArgument, "strip_prefix %q leaves file %q with an empty key", b.config.StripPrefix, f.Path)
+		}
+
+		if b.config.LowercaseKeys {
+			lower := strings.ToLower(key)
+			if other, ok := paths[lower]; ok {
+				return status.Errorf(codes.InvalidArgument, "files %q and %q only differ by case and would both be uploaded to %q",
+					other, f.Path, lower)
+			}
+			paths[lower] = f.Path
+
+			if lower != key {
+				result.lowercased = append(result.lowercased, f.Path)
+				key = lower
+			}
+		}
+
+		if d := b.config.KeyDelimiter; d != "" && d != "/" {
+			key = strings.ReplaceAll(key, "/", d)
+		}
+
+		// Sanitizing, strip_prefix and key_delimiter can all map different
+		// files to the same key
+		if other, ok := sources[key]; ok {
+			return status.Errorf(codes.InvalidArgument, "files %q and %q would both be uploaded to %q", other, f.Path, key)
+		}
+		sources[key] = f.Path
+
+		result.keys[key] = true
+		result.objects = append(result.objects, s3manager.BatchUploadObject{})
+		result.size += f.Size
+		files = append(files, sourceFile{artifactFile: f, key: key})
+
+		// Checked as files are produced, so a runaway artifact is stopped
+		// before any of it is read
+		return b.checkBudget(result)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digests, err := b.digestFiles(files)
+	if err != nil {
+		return nil, err
+	}
+
+	// Inputs are built in order, as content type detection isn't safe
+	// for concurrent use
+	for i, f := range files {
+		result.objects[i].Object = b.bodyUploadInput(f.key, f.Body, digests[i])
+	}
+
+	if err := b.addFolderPlaceholders(result, dirs); err != nil {
+		return nil, err
+	}
+
+	if err := b.checkBudget(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// sourceFile is an artifact file and the key it is uploaded to.
+type sourceFile struct {
+	artifactFile
+	key string
+}
+
+// digestFiles digests the bodies of files, MaxOpenFiles at a time.
+func (b *Platform) digestFiles(files []sourceFile) ([]bodyDigest, error) {
+	workers := b.config.MaxOpenFiles
+	if workers <= 0 {
+		workers = defaultMaxOpenFiles
+	}
+
+	var (
+		mu       sync.Mutex
+		digests  = make([]bodyDigest, len(files))
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+
+		for i := range files {
+			indexes <- i
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				f := files[i]
+
+				d, err := b.digestBody(f.Body, f.Size)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("failed to read file %q, %v", f.Path, err)
+					}
+					mu.Unlock()
+					continue
+				}
+
+				digests[i] = d
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return digests, firstErr
+}
+
+// readBeforeUpload reports whether path is the HeadersFile or the
+// AssetMetaFile, which are read before the upload and not uploaded.
+func (b *Platform) readBeforeUpload(path string) bool {
+	return path != "" && (path == b.config.HeadersFile || path == b.config.AssetMetaFile)
+}
+
+// checkBudget fails the deploy once result exceeds MaxObjects or
+// MaxTotalBytes.
+func (b *Platform) checkBudget(result *artifactObjects) error {
+	if b.config.MaxObjects > 0 && len(result.objects) > b.config.MaxObjects {
+		return status.Errorf(codes.FailedPrecondition, "artifact has more than max_objects %d objects", b.config.MaxObjects)
+	}
+
+	if b.config.MaxTotalBytes > 0 && result.size > b.config.MaxTotalBytes {
+		return status.Errorf(codes.FailedPrecondition, "artifact is larger than max_total_bytes %d (%s), %s read so far",
+			b.config.MaxTotalBytes, formatBytes(b.config.MaxTotalBytes), formatBytes(result.size))
+	}
+
+	return nil
+}
+
+// sortObjects sorts objects by key. The walk order depends on the source,
+// and default files are appended after it.
+func sortObjects(objects []s3manager.BatchUploadObject) {
+	sort.Slice(objects, func(i, j int) bool {
+		return aws.StringValue(objects[i].Object.Key) < aws.StringValue(objects[j].Object.Key)
+	})
+}
+
+// allowedExtension reports whether key may be published under
+// AllowedExtensions. Every key is allowed when it is empty.
+func (b *Platform) allowedExtension(key string) bool {
+	if len(b.config.AllowedExtensions) == 0 {
+		return true
+	}
+
+	ext := strings.ToLower(path.Ext(key))
+	for _, allowed := range b.config.AllowedExtensions {
+		if ext != "" && ext == strings.ToLower(allowed) {
+			return true
+		}
+	}
+
+	return false
+}
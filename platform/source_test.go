@@ -0,0 +1,245 @@
+package platform
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestReadSourceStreamsFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"index.html":   "<html><body>hello</body></html>",
+		"css/site.css": strings.Repeat("body { color: red; }\n", 100),
+		"empty.txt":    "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := configuredPlatform(t, DeployConfig{VerifyChecksum: true, ChecksumAlgorithm: "CRC32"})
+
+	result, err := p.readSource(dirSource(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.objects) != len(files) {
+		t.Fatalf("read %d objects, want %d", len(result.objects), len(files))
+	}
+
+	for _, o := range result.objects {
+		key := aws.StringValue(o.Object.Key)
+		content := files[key]
+
+		if _, ok := o.Object.Body.(*fileBody); !ok {
+			t.Errorf("%s: body is a %T, want it read from disk", key, o.Object.Body)
+		}
+
+		sum := md5.Sum([]byte(content))
+		if got, want := aws.StringValue(o.Object.ContentMD5), base64.StdEncoding.EncodeToString(sum[:]); got != want {
+			t.Errorf("%s: Content-MD5 is %q, want %q", key, got, want)
+		}
+
+		var crc [4]byte
+		binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE([]byte(content)))
+		if got, want := aws.StringValue(o.Object.ChecksumCRC32), base64.StdEncoding.EncodeToString(crc[:]); got != want {
+			t.Errorf("%s: CRC32 is %q, want %q", key, got, want)
+		}
+
+		// Read twice, as retried uploads rewind the body
+		for i := 0; i < 2; i++ {
+			body, err := ioutil.ReadAll(o.Object.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != content {
+				t.Errorf("%s: body is %q, want %q", key, body, content)
+			}
+			if _, err := o.Object.Body.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Detected from the start of the file
+	if got := aws.StringValue(result.objects[2].Object.ContentType); got != "text/html; charset=utf-8" {
+		t.Errorf("index.html has type %q", got)
+	}
+}
+
+// countingFile counts the open artifact files.
+type countingFile struct {
+	io.ReadSeekCloser
+	close func()
+}
+
+func (f countingFile) Close() error {
+	f.close()
+	return f.ReadSeekCloser.Close()
+}
+
+func TestReadSourceBoundsOpenFiles(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(root, fmt.Sprintf("dir%d", i%3), fmt.Sprintf("file%02d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		open    int
+		maxOpen int
+	)
+
+	defer func(f func(string) (io.ReadSeekCloser, error)) { openArtifactFile = f }(openArtifactFile)
+	openArtifactFile = func(path string) (io.ReadSeekCloser, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		mu.Lock()
+		open++
+		if open > maxOpen {
+			maxOpen = open
+		}
+		mu.Unlock()
+
+		// A slow read lets unbounded workers pile up
+		time.Sleep(time.Millisecond)
+
+		return countingFile{ReadSeekCloser: f, close: func() {
+			mu.Lock()
+			open--
+			mu.Unlock()
+		}}, nil
+	}
+
+	const maxOpenFiles = 4
+
+	p := configuredPlatform(t, DeployConfig{VerifyChecksum: true, MaxOpenFiles: maxOpenFiles})
+	result, err := p.readSource(dirSource(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.objects) != 50 {
+		t.Errorf("read %d objects, want 50", len(result.objects))
+	}
+	if maxOpen > maxOpenFiles {
+		t.Errorf("%d files were open at once, want at most %d", maxOpen, maxOpenFiles)
+	}
+	if open != 0 {
+		t.Errorf("%d files are still open after reading the artifact", open)
+	}
+}
+
+func TestDirSourceStopsOnError(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 20; i++ {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file%02d.txt", i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stop := fmt.Errorf("stop")
+
+	var n int
+	err := dirSource(root)(func(f artifactFile) error {
+		n++
+		if n == 3 {
+			return stop
+		}
+		return nil
+	})
+
+	if err != stop {
+		t.Fatalf("error = %v, want the error of fn", err)
+	}
+	if n != 3 {
+		t.Errorf("fn was called %d times, want 3", n)
+	}
+}
+
+// pathSource produces a file for each of paths, with the path as its body.
+func pathSource(paths ...string) artifactSource {
+	return func(fn func(artifactFile) error) error {
+		for _, p := range paths {
+			err := fn(artifactFile{Path: p, Size: int64(len(p)), Body: strings.NewReader(p)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestReadSourceRejectsDuplicateKeys(t *testing.T) {
+	cases := []struct {
+		name   string
+		config DeployConfig
+		paths  []string
+		key    string
+	}{
+		{
+			name:  "backslash and slash",
+			paths: []string{`a\b.html`, "a/b.html"},
+			key:   "a/b.html",
+		},
+		{
+			name:   "strip_prefix",
+			config: DeployConfig{StripPrefix: "dist"},
+			paths:  []string{"dist/index.html", "index.html"},
+			key:    "index.html",
+		},
+		{
+			name:   "key_delimiter",
+			config: DeployConfig{KeyDelimiter: "-"},
+			paths:  []string{"a/b.html", "a-b.html"},
+			key:    "a-b.html",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := configuredPlatform(t, tc.config)
+
+			_, err := p.readSource(pathSource(tc.paths...))
+			if err == nil {
+				t.Fatalf("files %q were both uploaded to %q", tc.paths, tc.key)
+			}
+			if !strings.Contains(err.Error(), fmt.Sprintf("%q", tc.key)) {
+				t.Errorf("error %q doesn't name the key %q", err, tc.key)
+			}
+		})
+	}
+
+	p := configuredPlatform(t, DeployConfig{})
+	if _, err := p.readSource(pathSource("a/b.html", "a/c.html")); err != nil {
+		t.Errorf("distinct keys were rejected: %s", err)
+	}
+}
@@ -0,0 +1,183 @@
+package platform
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const defaultSRIManifestKey = "sri-manifest.json"
+
+// sriExtensions are the files whose integrity is recorded.
+var sriExtensions = map[string]bool{".js": true, ".mjs": true, ".css": true}
+
+var (
+	// sriTag matches the opening tag of a script or link element.
+	sriTag = regexp.MustCompile(`(?i)<(?:script|link)\b[^>]*>`)
+
+	// sriRef matches the src or href attribute of such a tag.
+	sriRef = regexp.MustCompile(`(?i)\s(?:src|href)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+func (p *Platform) sriManifestKey() string {
+	if p.config.SRIManifestKey == "" {
+		return defaultSRIManifestKey
+	}
+
+	return p.config.SRIManifestKey
+}
+
+// integrityHashes returns the SHA-384 integrity string of every script and
+// stylesheet in objects, by key. Objects with a Content-Encoding are
+// skipped: browsers check the decoded body, which isn't what is uploaded.
+func integrityHashes(objects []s3manager.BatchUploadObject) (map[string]string, error) {
+	hashes := map[string]string{}
+	for _, o := range objects {
+		key := aws.StringValue(o.Object.Key)
+		if !sriExtensions[strings.ToLower(path.Ext(key))] || o.Object.ContentEncoding != nil {
+			continue
+		}
+
+		body, ok := o.Object.Body.(io.ReadSeeker)
+		if !ok {
+			return nil, fmt.Errorf("body of %q is not seekable", key)
+		}
+
+		h := sha512.New384()
+		if err := hashBody(body, h); err != nil {
+			return nil, err
+		}
+
+		hashes[key] = "sha384-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	}
+
+	return hashes, nil
+}
+
+// sriManifest returns the upload of the manifest of hashes.
+func (p *Platform) sriManifest(hashes map[string]string) (s3manager.BatchUploadObject, error) {
+	data, err := json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return s3manager.BatchUploadObject{}, err
+	}
+
+	in := p.uploadInput(p.sriManifestKey(), data)
+	in.ContentType = aws.String("application/json")
+
+	return s3manager.BatchUploadObject{Object: in}, nil
+}
+
+// injectIntegrity adds an integrity attribute to the script and link tags
+// of HTML objects which reference a hashed object and don't have one yet.
+// It returns the number of HTML objects changed.
+func injectIntegrity(objects []s3manager.BatchUploadObject, hashes map[string]string) (int, error) {
+	changed := 0
+	for _, o := range objects {
+		key := aws.StringValue(o.Object.Key)
+		if ext := strings.ToLower(path.Ext(key)); ext != ".html" && ext != ".htm" {
+			continue
+		}
+
+		data, err := readBody(o.Object)
+		if err != nil {
+			return 0, err
+		}
+
+		out := sriTag.ReplaceAllFunc(data, func(tag []byte) []byte {
+			if bytes.Contains(bytes.ToLower(tag), []byte("integrity")) {
+				return tag
+			}
+
+			m := sriRef.FindSubmatch(tag)
+			if m == nil {
+				return tag
+			}
+
+			ref := string(m[1])
+			if ref == "" {
+				ref = string(m[2])
+			}
+
+			integrity, ok := hashes[referencedKey(key, ref)]
+			if !ok {
+				return tag
+			}
+
+			end := len(tag) - 1
+			if tag[end-1] == '/' {
+				end--
+			}
+
+			var b bytes.Buffer
+			b.Write(bytes.TrimRight(tag[:end], " \t\r\n"))
+			fmt.Fprintf(&b, ` integrity="%s"`, integrity)
+			b.Write(tag[end:])
+			return b.Bytes()
+		})
+
+		if bytes.Equal(out, data) {
+			continue
+		}
+
+		o.Object.Body = bytes.NewReader(out)
+		if o.Object.ContentMD5 != nil {
+			sum := md5.Sum(out)
+			o.Object.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		if alg := aws.StringValue(o.Object.ChecksumAlgorithm); alg != "" {
+			h := checksumHash(alg)
+			h.Write(out)
+			setChecksum(o.Object, alg, h.Sum(nil))
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// referencedKey resolves ref, as found in the page at key, to an object
+// key. References to other hosts resolve to "".
+func referencedKey(key, ref string) string {
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		ref = ref[:i]
+	}
+
+	if ref == "" || strings.HasPrefix(ref, "//") || strings.Contains(ref, ":") {
+		return ""
+	}
+
+	if strings.HasPrefix(ref, "/") {
+		return strings.TrimPrefix(path.Clean(ref), "/")
+	}
+
+	return strings.TrimPrefix(path.Join(path.Dir(key), ref), "/")
+}
+
+// readBody reads the body of in into memory and rewinds it.
+func readBody(in *s3manager.UploadInput) ([]byte, error) {
+	body, ok := in.Body.(io.ReadSeeker)
+	if !ok {
+		return nil, fmt.Errorf("body of %q is not seekable", aws.StringValue(in.Key))
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
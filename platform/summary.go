@@ -0,0 +1,83 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// defaultDeploySummaryKey is the key of the deploy summary when
+// DeploySummaryKey is not set.
+const defaultDeploySummaryKey = "_deploy/latest.json"
+
+// deploySummary is the object written to DeploySummaryKey, describing the
+// last successful deploy for tools without access to Waypoint.
+type deploySummary struct {
+	Version      int    `json:"version"`
+	DeploymentID string `json:"deployment_id"`
+	Sequence     uint64 `json:"sequence"`
+	App          string `json:"app,omitempty"`
+	Workspace    string `json:"workspace,omitempty"`
+
+	// Objects is the number of objects the deploy put in place, of which
+	// Uploaded were uploaded, and Bytes their size. Skipped objects were
+	// already up to date.
+	Objects  int   `json:"objects"`
+	Uploaded int   `json:"uploaded"`
+	Skipped  int   `json:"skipped"`
+	Pruned   int   `json:"pruned"`
+	Bytes    int64 `json:"bytes"`
+
+	// Git is the Git metadata of the deploy, see gitMetadata
+	Git map[string]string `json:"git,omitempty"`
+
+	DeployedAt time.Time `json:"deployed_at"`
+}
+
+const deploySummaryVersion = 1
+
+func (p *Platform) deploySummaryKey() string {
+	if p.config.DeploySummaryKey != "" {
+		return strings.TrimPrefix(p.config.DeploySummaryKey, "/")
+	}
+
+	return defaultDeploySummaryKey
+}
+
+// storeDeploySummary writes the summary of the deploy which just finished.
+// A single PUT replaces the previous summary atomically, and it is never
+// cached so consumers always read the current deploy.
+func (p *Platform) storeDeploySummary(ctx context.Context, svc *s3.S3, metrics *deployMetrics) error {
+	data, err := json.MarshalIndent(&deploySummary{
+		Version:      deploySummaryVersion,
+		DeploymentID: p.templateData.DeploymentID,
+		Sequence:     p.templateData.Sequence,
+		App:          p.templateData.App,
+		Workspace:    p.templateData.Workspace,
+		Objects:      metrics.uploaded + metrics.skipped,
+		Uploaded:     metrics.uploaded,
+		Skipped:      metrics.skipped,
+		Pruned:       metrics.pruned,
+		Bytes:        metrics.bytes,
+		Git:          aws.StringValueMap(p.gitMetadata),
+		DeployedAt:   time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(p.config.BucketName),
+		RequestPayer: p.requestPayer(),
+		Key:          aws.String(p.deploySummaryKey()),
+		Body:         bytes.NewReader(data),
+		ContentType:  aws.String("application/json"),
+		CacheControl: aws.String("no-cache"),
+	})
+	return err
+}
@@ -0,0 +1,87 @@
+package platform
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+)
+
+// defaultSwapPrefix is the prefix generations are uploaded under when
+// SwapPrefix is not set.
+const defaultSwapPrefix = "releases"
+
+func (p *Platform) swapRoot() string {
+	if p.config.SwapPrefix != "" {
+		return strings.Trim(p.config.SwapPrefix, "/")
+	}
+
+	return defaultSwapPrefix
+}
+
+// generationPrefix is the prefix the objects of this deploy are uploaded
+// under with AtomicSwap.
+func (p *Platform) generationPrefix() string {
+	gen := p.templateData.DeploymentID
+	if gen == "" {
+		gen = time.Now().UTC().Format("20060102T150405Z")
+	}
+
+	return p.swapRoot() + "/" + gen
+}
+
+// swapFallback is the object, relative to a generation, that missing keys
+// inside the generations are redirected to.
+func (p *Platform) swapFallback() string {
+	if p.config.ErrorDocument != "" {
+		return strings.TrimPrefix(p.config.ErrorDocument, "/")
+	}
+
+	return p.indexDocument()
+}
+
+// livePrefix returns the prefix of the generation the bucket's website
+// currently serves, or "" when it doesn't serve one.
+func (p *Platform) livePrefix(ctx context.Context, svc *s3.S3) (string, error) {
+	out, err := svc.GetBucketWebsiteWithContext(ctx, &s3.GetBucketWebsiteInput{
+		Bucket: aws.String(p.config.BucketName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchWebsiteConfiguration" {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return awsutil.LivePrefix(out.RoutingRules), nil
+}
+
+// prefixObjects moves objects under prefix and returns their new keys.
+func prefixObjects(objects []s3manager.BatchUploadObject, prefix string) map[string]bool {
+	keys := map[string]bool{}
+	for _, o := range objects {
+		key := prefix + "/" + aws.StringValue(o.Object.Key)
+		o.Object.Key = aws.String(key)
+		keys[key] = true
+	}
+
+	return keys
+}
+
+// withoutPrefix returns the keys which are not under prefix.
+func withoutPrefix(keys []string, prefix string) []string {
+	var out []string
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			out = append(out, k)
+		}
+	}
+
+	return out
+}
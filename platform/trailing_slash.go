@@ -0,0 +1,88 @@
+package platform
+
+import (
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The values of TrailingSlashPolicy.
+const (
+	// trailingSlashNone leaves directory URLs as S3 serves them, the default
+	trailingSlashNone = "none"
+
+	// trailingSlashAdd redirects "/dir" to "/dir/"
+	trailingSlashAdd = "add"
+
+	// trailingSlashStrip serves directory indexes at "/dir" and redirects
+	// "/dir/" to it
+	trailingSlashStrip = "strip"
+)
+
+var trailingSlashPolicies = []string{trailingSlashNone, trailingSlashAdd, trailingSlashStrip}
+
+func validTrailingSlashPolicy(policy string) bool {
+	for _, p := range trailingSlashPolicies {
+		if policy == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyTrailingSlash adds the website redirects enforcing
+// TrailingSlashPolicy for each directory index in objects, other than the
+// root's, and returns the new objects with the number of directories
+// redirected. Directories with an object at their key without the slash
+// are left alone.
+func (p *Platform) applyTrailingSlash(objects []s3manager.BatchUploadObject, keys map[string]bool) ([]s3manager.BatchUploadObject, int, error) {
+	policy := p.config.TrailingSlashPolicy
+	if policy == "" || policy == trailingSlashNone {
+		return objects, 0, nil
+	}
+
+	index := p.indexDocument()
+
+	var n int
+	for i, o := range objects {
+		key := aws.StringValue(o.Object.Key)
+		if path.Base(key) != index || !strings.Contains(key, "/") {
+			continue
+		}
+
+		dir := strings.TrimSuffix(key, "/"+index)
+		if keys[dir] {
+			continue
+		}
+
+		switch policy {
+		case trailingSlashAdd:
+			objects = append(objects, p.redirectObject(dir, "/"+dir+"/"))
+		case trailingSlashStrip:
+			data, err := readBody(o.Object)
+			if err != nil {
+				return nil, 0, status.Errorf(codes.Internal, "unable to read %q: %s", key, err)
+			}
+
+			// The index is served at the directory's key instead, and its
+			// own key redirects there
+			in := *o.Object
+			in.Key = aws.String(dir)
+			in.Body = bytes.NewReader(data)
+
+			objects[i] = p.redirectObject(key, "/"+dir)
+			objects = append(objects, s3manager.BatchUploadObject{Object: &in})
+		}
+
+		keys[dir] = true
+		n++
+	}
+
+	return objects, n, nil
+}
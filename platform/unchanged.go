@@ -0,0 +1,288 @@
+package platform
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Strategies for looking up the ETags of existing objects.
+const (
+	skipStrategyAuto = "auto"
+	skipStrategyHead = "head"
+	skipStrategyList = "list"
+)
+
+var skipStrategies = []string{skipStrategyAuto, skipStrategyHead, skipStrategyList}
+
+// listStrategyThreshold is the number of objects from which the auto
+// strategy lists the bucket instead of sending a HEAD request per object.
+// A list page returns 1000 keys, so listing wins unless the bucket holds
+// far more objects than the artifact.
+const listStrategyThreshold = 100
+
+// defaultSkipUnchangedConcurrency is the number of HEAD requests run in
+// parallel when SkipUnchangedConcurrency is not set.
+const defaultSkipUnchangedConcurrency = 8
+
+// headMaxRetries raises the SDK's retry limit for HEAD requests so that
+// throttling by S3 is retried with backoff rather than failing the deploy.
+const headMaxRetries = 8
+
+// etag computes the ETag S3 assigns to an object uploaded by s3manager
+// with the default part size: the MD5 of the body for a single part, or
+// the MD5 of the part MD5s followed by the part count for a multipart
+// upload. The body is read a part at a time.
+func etag(body io.Reader) (string, error) {
+	var (
+		sums  []byte
+		parts int
+	)
+
+	for {
+		h := md5.New()
+		n, err := io.CopyN(h, body, s3manager.DefaultUploadPartSize)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		// A body shorter than a part is uploaded in a single one
+		if parts == 0 && n < s3manager.DefaultUploadPartSize {
+			return `"` + hex.EncodeToString(h.Sum(nil)) + `"`, nil
+		}
+
+		if n == 0 {
+			break
+		}
+
+		sums = h.Sum(sums)
+		parts++
+
+		if n < s3manager.DefaultUploadPartSize {
+			break
+		}
+	}
+
+	sum := md5.Sum(sums)
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), parts), nil
+}
+
+// skipUnchanged removes the objects whose content matches the object
+// already in the bucket. Only the body is compared, so changes to headers
+// such as Cache-Control alone are not picked up.
+func (b *Platform) skipUnchanged(ctx context.Context, svc *s3.S3, objects []s3manager.BatchUploadObject) ([]s3manager.BatchUploadObject, error) {
+	strategy := b.config.SkipUnchangedStrategy
+	if strategy == "" || strategy == skipStrategyAuto {
+		strategy = skipStrategyHead
+		if len(objects) >= listStrategyThreshold {
+			strategy = skipStrategyList
+		}
+	}
+
+	var remote map[string]string
+	var err error
+	if strategy == skipStrategyList {
+		remote, err = b.listETags(ctx, svc)
+	} else {
+		remote, err = b.headETags(ctx, svc, objects)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]s3manager.BatchUploadObject, 0, len(objects))
+	for _, o := range objects {
+		same, err := sameContent(o.Object, remote)
+		if err != nil {
+			return nil, err
+		}
+
+		if !same {
+			changed = append(changed, o)
+		}
+	}
+
+	return changed, nil
+}
+
+// sameContent reports whether the body of in matches the ETag of the object
+// in remote with the same key. Redirects and bodies which can't be re-read
+// never match.
+func sameContent(in *s3manager.UploadInput, remote map[string]string) (bool, error) {
+	// A redirect's target is a header, which the ETag doesn't cover
+	if in.WebsiteRedirectLocation != nil {
+		return false, nil
+	}
+
+	existing, ok := remote[aws.StringValue(in.Key)]
+	if !ok {
+		return false, nil
+	}
+
+	body, ok := in.Body.(io.ReadSeeker)
+	if !ok {
+		return false, nil
+	}
+
+	tag, err := etag(body)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	return tag == existing, nil
+}
+
+// listETags returns the ETag of every object in the bucket.
+func (b *Platform) listETags(ctx context.Context, svc *s3.S3) (map[string]string, error) {
+	etags := map[string]string{}
+
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:       aws.String(b.config.BucketName),
+		RequestPayer: b.requestPayer(),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			etags[aws.StringValue(o.Key)] = aws.StringValue(o.ETag)
+		}
+
+		return true
+	})
+
+	return etags, err
+}
+
+// headETags returns the ETags of the objects which exist in the bucket.
+func (b *Platform) headETags(ctx context.Context, svc *s3.S3, objects []s3manager.BatchUploadObject) (map[string]string, error) {
+	heads, err := b.headObjects(ctx, svc, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	etags := make(map[string]string, len(heads))
+	for key, out := range heads {
+		etags[key] = aws.StringValue(out.ETag)
+	}
+
+	return etags, nil
+}
+
+// headObjects returns the HEAD responses of the objects which exist in the
+// bucket, sending up to SkipUnchangedConcurrency requests at a time. Keys
+// already looked up during this deploy are answered from b.heads.
+func (b *Platform) headObjects(ctx context.Context, svc *s3.S3, objects []s3manager.BatchUploadObject) (map[string]*s3.HeadObjectOutput, error) {
+	workers := b.config.SkipUnchangedConcurrency
+	if workers <= 0 {
+		workers = defaultSkipUnchangedConcurrency
+	}
+
+	retry := func(r *request.Request) {
+		r.Retryer = client.DefaultRetryer{NumMaxRetries: headMaxRetries}
+	}
+
+	if b.heads == nil {
+		b.heads = map[string]*s3.HeadObjectOutput{}
+	}
+
+	var (
+		mu       sync.Mutex
+		heads    = map[string]*s3.HeadObjectOutput{}
+		pending  []string
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	for _, o := range objects {
+		key := aws.StringValue(o.Object.Key)
+
+		out, ok := b.heads[key]
+		switch {
+		case !ok:
+			pending = append(pending, key)
+		case out != nil:
+			heads[key] = out
+		}
+	}
+
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+
+		for _, key := range pending {
+			select {
+			case keys <- key:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for key := range keys {
+				out, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+					Bucket:       aws.String(b.config.BucketName),
+					RequestPayer: b.requestPayer(),
+					Key:          aws.String(key),
+				}, retry)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					heads[key] = out
+					b.heads[key] = out
+				case isNotFound(err):
+					// Not uploaded yet
+					b.heads[key] = nil
+				case firstErr == nil:
+					firstErr = fmt.Errorf("%s: %w", key, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return heads, firstErr
+}
+
+// isNotFound reports whether a request failed because the object doesn't
+// exist.
+func isNotFound(err error) bool {
+	if rf, ok := err.(awserr.RequestFailure); ok {
+		return rf.StatusCode() == http.StatusNotFound
+	}
+
+	return false
+}
+
+func validSkipStrategy(s string) bool {
+	for _, known := range skipStrategies {
+		if s == known {
+			return true
+		}
+	}
+
+	return false
+}
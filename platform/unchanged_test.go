@@ -0,0 +1,57 @@
+package platform
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func TestETag(t *testing.T) {
+	partSize := int(s3manager.DefaultUploadPartSize)
+
+	md5Hex := func(data ...[]byte) string {
+		h := md5.New()
+		for _, d := range data {
+			h.Write(d)
+		}
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	multipart := func(parts ...[]byte) string {
+		var sums []byte
+		for _, p := range parts {
+			sum := md5.Sum(p)
+			sums = append(sums, sum[:]...)
+		}
+		return fmt.Sprintf(`"%s-%d"`, md5Hex(sums), len(parts))
+	}
+
+	part := bytes.Repeat([]byte("a"), partSize)
+	rest := []byte("rest")
+
+	cases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, `"` + md5Hex() + `"`},
+		{"single part", rest, `"` + md5Hex(rest) + `"`},
+		{"exactly one part", part, multipart(part)},
+		{"two parts", append(append([]byte{}, part...), rest...), multipart(part, rest)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := etag(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("etag is %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
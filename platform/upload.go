@@ -0,0 +1,87 @@
+package platform
+
+import (
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"google.golang.org/grpc/status"
+)
+
+// defaultMaxRetries is the number of times failed objects are re-uploaded
+// when MaxRetries is not set.
+const defaultMaxRetries = 3
+
+// uploadBackoff is the delay before the first retry of failed objects,
+// doubled on each retry after it.
+var uploadBackoff = time.Second
+
+// batchUploader is the part of s3manager.Uploader used by uploadObjects.
+type batchUploader interface {
+	UploadWithIterator(ctx aws.Context, iter s3manager.BatchUploadIterator, opts ...func(*s3manager.Uploader)) error
+}
+
+// uploadObjects uploads objects, then re-uploads only the objects which
+// failed, with exponential backoff, up to MaxRetries times. The error of
+// the last attempt is returned as a partialFailure.
+func (b *Platform) uploadObjects(ctx aws.Context, uploader batchUploader, objects []s3manager.BatchUploadObject) error {
+	retries := defaultMaxRetries
+	if b.config.MaxRetries != nil {
+		retries = *b.config.MaxRetries
+	}
+
+	backoff := uploadBackoff
+	pending := objects
+
+	for attempt := 0; ; attempt++ {
+		err := uploader.UploadWithIterator(ctx, &s3manager.UploadObjectsIterator{Objects: pending})
+		if err == nil {
+			return nil
+		}
+
+		batchErr, ok := err.(*s3manager.BatchError)
+		if !ok || attempt == retries {
+			return uploadError(err, len(objects))
+		}
+
+		failed := map[string]bool{}
+		for _, e := range batchErr.Errors {
+			failed[aws.StringValue(e.Key)] = true
+		}
+
+		var retry []s3manager.BatchUploadObject
+		for _, o := range pending {
+			if !failed[aws.StringValue(o.Object.Key)] {
+				continue
+			}
+
+			// The failed attempt may have consumed part of the body
+			body, ok := o.Object.Body.(io.Seeker)
+			if !ok {
+				return uploadError(err, len(objects))
+			}
+
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return uploadError(err, len(objects))
+			}
+
+			retry = append(retry, o)
+		}
+
+		// Failures of keys which aren't pending can't be retried, and
+		// would be lost if the others then succeeded
+		if len(retry) == 0 || len(retry) < len(failed) {
+			return uploadError(err, len(objects))
+		}
+		pending = retry
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
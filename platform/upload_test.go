@@ -0,0 +1,171 @@
+package platform
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// fakeUploader reads the body of every object it is given, then fails the
+// keys listed for the attempt, whether it was given them or not.
+type fakeUploader struct {
+	// fail lists the keys failed by each attempt, later attempts succeed
+	fail [][]string
+
+	// batches are the keys of each attempt, and bodies what was read for
+	// each key on every attempt
+	batches [][]string
+	bodies  map[string][]string
+}
+
+func (u *fakeUploader) UploadWithIterator(ctx aws.Context, iter s3manager.BatchUploadIterator, opts ...func(*s3manager.Uploader)) error {
+	var keys []string
+	for iter.Next() {
+		in := iter.UploadObject().Object
+
+		body, err := ioutil.ReadAll(in.Body)
+		if err != nil {
+			return err
+		}
+
+		key := aws.StringValue(in.Key)
+		keys = append(keys, key)
+		u.bodies[key] = append(u.bodies[key], string(body))
+	}
+
+	attempt := len(u.batches)
+	u.batches = append(u.batches, keys)
+
+	if attempt >= len(u.fail) {
+		return nil
+	}
+
+	var errs []s3manager.Error
+	for _, key := range u.fail[attempt] {
+		errs = append(errs, s3manager.Error{
+			OrigErr: errors.New("SlowDown"),
+			Bucket:  aws.String("bucket"),
+			Key:     aws.String(key),
+		})
+	}
+
+	return s3manager.NewBatchError("BatchedUploadIncomplete", "some objects have failed to upload.", errs)
+}
+
+func testObjects(keys ...string) []s3manager.BatchUploadObject {
+	objects := make([]s3manager.BatchUploadObject, len(keys))
+	for i, k := range keys {
+		objects[i] = s3manager.BatchUploadObject{Object: &s3manager.UploadInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String(k),
+			Body:   bytes.NewReader([]byte("body of " + k)),
+		}}
+	}
+
+	return objects
+}
+
+func TestUploadObjects(t *testing.T) {
+	defer func(d time.Duration) { uploadBackoff = d }(uploadBackoff)
+	uploadBackoff = time.Millisecond
+
+	retries := func(n int) *int { return &n }
+
+	cases := []struct {
+		name       string
+		maxRetries *int
+		fail       [][]string
+		batches    [][]string
+		failed     []string
+	}{
+		{
+			name:    "success",
+			batches: [][]string{{"a", "b", "c"}},
+		},
+		{
+			name:    "only failed keys are retried",
+			fail:    [][]string{{"b", "c"}, {"c"}},
+			batches: [][]string{{"a", "b", "c"}, {"b", "c"}, {"c"}},
+		},
+		{
+			name:       "failure once retries run out",
+			maxRetries: retries(1),
+			fail:       [][]string{{"b"}, {"b"}},
+			batches:    [][]string{{"a", "b", "c"}, {"b"}},
+			failed:     []string{"b"},
+		},
+		{
+			name:       "no retries",
+			maxRetries: retries(0),
+			fail:       [][]string{{"a"}},
+			batches:    [][]string{{"a", "b", "c"}},
+			failed:     []string{"a"},
+		},
+		{
+			name:    "failed keys which aren't pending",
+			fail:    [][]string{{"x"}},
+			batches: [][]string{{"a", "b", "c"}},
+			failed:  []string{"x"},
+		},
+		{
+			name:    "failed keys partly pending",
+			fail:    [][]string{{"b", "x"}},
+			batches: [][]string{{"a", "b", "c"}},
+			failed:  []string{"b", "x"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Platform{config: DeployConfig{MaxRetries: tc.maxRetries}}
+			u := &fakeUploader{fail: tc.fail, bodies: map[string][]string{}}
+
+			err := p.uploadObjects(aws.BackgroundContext(), u, testObjects("a", "b", "c"))
+
+			if !reflect.DeepEqual(u.batches, tc.batches) {
+				t.Errorf("batches = %v, want %v", u.batches, tc.batches)
+			}
+
+			// Every attempt reads the whole body, as retried bodies are
+			// rewound
+			for key, bodies := range u.bodies {
+				for i, body := range bodies {
+					if body != "body of "+key {
+						t.Errorf("attempt %d of %s read %q", i, key, body)
+					}
+				}
+			}
+
+			if tc.failed == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			var failure *partialFailure
+			if !errors.As(err, &failure) {
+				t.Fatalf("error = %v, want a partialFailure", err)
+			}
+
+			var failed []string
+			for _, e := range failure.Errors {
+				failed = append(failed, e.Key)
+			}
+
+			if !reflect.DeepEqual(failed, tc.failed) {
+				t.Errorf("failed keys = %v, want %v", failed, tc.failed)
+			}
+
+			if failure.Total != 3 {
+				t.Errorf("total = %d, want 3", failure.Total)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package platform
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	versioningWarn            = "warn"
+	versioningIgnore          = "ignore"
+	versioningPurgeNoncurrent = "purge-noncurrent"
+)
+
+// versioningBehaviors are the accepted values of HandleVersioning.
+var versioningBehaviors = []string{versioningWarn, versioningIgnore, versioningPurgeNoncurrent}
+
+func validVersioningBehavior(s string) bool {
+	for _, known := range versioningBehaviors {
+		if s == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// versioningBehavior returns HandleVersioning, defaulting to "warn".
+func (p *Platform) versioningBehavior() string {
+	if p.config.HandleVersioning == "" {
+		return versioningWarn
+	}
+
+	return p.config.HandleVersioning
+}
+
+// checkVersioning reports whether the bucket keeps object versions, which
+// it does once versioning has been enabled, even if it is now suspended.
+// With the "warn" behavior it warns that overwritten and pruned objects
+// are kept as noncurrent versions. The check is best effort.
+func (p *Platform) checkVersioning(ctx context.Context, log hclog.Logger, sg terminal.StepGroup, svc *s3.S3) bool {
+	out, err := svc.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(p.config.BucketName),
+	})
+	if err != nil {
+		log.Debug("unable to read bucket versioning", "error", awsutil.Describe(err))
+		return false
+	}
+
+	versioned := aws.StringValue(out.Status) != ""
+	if versioned && p.versioningBehavior() == versioningWarn {
+		warn(sg, "Bucket %q is versioned, overwritten and pruned objects are kept as noncurrent versions and still billed. "+
+			"Set handle_versioning to \"purge-noncurrent\" to delete them, or \"ignore\" to silence this warning", p.config.BucketName)
+	}
+
+	return versioned
+}
+
+// purgeNoncurrent deletes every noncurrent version and delete marker in the
+// bucket, then the delete markers which are the current version of their
+// key, such as those left by prune. The markers go last so an older
+// version of a pruned key is never exposed again. It returns the number of
+// versions deleted.
+func (p *Platform) purgeNoncurrent(ctx context.Context, svc *s3.S3) (int, error) {
+	var noncurrent, markers []*s3.ObjectIdentifier
+
+	err := svc.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(p.config.BucketName),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		for _, v := range page.Versions {
+			if !aws.BoolValue(v.IsLatest) {
+				noncurrent = append(noncurrent, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+			}
+		}
+
+		for _, m := range page.DeleteMarkers {
+			id := &s3.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId}
+			if aws.BoolValue(m.IsLatest) {
+				markers = append(markers, id)
+			} else {
+				noncurrent = append(noncurrent, id)
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return 0, awsutil.Error(codes.Internal, err, "unable to list object versions")
+	}
+
+	if err := p.deleteObjects(ctx, svc, noncurrent); err != nil {
+		return 0, err
+	}
+
+	if err := p.deleteObjects(ctx, svc, markers); err != nil {
+		return len(noncurrent), err
+	}
+
+	return len(noncurrent) + len(markers), nil
+}
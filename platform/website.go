@@ -0,0 +1,63 @@
+package platform
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+)
+
+// defaultIndexDocument is the index document configured by EnableWebsite
+// when IndexDocument is not set.
+const defaultIndexDocument = "index.html"
+
+func (p *Platform) indexDocument() string {
+	if p.config.IndexDocument != "" {
+		return p.config.IndexDocument
+	}
+
+	return defaultIndexDocument
+}
+
+// configuredWebsite is the website configuration EnableWebsite puts on the
+// bucket, in the form GetBucketWebsite returns it. With AtomicSwap it
+// serves the generation being deployed.
+func (p *Platform) configuredWebsite() *s3.GetBucketWebsiteOutput {
+	out := &s3.GetBucketWebsiteOutput{
+		IndexDocument: &s3.IndexDocument{Suffix: aws.String(p.indexDocument())},
+	}
+
+	if p.config.ErrorDocument != "" {
+		key := strings.TrimPrefix(p.config.ErrorDocument, "/")
+		if p.swapTo != "" {
+			key = p.swapTo + "/" + key
+		}
+
+		out.ErrorDocument = &s3.ErrorDocument{Key: aws.String(key)}
+	}
+
+	if p.swapTo != "" {
+		out.RoutingRules = awsutil.SwapRoutingRules(p.swapRoot(), p.swapTo, p.swapFallback())
+	}
+
+	return out
+}
+
+// enableWebsite turns on static website hosting for the bucket, replacing
+// any existing website configuration.
+func (p *Platform) enableWebsite(ctx context.Context, svc *s3.S3) error {
+	website := p.configuredWebsite()
+
+	_, err := svc.PutBucketWebsiteWithContext(ctx, &s3.PutBucketWebsiteInput{
+		Bucket: aws.String(p.config.BucketName),
+		WebsiteConfiguration: &s3.WebsiteConfiguration{
+			IndexDocument: website.IndexDocument,
+			ErrorDocument: website.ErrorDocument,
+			RoutingRules:  website.RoutingRules,
+		},
+	})
+
+	return err
+}
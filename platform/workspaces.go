@@ -0,0 +1,150 @@
+package platform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/waypoint-plugin-s3/internal/validate"
+)
+
+// Workspace overrides options of the deploy stanza in one Waypoint
+// workspace, e.g. to deploy "staging" and "production" to different
+// buckets from the same stanza. Options which are not set keep the value
+// of the stanza.
+type Workspace struct {
+	// Name is the Waypoint workspace the overrides apply to
+	Name string `hcl:"name,label"`
+
+	Region                   *string           `hcl:"region,optional"`
+	BucketName               *string           `hcl:"bucket_name,optional"`
+	CloudFrontDistributionID *string           `hcl:"cloudfront_distribution_id,optional"`
+	ResourceTags             map[string]string `hcl:"resource_tags,optional"`
+	CacheControl             *string           `hcl:"cache_control,optional"`
+	ACL                      *string           `hcl:"acl,optional"`
+	StorageClass             *string           `hcl:"storage_class,optional"`
+	EnableWebsite            *bool             `hcl:"enable_website,optional"`
+	Prune                    *bool             `hcl:"prune,optional"`
+}
+
+// findWorkspace returns the overrides of workspace, or nil.
+func findWorkspace(workspaces []Workspace, workspace string) *Workspace {
+	for i := range workspaces {
+		if workspaces[i].Name == workspace {
+			return &workspaces[i]
+		}
+	}
+
+	return nil
+}
+
+// withWorkspace returns c with the options set in w overriding its own.
+// The result has no workspaces of its own.
+func (c DeployConfig) withWorkspace(w *Workspace) DeployConfig {
+	c.Workspaces = nil
+	if w == nil {
+		return c
+	}
+
+	overrideString(&c.Region, w.Region)
+	overrideString(&c.BucketName, w.BucketName)
+	overrideString(&c.CloudFrontDistributionID, w.CloudFrontDistributionID)
+	overrideString(&c.CacheControl, w.CacheControl)
+	overrideString(&c.ACL, w.ACL)
+	overrideString(&c.StorageClass, w.StorageClass)
+
+	if w.ResourceTags != nil {
+		c.ResourceTags = w.ResourceTags
+	}
+
+	if w.EnableWebsite != nil {
+		c.EnableWebsite = *w.EnableWebsite
+	}
+
+	if w.Prune != nil {
+		c.Prune = *w.Prune
+	}
+
+	return c
+}
+
+func overrideString(dst *string, src *string) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+// configureWorkspaces checks every workspace is named once and that the
+// stanza is valid with each one's overrides. The stanza itself doesn't have
+// to be, e.g. when every block sets bucket_name, so it is only checked on
+// its own when a workspace without a block is deployed, see useWorkspace.
+// Problems every workspace has are reported once for the stanza. It keeps c
+// as the base the overrides are applied to at deploy time.
+func (p *Platform) configureWorkspaces(c *DeployConfig, v *validate.Errors) {
+	if len(c.Workspaces) == 0 {
+		return
+	}
+
+	var (
+		names    []string
+		problems = map[string][]string{}
+		count    = map[string]int{}
+		seen     = map[string]bool{}
+	)
+
+	for i := range c.Workspaces {
+		w := &c.Workspaces[i]
+
+		if seen[w.Name] {
+			v.Add("workspace", "%q is defined more than once", w.Name)
+			continue
+		}
+		seen[w.Name] = true
+
+		merged := c.withWorkspace(w)
+		wv := validate.New("deploy")
+		(&Platform{}).configure(&merged, wv)
+
+		names = append(names, w.Name)
+		problems[w.Name] = wv.Problems()
+		for _, problem := range wv.Problems() {
+			count[problem]++
+		}
+	}
+
+	shared := map[string]bool{}
+	for _, name := range names {
+		for _, problem := range problems[name] {
+			switch {
+			case count[problem] < len(names):
+				v.Add(fmt.Sprintf("workspace %q", name), "%s", problem)
+			case !shared[problem]:
+				shared[problem] = true
+				v.AddProblem(problem)
+			}
+		}
+	}
+
+	p.base = *c
+}
+
+// useWorkspace configures b with the base stanza, overridden by the
+// workspace block of workspace if there is one. It does nothing without
+// workspace blocks.
+func (b *Platform) useWorkspace(workspace string) error {
+	if len(b.base.Workspaces) == 0 {
+		return nil
+	}
+
+	w := findWorkspace(b.base.Workspaces, workspace)
+	config := b.base.withWorkspace(w)
+	if err := b.ConfigSet(&config); err != nil {
+		if w == nil {
+			return fmt.Errorf("workspace %q has no workspace block, so the stanza is used on its own: %w", workspace, err)
+		}
+
+		return err
+	}
+
+	b.config = config
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package platform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWorkspacesValidateMergedConfig(t *testing.T) {
+	region := "eu-west-1"
+	staging, production := "example-staging", "example-production"
+
+	cases := []struct {
+		name       string
+		workspaces []Workspace
+		want       []string
+		notWant    []string
+	}{
+		{
+			name: "every block completes the stanza",
+			workspaces: []Workspace{
+				{Name: "staging", Region: &region, BucketName: &staging},
+				{Name: "production", Region: &region, BucketName: &production},
+			},
+		},
+		{
+			name: "one block leaves the stanza incomplete",
+			workspaces: []Workspace{
+				{Name: "staging", Region: &region, BucketName: &staging},
+				{Name: "production", Region: &region},
+			},
+			want:    []string{`workspace "production": bucket_name`},
+			notWant: []string{`workspace "staging"`},
+		},
+		{
+			name: "problems of every block are reported once",
+			workspaces: []Workspace{
+				{Name: "staging", BucketName: &staging},
+				{Name: "production", BucketName: &production},
+			},
+			want:    []string{"- region: must be set"},
+			notWant: []string{`workspace "staging": region`, `workspace "production": region`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Platform{}
+			err := p.ConfigSet(&DeployConfig{Workspaces: tc.workspaces})
+
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Fatalf("invalid config: %s", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("config is valid")
+			}
+			for _, s := range tc.want {
+				if !strings.Contains(err.Error(), s) {
+					t.Errorf("error %q doesn't contain %q", err, s)
+				}
+			}
+			for _, s := range tc.notWant {
+				if strings.Contains(err.Error(), s) {
+					t.Errorf("error %q contains %q", err, s)
+				}
+			}
+		})
+	}
+}
+
+func TestUseWorkspaceWithoutBlock(t *testing.T) {
+	region := "eu-west-1"
+	production := "example-production"
+
+	c := DeployConfig{
+		Region:     region,
+		Workspaces: []Workspace{{Name: "production", BucketName: &production}},
+	}
+
+	p := &Platform{}
+	if err := p.ConfigSet(&c); err != nil {
+		t.Fatalf("invalid config: %s", err)
+	}
+
+	if err := p.useWorkspace("production"); err != nil {
+		t.Fatalf("production: %s", err)
+	}
+	if p.config.BucketName != production {
+		t.Errorf("production deploys to %q, want %q", p.config.BucketName, production)
+	}
+
+	err := p.useWorkspace("default")
+	if err == nil {
+		t.Fatal("a workspace without a block deployed an incomplete stanza")
+	}
+	if !strings.Contains(err.Error(), `workspace "default" has no workspace block`) {
+		t.Errorf("error %q doesn't name the workspace", err)
+	}
+}
@@ -0,0 +1,321 @@
+package registry
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/waypoint-plugin-s3/builder"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// writeArchive writes the files under dir to w as a gzipped tarball. The
+// output only depends on the file names and contents: entries are in
+// lexical order and timestamps, owners and permissions are normalized, so
+// the same artifact always has the same checksum. Symbolic links are
+// archived as their target, as the platform reads them when it deploys a
+// directory: a link to a file becomes a copy of it, and a link to a
+// directory an empty directory.
+func writeArchive(dir string, w io.Writer) error {
+	gz, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(gz)
+
+	// filepath.Walk visits files in lexical order
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(p)
+			if err != nil {
+				return fmt.Errorf("%s: unable to resolve symbolic link: %w", rel, err)
+			}
+		}
+
+		hdr := &tar.Header{
+			Name:    filepath.ToSlash(rel),
+			ModTime: time.Unix(0, 0),
+			Format:  tar.FormatPAX,
+		}
+
+		switch {
+		case info.IsDir():
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+			hdr.Mode = 0755
+			return tw.WriteHeader(hdr)
+		case info.Mode().IsRegular():
+			hdr.Typeflag = tar.TypeReg
+			hdr.Mode = 0644
+			hdr.Size = info.Size()
+		default:
+			return fmt.Errorf("%s: only regular files and directories can be archived", rel)
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// walkArchive calls fn for each entry of a tarball written by
+// writeArchive, with the entry's cleaned path. The body of a file is only
+// valid during the call, and directories have none.
+func walkArchive(r io.Reader, fn func(name string, hdr *tar.Header, body io.Reader) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Refuse entries which would be written outside the root
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("%s: invalid path in archive", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg:
+		default:
+			return fmt.Errorf("%s: unsupported entry type in archive", hdr.Name)
+		}
+
+		if err := fn(name, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// extractArchive unpacks a tarball written by writeArchive into dir.
+func extractArchive(r io.Reader, dir string) error {
+	return walkArchive(r, func(name string, hdr *tar.Header, body io.Reader) error {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		if hdr.Typeflag == tar.TypeDir {
+			return os.MkdirAll(target, 0755)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		return extractFile(body, target)
+	})
+}
+
+func extractFile(r io.Reader, target string) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// pushArchive archives the artifact at dir and uploads it to the
+// configured bucket, returning the stored object's key, size and checksum.
+func (r *Registry) pushArchive(ctx context.Context, dir string) (string, int64, string, error) {
+	tmp, err := os.CreateTemp("", "waypoint-plugin-s3-*.tar.gz")
+	if err != nil {
+		return "", 0, "", status.Errorf(codes.FailedPrecondition, "unable to create archive: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if err := writeArchive(dir, io.MultiWriter(tmp, h)); err != nil {
+		return "", 0, "", status.Errorf(codes.Internal, "unable to archive artifact: %s", err)
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", 0, "", err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	sess, err := r.sessionConfig().Session()
+	if err != nil {
+		return "", 0, "", status.Errorf(codes.FailedPrecondition, "unable to create AWS session: %s", err)
+	}
+
+	key := r.versionKey()
+	if r.config.ContentAddressed {
+		key = r.blobKey(sum)
+
+		// A blob's key is derived from its content, so an existing one
+		// already holds this artifact
+		exists, err := r.blobExists(ctx, s3.New(sess), key)
+		if err != nil {
+			return "", 0, "", awsutil.Error(codes.Internal, err, "unable to check for artifact s3://%s/%s", r.config.Bucket, key)
+		}
+
+		if exists {
+			return key, size, sum, r.putAlias(ctx, s3.New(sess), key, size, sum)
+		}
+	}
+
+	_, err = s3manager.NewUploader(sess).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(r.config.Bucket),
+		Key:         aws.String(key),
+		Body:        tmp,
+		ContentType: aws.String("application/gzip"),
+		Metadata:    map[string]*string{"sha256": aws.String(sum)},
+		Tagging:     awsutil.ObjectTagging(r.config.ResourceTags),
+	})
+	if err != nil {
+		return "", 0, "", awsutil.Error(codes.Internal, err, "unable to upload artifact to bucket %q", r.config.Bucket)
+	}
+
+	if r.config.ContentAddressed {
+		return key, size, sum, r.putAlias(ctx, s3.New(sess), key, size, sum)
+	}
+
+	return key, size, sum, nil
+}
+
+// Fetch returns a local directory holding the artifact. An artifact
+// stored in S3 or an OCI registry whose local copy is gone, e.g. because
+// the deploy runs on another runner than the push, is downloaded, verified
+// against its recorded checksum and extracted into a new temporary
+// directory. The region of sc is replaced by the artifact's, and auth, if
+// set, is used to pull from an OCI registry.
+func (z *Zip) Fetch(ctx context.Context, sc awsutil.SessionConfig, auth *builder.ImageAuth) (string, error) {
+	if z.Key == "" && z.OciDigest == "" {
+		return z.Path, nil
+	}
+
+	if _, err := os.Stat(z.Path); err == nil {
+		return z.Path, nil
+	}
+
+	if z.OciDigest != "" {
+		return z.fetchOCI(ctx, auth)
+	}
+
+	body, err := z.download(ctx, sc)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	dir, err := os.MkdirTemp("", "waypoint-plugin-s3")
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "unable to create tmp directory: %s", err)
+	}
+
+	h := sha256.New()
+	if err := extractArchive(io.TeeReader(body, h), dir); err != nil {
+		os.RemoveAll(dir)
+		return "", status.Errorf(codes.Internal, "unable to extract artifact s3://%s/%s: %s", z.Bucket, z.Key, err)
+	}
+
+	if err := z.verify(body, h); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// download opens the archive stored in S3. The region of sc is replaced by
+// the artifact's.
+func (z *Zip) download(ctx context.Context, sc awsutil.SessionConfig) (io.ReadCloser, error) {
+	sc.Region = z.Region
+	sess, err := sc.Session()
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "unable to create AWS session: %s", err)
+	}
+
+	out, err := s3.New(sess).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(z.Bucket),
+		Key:    aws.String(z.Key),
+	})
+	if err != nil {
+		return nil, awsutil.Error(codes.FailedPrecondition, err, "unable to download artifact s3://%s/%s", z.Bucket, z.Key)
+	}
+
+	return out.Body, nil
+}
+
+// verify checks h, which hashed the archive read from body so far, matches
+// the recorded checksum once the rest of body is read.
+func (z *Zip) verify(body io.Reader, h hash.Hash) error {
+	// Read any trailing bytes the tar reader left so the whole object is
+	// covered by the checksum
+	if _, err := io.Copy(h, body); err != nil {
+		return status.Errorf(codes.Internal, "unable to download artifact s3://%s/%s: %s", z.Bucket, z.Key, err)
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != z.Sha256 {
+		return status.Errorf(codes.DataLoss, "artifact s3://%s/%s has checksum %s, expected %s", z.Bucket, z.Key, sum, z.Sha256)
+	}
+
+	return nil
+}
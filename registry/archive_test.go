@@ -0,0 +1,172 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files, mapping slash separated paths to their
+// contents, under dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for p, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the files under dir, mapping slash separated paths to
+// their contents, with directories mapped to "/".
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			files[filepath.ToSlash(rel)] = "/"
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"index.html":    "<html></html>",
+		"assets/app.js": "console.log(1)",
+		"empty/.keep":   "",
+	})
+
+	var first, second bytes.Buffer
+	if err := writeArchive(src, &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeArchive(src, &second); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("archiving the same directory twice gave different archives")
+	}
+
+	dst := t.TempDir()
+	if err := extractArchive(&first, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := readTree(t, dst), readTree(t, src); !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted %v, want %v", got, want)
+	}
+}
+
+func TestArchiveSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	writeTree(t, outside, map[string]string{"shared.css": "body {}"})
+
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"index.html":      "<html></html>",
+		"dir/nested.html": "nested",
+	})
+
+	links := map[string]string{
+		"latest.html": "index.html",
+		"shared.css":  filepath.Join(outside, "shared.css"),
+		"linked":      "dir",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(src, name)); err != nil {
+			t.Skipf("symbolic links are not supported: %s", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeArchive(src, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := extractArchive(&buf, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"index.html":      "<html></html>",
+		"dir":             "/",
+		"dir/nested.html": "nested",
+		"latest.html":     "<html></html>",
+		"shared.css":      "body {}",
+		"linked":          "/",
+	}
+	if got := readTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted %v, want %v", got, want)
+	}
+}
+
+func TestArchiveBrokenSymlink(t *testing.T) {
+	src := t.TempDir()
+	if err := os.Symlink("missing.html", filepath.Join(src, "broken.html")); err != nil {
+		t.Skipf("symbolic links are not supported: %s", err)
+	}
+
+	err := writeArchive(src, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "broken.html") {
+		t.Fatalf("error = %v, want one naming broken.html", err)
+	}
+}
+
+func TestExtractArchiveRejectsEscapes(t *testing.T) {
+	for _, name := range []string{"../evil", "/etc/evil", "a/../../evil"} {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		tw.Close()
+		gz.Close()
+
+		dst := t.TempDir()
+		err := extractArchive(&buf, filepath.Join(dst, "out"))
+		if err == nil || !strings.Contains(err.Error(), "invalid path") {
+			t.Errorf("extracting %q: error = %v, want an invalid path", name, err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dst, "evil")); err == nil {
+			t.Errorf("extracting %q wrote outside the directory", name)
+		}
+	}
+}
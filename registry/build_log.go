@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// buildLogKey is the key of the build log of the configured version.
+func (r *Registry) buildLogKey() string {
+	return path.Join(r.config.Name, r.config.Version+".log")
+}
+
+// pushBuildLog uploads the build log at p next to the artifact and
+// returns its key.
+func (r *Registry) pushBuildLog(ctx context.Context, p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "unable to read build log: %s", err)
+	}
+	defer f.Close()
+
+	sess, err := r.sessionConfig().Session()
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "unable to create AWS session: %s", err)
+	}
+
+	key := r.buildLogKey()
+
+	_, err = s3manager.NewUploader(sess).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(r.config.Bucket),
+		Key:         aws.String(key),
+		Body:        f,
+		ContentType: aws.String("text/plain; charset=utf-8"),
+		Tagging:     awsutil.ObjectTagging(r.config.ResourceTags),
+	})
+	if err != nil {
+		return "", awsutil.Error(codes.Internal, err, "unable to upload build log to bucket %q", r.config.Bucket)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"google.golang.org/grpc/codes"
+)
+
+// alias is the object stored at the version key of a content-addressed
+// artifact, naming the blob holding it.
+type alias struct {
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// versionKey is the key of the tarball of the configured version.
+func (r *Registry) versionKey() string {
+	return path.Join(r.config.Name, r.config.Version+".tar.gz")
+}
+
+// aliasKey is the key of the alias of the configured version.
+func (r *Registry) aliasKey() string {
+	return path.Join(r.config.Name, r.config.Version+".json")
+}
+
+// blobKey is the key of the content-addressed tarball with checksum sum.
+func (r *Registry) blobKey(sum string) string {
+	return path.Join(r.config.Name, "sha256", sum+".tar.gz")
+}
+
+// blobExists reports whether a blob was already pushed to key.
+func (r *Registry) blobExists(ctx context.Context, svc *s3.S3, key string) (bool, error) {
+	_, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r.config.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// putAlias points the version key at the blob holding the artifact.
+func (r *Registry) putAlias(ctx context.Context, svc *s3.S3, key string, size int64, sum string) error {
+	data, err := json.Marshal(&alias{Key: key, Size: size, Sha256: sum})
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(r.config.Bucket),
+		Key:         aws.String(r.aliasKey()),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+		Tagging:     awsutil.ObjectTagging(r.config.ResourceTags),
+	})
+	if err != nil {
+		return awsutil.Error(codes.Internal, err, "unable to write artifact alias s3://%s/%s", r.config.Bucket, r.aliasKey())
+	}
+
+	return nil
+}
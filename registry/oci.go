@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/hashicorp/waypoint-plugin-s3/builder"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ociLayerMediaType is the media type of the single layer of an OCI
+// artifact, holding the tarball written by writeArchive.
+const ociLayerMediaType types.MediaType = "application/vnd.waypoint.s3.site.layer.v1.tar+gzip"
+
+// ociAuth returns the credentials of a, or the Docker config of the runner
+// if a is nil.
+func ociAuth(a *builder.ImageAuth) remote.Option {
+	if a != nil {
+		return remote.WithAuth(authn.FromConfig(authn.AuthConfig{
+			Username:      a.Username,
+			Password:      a.Password,
+			IdentityToken: a.IdentityToken,
+		}))
+	}
+
+	return remote.WithAuthFromKeychain(authn.DefaultKeychain)
+}
+
+// ociArtifact is an image whose manifest describes its config with the OCI
+// media type. empty.Image describes it with the Docker one, which
+// mutate.MediaType leaves as is, and strict registries reject manifests
+// mixing the two.
+type ociArtifact struct {
+	v1.Image
+}
+
+// MediaType implements v1.Image.
+func (a ociArtifact) MediaType() (types.MediaType, error) {
+	return types.OCIManifestSchema1, nil
+}
+
+// Manifest implements v1.Image.
+func (a ociArtifact) Manifest() (*v1.Manifest, error) {
+	m, err := a.Image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	m = m.DeepCopy()
+	m.MediaType = types.OCIManifestSchema1
+	m.Config.MediaType = types.OCIConfigJSON
+
+	return m, nil
+}
+
+// RawManifest implements v1.Image.
+func (a ociArtifact) RawManifest() ([]byte, error) {
+	m, err := a.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(m)
+}
+
+// Digest implements v1.Image.
+func (a ociArtifact) Digest() (v1.Hash, error) {
+	return partial.Digest(a)
+}
+
+// Size implements v1.Image.
+func (a ociArtifact) Size() (int64, error) {
+	return partial.Size(a)
+}
+
+// pushOCI archives the artifact at dir and pushes it as an OCI artifact to
+// OCIReference, returning the manifest digest and the digest reference of
+// the artifact. The archive is deterministic, so pushing the same artifact
+// twice yields the same digest.
+func (r *Registry) pushOCI(ctx context.Context, dir string) (string, string, error) {
+	ref, err := name.ParseReference(r.config.OCIReference)
+	if err != nil {
+		return "", "", status.Errorf(codes.InvalidArgument, "invalid oci_reference: %s", err)
+	}
+
+	tmp, err := os.CreateTemp("", "waypoint-plugin-s3-*.tar.gz")
+	if err != nil {
+		return "", "", status.Errorf(codes.FailedPrecondition, "unable to create archive: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := writeArchive(dir, tmp); err != nil {
+		return "", "", status.Errorf(codes.Internal, "unable to archive artifact: %s", err)
+	}
+
+	layer, err := tarball.LayerFromFile(tmp.Name())
+	if err != nil {
+		return "", "", status.Errorf(codes.Internal, "unable to read archive: %s", err)
+	}
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:     layer,
+		MediaType: ociLayerMediaType,
+	})
+	if err != nil {
+		return "", "", status.Errorf(codes.Internal, "unable to create OCI artifact: %s", err)
+	}
+	img = ociArtifact{img}
+
+	if err := remote.Write(ref, img, remote.WithContext(ctx), ociAuth(r.config.OCIAuth)); err != nil {
+		return "", "", status.Errorf(codes.Unavailable, "unable to push artifact to %s: %s", ref, err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", "", status.Errorf(codes.Internal, "unable to compute artifact digest: %s", err)
+	}
+
+	return digest.String(), ref.Context().Digest(digest.String()).String(), nil
+}
+
+// fetchOCI pulls the artifact pushed by pushOCI and extracts it into a new
+// temporary directory. The artifact is pulled by digest with auth, or the
+// Docker config of the runner if nil, and its layer is verified against the
+// digest as it is read.
+func (z *Zip) fetchOCI(ctx context.Context, auth *builder.ImageAuth) (string, error) {
+	ref, err := name.ParseReference(z.OciReference)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "invalid artifact reference %q: %s", z.OciReference, err)
+	}
+	digest := ref.Context().Digest(z.OciDigest)
+
+	img, err := remote.Image(digest, remote.WithContext(ctx), ociAuth(auth))
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "unable to pull artifact %s: %s", digest, err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "unable to read artifact %s: %s", digest, err)
+	}
+
+	if len(layers) != 1 {
+		return "", status.Errorf(codes.FailedPrecondition, "artifact %s has %d layers, expected 1", digest, len(layers))
+	}
+
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "unable to pull artifact %s: %s", digest, err)
+	}
+	defer rc.Close()
+
+	dir, err := os.MkdirTemp("", "waypoint-plugin-s3")
+	if err != nil {
+		return "", status.Errorf(codes.FailedPrecondition, "unable to create tmp directory: %s", err)
+	}
+
+	if err := extractArchive(rc, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", status.Errorf(codes.Internal, "unable to extract artifact %s: %s", digest, err)
+	}
+
+	// The digest is checked once the layer has been read to the end
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		os.RemoveAll(dir)
+		return "", status.Errorf(codes.DataLoss, "unable to verify artifact %s: %s", digest, err)
+	}
+
+	return dir, nil
+}
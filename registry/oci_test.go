@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/hashicorp/waypoint-plugin-s3/builder"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+)
+
+// ociServer starts an in memory registry accepting only the basic auth of
+// auth.
+func ociServer(t *testing.T, auth *builder.ImageAuth) string {
+	t.Helper()
+
+	reg := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != auth.Username || pass != auth.Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		reg.ServeHTTP(w, req)
+	}))
+	t.Cleanup(srv.Close)
+
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestOCIRoundTrip(t *testing.T) {
+	// The runner has no Docker config to fall back to
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	auth := &builder.ImageAuth{Username: "ci", Password: "secret"}
+	host := ociServer(t, auth)
+
+	src := t.TempDir()
+	files := map[string]string{
+		"index.html":     "<html></html>",
+		"css/style.css":  "body {}",
+		"img/logo.svg":   "<svg/>",
+		"nested/a/b.txt": "b",
+	}
+	writeTree(t, src, files)
+
+	r := &Registry{config: RegistryConfig{
+		Name:         "site",
+		Version:      "1.4.2",
+		OCIReference: host + "/site:1.4.2",
+		OCIAuth:      auth,
+	}}
+
+	ctx := context.Background()
+	digest, _, err := r.pushOCI(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := name.ParseReference(host + "/site@" + digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := remote.Image(ref, ociAuth(auth))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.MediaType != types.OCIManifestSchema1 {
+		t.Errorf("manifest media type is %q, want %q", m.MediaType, types.OCIManifestSchema1)
+	}
+	if m.Config.MediaType != types.OCIConfigJSON {
+		t.Errorf("config media type is %q, want %q", m.Config.MediaType, types.OCIConfigJSON)
+	}
+	if len(m.Layers) != 1 || m.Layers[0].MediaType != ociLayerMediaType {
+		t.Errorf("layers are %+v, want a single %s layer", m.Layers, ociLayerMediaType)
+	}
+
+	z := &Zip{Path: "/does/not/exist", OciReference: r.config.OCIReference, OciDigest: digest}
+
+	if _, err := z.Fetch(ctx, awsutil.SessionConfig{}, nil); err == nil {
+		t.Fatal("pulling without credentials succeeded")
+	}
+
+	dir, err := z.Fetch(ctx, awsutil.SessionConfig{}, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := readTree(t, dir)
+	want := map[string]string{"css": "/", "img": "/", "nested": "/", "nested/a": "/"}
+	for p, content := range files {
+		want[p] = content
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pulled %v, want %v", got, want)
+	}
+}
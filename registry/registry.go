@@ -3,18 +3,81 @@ package registry
 import (
 	"context"
 	"fmt"
+	"os"
+	"sync"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/hashicorp/waypoint-plugin-s3/builder"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/validate"
 	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
 )
 
 type RegistryConfig struct {
 	Name    string `hcl:"name"`
 	Version string `hcl:"version"`
+
+	// Bucket stores each pushed version as a single gzipped tarball at
+	// "<name>/<version>.tar.gz". Without it the artifact stays on the
+	// local filesystem.
+	Bucket string `hcl:"bucket,optional"`
+
+	// ContentAddressed stores each tarball at "<name>/sha256/<sum>.tar.gz",
+	// so byte-identical versions share one object, and writes a small JSON
+	// alias naming it to "<name>/<version>.json".
+	ContentAddressed bool `hcl:"content_addressed,optional"`
+
+	// Region is the region of Bucket.
+	Region string `hcl:"region,optional"`
+
+	// ResourceTags are applied to the objects pushed to Bucket.
+	ResourceTags map[string]string `hcl:"resource_tags,optional"`
+
+	// MinTLSVersion is the lowest TLS version, e.g. "1.2", used to connect
+	// to AWS.
+	MinTLSVersion string `hcl:"min_tls_version,optional"`
+
+	// EndpointResolver maps AWS service IDs, such as "s3" and "sts", to the
+	// URL used instead of their default endpoint. "{region}" in a URL is
+	// replaced by the region. Other services resolve as usual.
+	EndpointResolver map[string]string `hcl:"endpoint_resolver,optional"`
+
+	// SharedConfigFile is the path of the AWS config file, replacing
+	// ~/.aws/config.
+	SharedConfigFile string `hcl:"shared_config_file,optional"`
+
+	// SharedCredentialsFile is the path of the AWS credentials file,
+	// replacing ~/.aws/credentials.
+	SharedCredentialsFile string `hcl:"shared_credentials_file,optional"`
+
+	// Profile is the AWS profile to use, e.g. an SSO or credential_process
+	// profile, instead of AWS_PROFILE or "default".
+	Profile string `hcl:"profile,optional"`
+
+	// CABundle is the path of a PEM file with certificate authorities
+	// trusted in addition to the system ones, e.g. for an on-premises
+	// S3-compatible endpoint.
+	CABundle string `hcl:"ca_bundle,optional"`
+
+	// InsecureSkipVerify disables TLS certificate verification. Only use it
+	// for testing.
+	InsecureSkipVerify bool `hcl:"insecure_skip_verify,optional"`
+
+	// OCIReference pushes each version as an OCI artifact to a container
+	// registry, e.g. "ghcr.io/org/site:1.2.3", instead of a bucket.
+	OCIReference string `hcl:"oci_reference,optional"`
+
+	// OCIAuth holds the credentials used to push to OCIReference. Without
+	// it the Docker config of the runner is used.
+	OCIAuth *builder.ImageAuth `hcl:"oci_auth,block"`
 }
 
 type Registry struct {
 	config RegistryConfig
+
+	// lastPush describes the artifact pushed in this run, if any
+	mu       sync.Mutex
+	lastPush *AccessInfo
 }
 
 // Implement Configurable
@@ -31,11 +94,72 @@ func (r *Registry) ConfigSet(config interface{}) error {
 	}
 
 	// validate the config
+	v := validate.New("registry")
+
 	if c.Name == "" {
-		return fmt.Errorf("name must be set to a valid directory")
+		v.Add("name", "must be set to a valid directory")
 	}
 
-	return nil
+	v.AddError("min_tls_version", awsutil.ValidateTLSVersion(c.MinTLSVersion))
+	v.AddError("endpoint_resolver", awsutil.ValidateEndpoints(c.EndpointResolver))
+	v.AddError("shared_config_file", awsutil.ValidateFile(c.SharedConfigFile))
+	v.AddError("shared_credentials_file", awsutil.ValidateFile(c.SharedCredentialsFile))
+	v.AddError("ca_bundle", awsutil.ValidateCABundle(c.CABundle))
+
+	if c.OCIReference != "" {
+		if c.Bucket != "" {
+			v.Add("oci_reference", "can't be combined with bucket")
+		}
+
+		if _, err := name.ParseReference(c.OCIReference); err != nil {
+			v.Add("oci_reference", "must be a valid image reference: %s", err)
+		}
+	}
+
+	if c.OCIAuth != nil {
+		if c.OCIReference == "" {
+			v.Add("oci_auth", "requires oci_reference to be set")
+		}
+
+		v.AddError("oci_auth", c.OCIAuth.Validate())
+	}
+
+	if c.Bucket != "" {
+		if c.Region == "" {
+			v.Add("region", "must be set when bucket is set")
+		}
+
+		if c.Version == "" {
+			v.Add("version", "must be set when bucket is set")
+		}
+	}
+
+	if c.ContentAddressed && c.Bucket == "" {
+		v.Add("content_addressed", "requires bucket to be set")
+	}
+
+	v.AddError("resource_tags", awsutil.ValidateTags(c.ResourceTags))
+
+	if len(c.ResourceTags) > 0 && c.Bucket == "" {
+		v.Add("resource_tags", "requires bucket to be set")
+	}
+
+	return v.Err()
+}
+
+// sessionConfig returns the options of the AWS session used to push to
+// Bucket.
+func (r *Registry) sessionConfig() awsutil.SessionConfig {
+	return awsutil.SessionConfig{
+		Region:                r.config.Region,
+		MinTLSVersion:         r.config.MinTLSVersion,
+		Endpoints:             r.config.EndpointResolver,
+		SharedConfigFile:      r.config.SharedConfigFile,
+		SharedCredentialsFile: r.config.SharedCredentialsFile,
+		Profile:               r.config.Profile,
+		CABundle:              r.config.CABundle,
+		InsecureSkipVerify:    r.config.InsecureSkipVerify,
+	}
 }
 
 // Implement Registry
@@ -43,8 +167,26 @@ func (r *Registry) AccessInfoFunc() interface{} {
 	return r.accessInfo
 }
 
+// accessInfo reports the artifact pushed in this run. Before a push it
+// returns the configured name and version with Pushed unset.
 func (r *Registry) accessInfo() (*AccessInfo, error) {
-	return &AccessInfo{}, nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p := r.lastPush; p != nil {
+		return &AccessInfo{
+			Name:     p.Name,
+			Version:  p.Version,
+			Location: p.Location,
+			Pushed:   p.Pushed,
+		}, nil
+	}
+
+	return &AccessInfo{
+		Name:    r.config.Name,
+		Version: r.config.Version,
+		Pushed:  false,
+	}, nil
 }
 
 // Implement Registry
@@ -81,7 +223,80 @@ func (r *Registry) push(ctx context.Context, ui terminal.UI, binary *builder.Zip
 	defer u.Close()
 	u.Update("Pushing binary to registry")
 
-	return &Zip{
+	result := &Zip{
 		Path: binary.Path,
-	}, nil
+	}
+	location := binary.Path
+
+	if r.config.Bucket != "" {
+		if r.config.InsecureSkipVerify {
+			ui.Output(awsutil.InsecureSkipVerifyWarning, terminal.WithWarningStyle())
+		}
+
+		u.Update(fmt.Sprintf("Uploading artifact to bucket %s", r.config.Bucket))
+
+		key, size, sum, err := r.pushArchive(ctx, binary.Path)
+		if err != nil {
+			u.Step(terminal.StatusError, "Unable to push artifact")
+			return nil, err
+		}
+
+		result.Bucket = r.config.Bucket
+		result.Region = r.config.Region
+		result.Key = key
+		result.Size = size
+		result.Sha256 = sum
+		location = fmt.Sprintf("s3://%s/%s", r.config.Bucket, key)
+
+		u.Step(terminal.StatusOK, fmt.Sprintf("Pushed %s (%d bytes, sha256 %s)", location, size, sum))
+	}
+
+	// The build log is only stored with artifacts pushed to a bucket
+	if binary.BuildLog != "" && r.config.Bucket == "" {
+		ui.Output(fmt.Sprintf("store_build_log is set but the registry has no bucket to store it in, it is left at %s", binary.BuildLog), terminal.WithWarningStyle())
+	}
+
+	if binary.BuildLog != "" && r.config.Bucket != "" {
+		u.Update("Uploading build log to bucket " + r.config.Bucket)
+
+		key, err := r.pushBuildLog(ctx, binary.BuildLog)
+		if err != nil {
+			u.Step(terminal.StatusError, "Unable to push build log")
+			return nil, err
+		}
+
+		// The log is stored in the bucket, the local copy is no longer needed
+		os.Remove(binary.BuildLog)
+
+		result.BuildLogKey = key
+
+		u.Step(terminal.StatusOK, fmt.Sprintf("Pushed build log to s3://%s/%s", r.config.Bucket, key))
+	}
+
+	if r.config.OCIReference != "" {
+		u.Update("Pushing artifact to " + r.config.OCIReference)
+
+		digest, ref, err := r.pushOCI(ctx, binary.Path)
+		if err != nil {
+			u.Step(terminal.StatusError, "Unable to push artifact")
+			return nil, err
+		}
+
+		result.OciReference = r.config.OCIReference
+		result.OciDigest = digest
+		location = ref
+
+		u.Step(terminal.StatusOK, "Pushed "+ref)
+	}
+
+	r.mu.Lock()
+	r.lastPush = &AccessInfo{
+		Name:     r.config.Name,
+		Version:  r.config.Version,
+		Location: location,
+		Pushed:   true,
+	}
+	r.mu.Unlock()
+
+	return result, nil
 }
@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-s3/builder"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+)
+
+func TestAccessInfo(t *testing.T) {
+	r := &Registry{config: RegistryConfig{Name: "site", Version: "1.4.2"}}
+
+	info, err := r.accessInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Pushed || info.Location != "" {
+		t.Errorf("before a push got %+v, want no artifact", info)
+	}
+	if info.Name != "site" || info.Version != "1.4.2" {
+		t.Errorf("before a push got name %q and version %q, want the configured ones", info.Name, info.Version)
+	}
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	if _, err := r.push(ctx, terminal.ConsoleUI(ctx), &builder.Zip{Path: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err = r.accessInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := AccessInfo{Name: "site", Version: "1.4.2", Location: dir, Pushed: true}
+	if info.Name != want.Name || info.Version != want.Version || info.Location != want.Location || info.Pushed != want.Pushed {
+		t.Errorf("after a push got %+v, want %+v", info, &want)
+	}
+
+	// Callers get a copy, not the recorded push
+	info.Location = "changed"
+	if again, _ := r.accessInfo(); again.Location != dir {
+		t.Errorf("changing the returned info changed the recorded push to %q", again.Location)
+	}
+}
@@ -3,9 +3,13 @@ package release
 import (
 	"context"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/hashicorp/go-hclog"
-	"github.com/hashicorp/waypoint-plugin-s3/registry"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
 	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/grpc/codes"
 )
 
 // Implement the Destroyer interface
@@ -65,15 +69,72 @@ func (rm *ReleaseManager) destroy(
 	return r.DestroyAll(ctx, log, sg, ui)
 }
 
+// resourceReleaseDestroy turns off website hosting if the release still
+// owns it, see claimWebsite. Website configuration which existed before the
+// plugin turned it on, or which a newer release relies on, is left alone.
 func (rm *ReleaseManager) resourceReleaseDestroy(
 	ctx context.Context,
 	log hclog.Logger,
-	st terminal.Status,
-	ui terminal.UI,
-	zip *registry.Zip,
-	result *Release,
+	sg terminal.StepGroup,
+	state *Resource_Release,
 ) error {
-	// Create your deployment resource here!
+	if !state.WebsiteCreated {
+		return nil
+	}
+
+	step := sg.Add("Disabling website hosting on bucket %s...", state.Bucket)
+	defer step.Abort()
+
+	sess, err := rm.sessionConfig(state.Region).Session()
+	if err != nil {
+		return err
+	}
+	svc := s3.New(sess)
+
+	// Releases from before the owner tag don't record an owner, and only
+	// give way to a release which tagged one
+	tags, err := bucketTags(ctx, svc, state.Bucket)
+	if err == nil {
+		if owner, ok := tags[websiteOwnerTag]; ok && owner != state.WebsiteOwner {
+			log.Debug("website hosting is owned by a newer release", "bucket", state.Bucket)
+			step.Update("Website hosting on bucket %s is used by a newer release, leaving it on", state.Bucket)
+			step.Done()
+			return nil
+		}
+
+		err = disableWebsite(ctx, svc, state.Bucket, tags)
+	}
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchBucket {
+			log.Debug("bucket no longer exists", "bucket", state.Bucket)
+			step.Update("Bucket %s no longer exists", state.Bucket)
+			step.Done()
+			return nil
+		}
+
+		return awsutil.Error(codes.Internal, err, "unable to disable website hosting on bucket %q", state.Bucket)
+	}
+
+	step.Done()
 
 	return nil
 }
+
+// disableWebsite turns off website hosting on bucket and removes the owner
+// tag from its tags.
+func disableWebsite(ctx context.Context, svc *s3.S3, bucket string, tags map[string]string) error {
+	_, err := svc.DeleteBucketWebsiteWithContext(ctx, &s3.DeleteBucketWebsiteInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, ok := tags[websiteOwnerTag]; !ok {
+		return nil
+	}
+
+	delete(tags, websiteOwnerTag)
+
+	return putBucketTags(ctx, svc, bucket, tags)
+}
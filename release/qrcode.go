@@ -0,0 +1,28 @@
+package release
+
+import (
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// showQRCode prints url and a QR code of it, drawn with half block
+// characters so it stays scannable at the terminal's line height. Nothing
+// is printed when the output isn't a terminal, where the code would only
+// clutter the logs.
+func showQRCode(log hclog.Logger, ui terminal.UI, url string) {
+	if url == "" || !ui.Interactive() {
+		return
+	}
+
+	q, err := qrcode.New(url, qrcode.Low)
+	if err != nil {
+		log.Warn("unable to render QR code", "url", url, "error", err)
+		return
+	}
+
+	ui.Output("Scan to open %s", url, terminal.WithHeaderStyle())
+	ui.Output(strings.TrimRight(q.ToSmallString(false), "\n"))
+}
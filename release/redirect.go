@@ -0,0 +1,206 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"github.com/hashicorp/waypoint-plugin-s3/platform"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CanonicalRedirect redirects every request for one host to another, such
+// as www.example.com to example.com, through a redirect-only bucket.
+type CanonicalRedirect struct {
+	// From is the host which is redirected, e.g. "www.example.com". S3
+	// website hosting routes requests by host, so it is also the name of
+	// the redirect bucket.
+	From string `hcl:"from"`
+
+	// To is the canonical host, e.g. "example.com".
+	To string `hcl:"to"`
+
+	// Protocol is the protocol redirected to, "https" (the default) or
+	// "http".
+	Protocol string `hcl:"protocol,optional"`
+}
+
+func (c *CanonicalRedirect) validate() error {
+	switch {
+	case c.From == "" || c.To == "":
+		return fmt.Errorf("from and to must be set")
+	case strings.EqualFold(c.From, c.To):
+		return fmt.Errorf("from and to must be different hosts")
+	case c.From != strings.ToLower(c.From):
+		return fmt.Errorf("from must be lower case as it names the redirect bucket")
+	case strings.Contains(c.From, "/") || strings.Contains(c.To, "/"):
+		return fmt.Errorf("from and to must be host names without a scheme or path")
+	case c.Protocol != "" && c.Protocol != "http" && c.Protocol != "https":
+		return fmt.Errorf("protocol must be \"http\" or \"https\"")
+	}
+
+	return nil
+}
+
+// resourceRedirectCreate creates the redirect bucket and configures it to
+// redirect every request to the canonical host. An existing bucket is only
+// reused if it has no website configuration or already redirects, so a
+// bucket serving content is never turned into a redirect.
+func (rm *ReleaseManager) resourceRedirectCreate(
+	ctx context.Context,
+	log hclog.Logger,
+	st terminal.Status,
+	deployment *platform.Deployment,
+	state *Resource_RedirectBucket,
+) error {
+	redirect := rm.config.CanonicalRedirect
+	if redirect == nil {
+		return nil
+	}
+
+	sess, err := rm.sessionConfig(deployment.Region).Session()
+	if err != nil {
+		return err
+	}
+	svc := s3.New(sess)
+
+	state.Name = redirect.From
+	state.Region = deployment.Region
+
+	_, err = svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(redirect.From)})
+	switch {
+	case err == nil:
+		if err := checkRedirectBucket(ctx, svc, redirect.From); err != nil {
+			return err
+		}
+	case statusCode(err) == http.StatusNotFound:
+		st.Update("Creating redirect bucket " + redirect.From)
+
+		in := &s3.CreateBucketInput{Bucket: aws.String(redirect.From)}
+		if deployment.Region != "us-east-1" {
+			in.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+				LocationConstraint: aws.String(deployment.Region),
+			}
+		}
+
+		if _, err := svc.CreateBucketWithContext(ctx, in); err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to create redirect bucket %q", redirect.From)
+		}
+
+		// Only a bucket the release created is deleted when it is destroyed
+		state.Created = true
+	case statusCode(err) == http.StatusForbidden:
+		return status.Errorf(codes.FailedPrecondition, "redirect bucket %q exists but is owned by another account", redirect.From)
+	default:
+		return awsutil.Error(codes.Internal, err, "unable to check redirect bucket %q", redirect.From)
+	}
+
+	protocol := redirect.Protocol
+	if protocol == "" {
+		protocol = "https"
+	}
+
+	st.Update(fmt.Sprintf("Redirecting %s to %s://%s", redirect.From, protocol, redirect.To))
+
+	_, err = svc.PutBucketWebsiteWithContext(ctx, &s3.PutBucketWebsiteInput{
+		Bucket: aws.String(redirect.From),
+		WebsiteConfiguration: &s3.WebsiteConfiguration{
+			RedirectAllRequestsTo: &s3.RedirectAllRequestsTo{
+				HostName: aws.String(redirect.To),
+				Protocol: aws.String(protocol),
+			},
+		},
+	})
+	if err != nil {
+		return awsutil.Error(codes.Internal, err, "unable to configure redirect bucket %q", redirect.From)
+	}
+
+	if len(rm.config.ResourceTags) > 0 {
+		if err := rm.tagBucket(ctx, svc, redirect.From); err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to tag bucket %q", redirect.From)
+		}
+	}
+
+	log.Info("canonical redirect configured", "from", redirect.From, "to", redirect.To,
+		"endpoint", awsutil.WebsiteEndpoint(redirect.From, deployment.Region))
+
+	return nil
+}
+
+// checkRedirectBucket refuses to reuse an existing bucket whose website
+// serves content rather than redirecting.
+func checkRedirectBucket(ctx context.Context, svc *s3.S3, bucket string) error {
+	out, err := svc.GetBucketWebsiteWithContext(ctx, &s3.GetBucketWebsiteInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchWebsiteConfiguration" {
+			return nil
+		}
+
+		return awsutil.Error(codes.Internal, err, "unable to read website configuration of bucket %q", bucket)
+	}
+
+	if out.RedirectAllRequestsTo == nil {
+		return status.Errorf(codes.FailedPrecondition,
+			"bucket %q already hosts a website, refusing to replace it with a redirect", bucket)
+	}
+
+	return nil
+}
+
+// resourceRedirectDestroy deletes the redirect bucket if the release
+// created it.
+func (rm *ReleaseManager) resourceRedirectDestroy(
+	ctx context.Context,
+	log hclog.Logger,
+	sg terminal.StepGroup,
+	state *Resource_RedirectBucket,
+) error {
+	if !state.Created {
+		return nil
+	}
+
+	step := sg.Add("Deleting redirect bucket %s...", state.Name)
+	defer step.Abort()
+
+	sess, err := rm.sessionConfig(state.Region).Session()
+	if err != nil {
+		return err
+	}
+
+	_, err = s3.New(sess).DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
+		Bucket: aws.String(state.Name),
+	})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		switch {
+		case ok && aerr.Code() == s3.ErrCodeNoSuchBucket:
+			log.Debug("redirect bucket no longer exists", "bucket", state.Name)
+		case ok && aerr.Code() == "BucketNotEmpty":
+			return status.Errorf(codes.FailedPrecondition,
+				"redirect bucket %q is not empty, objects were added outside the plugin", state.Name)
+		default:
+			return awsutil.Error(codes.Internal, err, "unable to delete redirect bucket %q", state.Name)
+		}
+	}
+
+	step.Done()
+
+	return nil
+}
+
+// statusCode returns the HTTP status of a failed AWS request, or 0.
+func statusCode(err error) int {
+	if rf, ok := err.(awserr.RequestFailure); ok {
+		return rf.StatusCode()
+	}
+
+	return 0
+}
@@ -3,9 +3,16 @@ package release
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/hashicorp/go-hclog"
-	"github.com/hashicorp/waypoint-plugin-s3/registry"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/awsutil"
+	"github.com/hashicorp/waypoint-plugin-s3/internal/validate"
+	"github.com/hashicorp/waypoint-plugin-s3/platform"
 	"github.com/hashicorp/waypoint-plugin-sdk/component"
 	"github.com/hashicorp/waypoint-plugin-sdk/framework/resource"
 	sdk "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
@@ -16,6 +23,61 @@ import (
 
 type ReleaseConfig struct {
 	Active bool "hcl:directory,optional"
+
+	// ResourceTags are merged into the tags of the deployment's bucket and
+	// of the CloudFront distribution the deploy stanza names.
+	ResourceTags map[string]string `hcl:"resource_tags,optional"`
+
+	// MinTLSVersion is the lowest TLS version, e.g. "1.2", used to connect
+	// to AWS.
+	MinTLSVersion string `hcl:"min_tls_version,optional"`
+
+	// EndpointResolver maps AWS service IDs, such as "s3" and "sts", to the
+	// URL used instead of their default endpoint. "{region}" in a URL is
+	// replaced by the region. Other services resolve as usual.
+	EndpointResolver map[string]string `hcl:"endpoint_resolver,optional"`
+
+	// SharedConfigFile is the path of the AWS config file, replacing
+	// ~/.aws/config.
+	SharedConfigFile string `hcl:"shared_config_file,optional"`
+
+	// SharedCredentialsFile is the path of the AWS credentials file,
+	// replacing ~/.aws/credentials.
+	SharedCredentialsFile string `hcl:"shared_credentials_file,optional"`
+
+	// Profile is the AWS profile to use, e.g. an SSO or credential_process
+	// profile, instead of AWS_PROFILE or "default".
+	Profile string `hcl:"profile,optional"`
+
+	// CABundle is the path of a PEM file with certificate authorities
+	// trusted in addition to the system ones, e.g. for an on-premises
+	// S3-compatible endpoint.
+	CABundle string `hcl:"ca_bundle,optional"`
+
+	// InsecureSkipVerify disables TLS certificate verification. Only use it
+	// for testing.
+	InsecureSkipVerify bool `hcl:"insecure_skip_verify,optional"`
+
+	// EnableWebsite turns on static website hosting for the deployment's
+	// bucket if it isn't already. Website hosting enabled by the release
+	// is turned off again when the release is destroyed.
+	EnableWebsite bool `hcl:"enable_website,optional"`
+
+	// IndexDocument is the index document set by EnableWebsite, defaults
+	// to "index.html".
+	IndexDocument string `hcl:"index_document,optional"`
+
+	// ErrorDocument is the error document set by EnableWebsite.
+	ErrorDocument string `hcl:"error_document,optional"`
+
+	// CanonicalRedirect redirects another host, such as the www subdomain,
+	// to the canonical host of the site.
+	CanonicalRedirect *CanonicalRedirect `hcl:"canonical_redirect,block"`
+
+	// ShowQRCode prints a QR code of the release URL once released, for
+	// opening previews on a phone. It is skipped when the output isn't a
+	// terminal.
+	ShowQRCode bool `hcl:"show_qr_code,optional"`
 }
 
 type ReleaseManager struct {
@@ -29,15 +91,35 @@ func (rm *ReleaseManager) Config() (interface{}, error) {
 
 // Implement ConfigurableNotify
 func (rm *ReleaseManager) ConfigSet(config interface{}) error {
-	_, ok := config.(*ReleaseConfig)
+	c, ok := config.(*ReleaseConfig)
 	if !ok {
 		// The Waypoint SDK should ensure this never gets hit
 		return fmt.Errorf("Expected *ReleaseConfig as parameter")
 	}
 
 	// validate the config
+	v := validate.New("release")
 
-	return nil
+	v.AddError("resource_tags", awsutil.ValidateTags(c.ResourceTags))
+	v.AddError("min_tls_version", awsutil.ValidateTLSVersion(c.MinTLSVersion))
+	v.AddError("endpoint_resolver", awsutil.ValidateEndpoints(c.EndpointResolver))
+	v.AddError("shared_config_file", awsutil.ValidateFile(c.SharedConfigFile))
+	v.AddError("shared_credentials_file", awsutil.ValidateFile(c.SharedCredentialsFile))
+	v.AddError("ca_bundle", awsutil.ValidateCABundle(c.CABundle))
+
+	if !c.EnableWebsite && (c.IndexDocument != "" || c.ErrorDocument != "") {
+		v.Add("enable_website", "must be set to use index_document or error_document")
+	}
+
+	if c.CanonicalRedirect != nil {
+		v.AddError("canonical_redirect", c.CanonicalRedirect.validate())
+	}
+
+	if strings.Contains(c.IndexDocument, "/") {
+		v.Add("index_document", "must be a file name such as \"index.html\" without a slash")
+	}
+
+	return v.Err()
 }
 
 // Implement Builder
@@ -50,6 +132,11 @@ func (rm *ReleaseManager) StatusFunc() interface{} {
 	return rm.status
 }
 
+// Implement component.Release
+func (r *Release) URL() string {
+	return r.Url
+}
+
 // This function can be implemented to return various connection info required
 // to connect to your given platform for Resource Manager. It could return
 // a struct with client information, what namespace to connect to, a config,
@@ -73,15 +160,22 @@ func (rm *ReleaseManager) resourceManager(log hclog.Logger, dcr *component.Decla
 		resource.WithValueProvider(rm.getConnectContext),
 		resource.WithDeclaredResourcesResp(dcr),
 		resource.WithResource(resource.NewResource(
-			resource.WithName("template_example"),
+			resource.WithName("release"),
 			resource.WithState(&Resource_Release{}),
 			resource.WithCreate(rm.resourceReleaseCreate),
 			resource.WithDestroy(rm.resourceReleaseDestroy),
 			resource.WithStatus(rm.resourceReleaseStatus),
-			resource.WithPlatform("template_platform"),                                         // Update this to match your plugins platform, like Kubernetes
-			resource.WithCategoryDisplayHint(sdk.ResourceCategoryDisplayHint_INSTANCE_MANAGER), // This is meant for the UI to determine what kind of icon to show
+			resource.WithPlatform("s3"),
+			resource.WithCategoryDisplayHint(sdk.ResourceCategoryDisplayHint_ROUTER),
+		)),
+		resource.WithResource(resource.NewResource(
+			resource.WithName("redirect_bucket"),
+			resource.WithState(&Resource_RedirectBucket{}),
+			resource.WithCreate(rm.resourceRedirectCreate),
+			resource.WithDestroy(rm.resourceRedirectDestroy),
+			resource.WithPlatform("s3"),
+			resource.WithCategoryDisplayHint(sdk.ResourceCategoryDisplayHint_ROUTER),
 		)),
-		// NOTE: Add more resource funcs here if your plugin has more than 1 resource
 	)
 }
 
@@ -100,7 +194,7 @@ func (rm *ReleaseManager) resourceManager(log hclog.Logger, dcr *component.Decla
 // - *component.LabelSet
 
 // In addition to default input parameters the platform.Deployment from the Deploy step
-// can also be injected.
+// is injected.
 //
 // The output parameters for ReleaseFunc must be a Struct which can
 // be serialzied to Protocol Buffers binary format and an error.
@@ -114,13 +208,18 @@ func (rm *ReleaseManager) release(
 	log hclog.Logger,
 	dcr *component.DeclaredResourcesResp,
 	ui terminal.UI,
-	artifact *registry.Zip,
+	deployment *platform.Deployment,
 ) (*Release, error) {
 	u := ui.Status()
 	defer u.Close()
 	u.Update("Release application")
 
-	var result *Release
+	if rm.config.InsecureSkipVerify {
+		log.Warn("TLS certificate verification is disabled")
+		ui.Output(awsutil.InsecureSkipVerifyWarning, terminal.WithWarningStyle())
+	}
+
+	result := &Release{}
 
 	// Create our resource manager and create deployment resources
 	r := rm.resourceManager(log, dcr)
@@ -129,7 +228,7 @@ func (rm *ReleaseManager) release(
 	// they will not be invoked during CreateAll()
 	if err := r.CreateAll(
 		ctx, log, u, ui,
-		artifact, &result,
+		deployment, result,
 	); err != nil {
 		return nil, err
 	}
@@ -139,6 +238,10 @@ func (rm *ReleaseManager) release(
 
 	u.Update("Application deployed")
 
+	if rm.config.ShowQRCode {
+		showQRCode(log, ui, result.Url)
+	}
+
 	return result, nil
 }
 
@@ -147,7 +250,7 @@ func (rm *ReleaseManager) status(
 	ji *component.JobInfo,
 	log hclog.Logger,
 	ui terminal.UI,
-	artifact *registry.Zip,
+	deployment *platform.Deployment,
 	release *Release,
 ) (*sdk.StatusReport, error) {
 	sg := ui.StepGroup()
@@ -186,19 +289,274 @@ func (rm *ReleaseManager) resourceReleaseCreate(
 	log hclog.Logger,
 	st terminal.Status,
 	ui terminal.UI,
-	zip *registry.Zip,
+	deployment *platform.Deployment,
 	result *Release,
+	state *Resource_Release,
 ) error {
-	// Create your release resource here!
+	// Releases only use what the deployment recorded, never the artifact,
+	// so they can be re-run on their own
+	if deployment.BucketName == "" || deployment.Region == "" {
+		return status.Errorf(codes.FailedPrecondition, "deployment %q does not record its bucket and region, deploy again to release it", deployment.Id)
+	}
+
+	state.Name = deployment.BucketName
+	state.Bucket = deployment.BucketName
+	state.Region = deployment.Region
+
+	result.Bucket = deployment.BucketName
+	result.Region = deployment.Region
+	result.Prefix = deployment.Prefix
+
+	sess, err := rm.sessionConfig(deployment.Region).Session()
+	if err != nil {
+		return err
+	}
+	svc := s3.New(sess)
+
+	if len(rm.config.ResourceTags) > 0 {
+		st.Update("Tagging bucket " + deployment.BucketName)
+
+		if err := rm.tagBucket(ctx, svc, deployment.BucketName); err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to tag bucket %q", deployment.BucketName)
+		}
+
+		if id := deployment.CloudfrontDistributionId; id != "" {
+			st.Update("Tagging CloudFront distribution " + id)
+
+			if err := rm.tagDistribution(ctx, cloudfront.New(sess), id); err != nil {
+				return awsutil.Error(codes.Internal, err, "unable to tag CloudFront distribution %q", id)
+			}
+		}
+	}
+
+	var enabled bool
+	website, err := svc.GetBucketWebsiteWithContext(ctx, &s3.GetBucketWebsiteInput{
+		Bucket: aws.String(deployment.BucketName),
+	})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != "NoSuchWebsiteConfiguration" {
+			return awsutil.Error(codes.Internal, err, "unable to read website configuration of bucket %q", deployment.BucketName)
+		}
+
+		if !rm.config.EnableWebsite {
+			ui.Output("Bucket %q does not have website hosting enabled, so the release has no URL",
+				deployment.BucketName, terminal.WithWarningStyle())
+			return nil
+		}
+
+		st.Update("Enabling website hosting on bucket " + deployment.BucketName)
+
+		if err := rm.enableWebsite(ctx, svc, deployment.BucketName); err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to enable website hosting on bucket %q", deployment.BucketName)
+		}
+
+		enabled = true
+	}
+
+	if err := rm.claimWebsite(ctx, svc, deployment.BucketName, enabled, state); err != nil {
+		return awsutil.Error(codes.Internal, err, "unable to record the release owning website hosting on bucket %q", deployment.BucketName)
+	}
+
+	// Re-running a release re-applies the configured documents. Atomic
+	// swap configurations are owned by the deploy.
+	if err == nil && rm.config.EnableWebsite && awsutil.LivePrefix(website.RoutingRules) == "" && !rm.websiteConfigured(website) {
+		st.Update("Updating website configuration of bucket " + deployment.BucketName)
+
+		cfg := rm.websiteConfiguration()
+		cfg.RoutingRules = website.RoutingRules
+
+		_, err := svc.PutBucketWebsiteWithContext(ctx, &s3.PutBucketWebsiteInput{
+			Bucket:               aws.String(deployment.BucketName),
+			WebsiteConfiguration: cfg,
+		})
+		if err != nil {
+			return awsutil.Error(codes.Internal, err, "unable to update website configuration of bucket %q", deployment.BucketName)
+		}
+	}
+
+	// Releasing an atomic_swap deployment which isn't live, e.g. to roll
+	// back, swaps the website back to its generation
+	if err == nil && deployment.Prefix != "" && awsutil.LivePrefix(website.RoutingRules) != deployment.Prefix {
+		cfg := &s3.WebsiteConfiguration{
+			IndexDocument: website.IndexDocument,
+			ErrorDocument: website.ErrorDocument,
+			RoutingRules:  website.RoutingRules,
+		}
+
+		if awsutil.RetargetSwap(cfg, deployment.Prefix) {
+			// Prune only keeps the last two generations
+			out, err := svc.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+				Bucket:  aws.String(deployment.BucketName),
+				Prefix:  aws.String(deployment.Prefix + "/"),
+				MaxKeys: aws.Int64(1),
+			})
+			if err != nil {
+				return awsutil.Error(codes.Internal, err, "unable to list %s in bucket %q", deployment.Prefix, deployment.BucketName)
+			}
+			if len(out.Contents) == 0 {
+				return status.Errorf(codes.FailedPrecondition, "%s of deployment %q no longer exists in bucket %q, deploy again to release it",
+					deployment.Prefix, deployment.Id, deployment.BucketName)
+			}
+
+			st.Update("Swapping the website of bucket " + deployment.BucketName + " to " + deployment.Prefix)
+
+			_, err = svc.PutBucketWebsiteWithContext(ctx, &s3.PutBucketWebsiteInput{
+				Bucket:               aws.String(deployment.BucketName),
+				WebsiteConfiguration: cfg,
+			})
+			if err != nil {
+				return awsutil.Error(codes.Internal, err, "unable to swap the website of bucket %q", deployment.BucketName)
+			}
+		}
+	}
+
+	result.Url = "http://" + awsutil.WebsiteEndpoint(deployment.BucketName, deployment.Region)
 
 	return nil
 }
 
+// enableWebsite turns on static website hosting for bucket.
+func (rm *ReleaseManager) enableWebsite(ctx context.Context, svc *s3.S3, bucket string) error {
+	_, err := svc.PutBucketWebsiteWithContext(ctx, &s3.PutBucketWebsiteInput{
+		Bucket:               aws.String(bucket),
+		WebsiteConfiguration: rm.websiteConfiguration(),
+	})
+
+	return err
+}
+
+// websiteConfiguration is the website configuration EnableWebsite puts on
+// the bucket.
+func (rm *ReleaseManager) websiteConfiguration() *s3.WebsiteConfiguration {
+	index := rm.config.IndexDocument
+	if index == "" {
+		index = "index.html"
+	}
+
+	website := &s3.WebsiteConfiguration{
+		IndexDocument: &s3.IndexDocument{Suffix: aws.String(index)},
+	}
+
+	if rm.config.ErrorDocument != "" {
+		website.ErrorDocument = &s3.ErrorDocument{Key: aws.String(strings.TrimPrefix(rm.config.ErrorDocument, "/"))}
+	}
+
+	return website
+}
+
+// websiteConfigured reports whether website already has the documents
+// EnableWebsite sets.
+func (rm *ReleaseManager) websiteConfigured(website *s3.GetBucketWebsiteOutput) bool {
+	want := rm.websiteConfiguration()
+
+	var index, errorDoc string
+	if website.IndexDocument != nil {
+		index = aws.StringValue(website.IndexDocument.Suffix)
+	}
+	if website.ErrorDocument != nil {
+		errorDoc = aws.StringValue(website.ErrorDocument.Key)
+	}
+
+	var wantError string
+	if want.ErrorDocument != nil {
+		wantError = aws.StringValue(want.ErrorDocument.Key)
+	}
+
+	return website.RedirectAllRequestsTo == nil && index == aws.StringValue(want.IndexDocument.Suffix) && errorDoc == wantError
+}
+
+// sessionConfig returns the options of AWS sessions for region.
+func (rm *ReleaseManager) sessionConfig(region string) awsutil.SessionConfig {
+	return awsutil.SessionConfig{
+		Region:                region,
+		MinTLSVersion:         rm.config.MinTLSVersion,
+		Endpoints:             rm.config.EndpointResolver,
+		SharedConfigFile:      rm.config.SharedConfigFile,
+		SharedCredentialsFile: rm.config.SharedCredentialsFile,
+		Profile:               rm.config.Profile,
+		CABundle:              rm.config.CABundle,
+		InsecureSkipVerify:    rm.config.InsecureSkipVerify,
+	}
+}
+
+// tagBucket merges the configured resource tags into the bucket's existing
+// tags, as PutBucketTagging replaces the whole tag set.
+func (rm *ReleaseManager) tagBucket(ctx context.Context, svc *s3.S3, bucket string) error {
+	tags, err := bucketTags(ctx, svc, bucket)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range rm.config.ResourceTags {
+		tags[k] = v
+	}
+
+	return putBucketTags(ctx, svc, bucket, tags)
+}
+
+// bucketTags returns the tags of bucket.
+func bucketTags(ctx context.Context, svc *s3.S3, bucket string) (map[string]string, error) {
+	tags := map[string]string{}
+
+	out, err := svc.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		// A bucket without any tags reports NoSuchTagSet
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchTagSet" {
+			return tags, nil
+		}
+
+		return nil, err
+	}
+
+	for _, t := range out.TagSet {
+		tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+
+	return tags, nil
+}
+
+// putBucketTags replaces the tags of bucket with tags. S3 rejects an empty
+// tag set, so the tagging is deleted instead.
+func putBucketTags(ctx context.Context, svc *s3.S3, bucket string, tags map[string]string) error {
+	if len(tags) == 0 {
+		_, err := svc.DeleteBucketTaggingWithContext(ctx, &s3.DeleteBucketTaggingInput{
+			Bucket: aws.String(bucket),
+		})
+		return err
+	}
+
+	_, err := svc.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(bucket),
+		Tagging: &s3.Tagging{TagSet: awsutil.S3Tags(tags)},
+	})
+	return err
+}
+
+// tagDistribution adds the configured resource tags to the distribution
+// with id. TagResource merges them into its existing tags.
+func (rm *ReleaseManager) tagDistribution(ctx context.Context, svc *cloudfront.CloudFront, id string) error {
+	out, err := svc.GetDistributionWithContext(ctx, &cloudfront.GetDistributionInput{
+		Id: aws.String(id),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.TagResourceWithContext(ctx, &cloudfront.TagResourceInput{
+		Resource: out.Distribution.ARN,
+		Tags:     awsutil.CloudFrontTags(rm.config.ResourceTags),
+	})
+	return err
+}
+
 func (rm *ReleaseManager) resourceReleaseStatus(
 	ctx context.Context,
 	ui terminal.UI,
 	sg terminal.StepGroup,
-	zip *registry.Zip,
+	deployment *platform.Deployment,
 ) error {
 	// Determine health status of "this" resource.
 	return nil
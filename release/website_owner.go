@@ -0,0 +1,55 @@
+package release
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// websiteOwnerTag is the bucket tag naming the release which owns website
+// hosting the plugin turned on, see claimWebsite.
+const websiteOwnerTag = "waypoint-plugin-s3/website-owner"
+
+// claimWebsite makes the release the owner of website hosting on bucket if
+// the release turned it on, or an earlier release did and tagged the bucket
+// with its owner. The newest release relying on hosting owns it, so
+// destroying a superseded release leaves it on, see resourceReleaseDestroy.
+// Website hosting set up outside the plugin is never claimed.
+func (rm *ReleaseManager) claimWebsite(ctx context.Context, svc *s3.S3, bucket string, enabled bool, state *Resource_Release) error {
+	tags, err := bucketTags(ctx, svc, bucket)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := tags[websiteOwnerTag]; !ok && !enabled {
+		return nil
+	}
+
+	owner, err := newWebsiteOwner()
+	if err != nil {
+		return err
+	}
+
+	tags[websiteOwnerTag] = owner
+	if err := putBucketTags(ctx, svc, bucket, tags); err != nil {
+		return err
+	}
+
+	state.WebsiteCreated = true
+	state.WebsiteOwner = owner
+
+	return nil
+}
+
+// newWebsiteOwner returns a random ID identifying a release as the owner
+// of website hosting.
+func newWebsiteOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}